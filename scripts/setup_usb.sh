@@ -36,6 +36,20 @@ cat $DESCRIPTOR_PATH > $GADGET_PATH/functions/hid.usb1/report_desc
 echo "链接功能到配置..."
 ln -s $GADGET_PATH/functions/hid.usb1 $CONFIG_PATH/
 
+# 5.1 创建 UAC2 麦克风功能，目标机器看到一个 USB 麦克风
+# 浏览器麦克风在会话中启用时播放到这里，其余时间是静音
+echo "创建 UAC2 麦克风功能..."
+UAC_PATH="$GADGET_PATH/functions/uac2.usb0"
+mkdir -p $UAC_PATH
+echo 1 > $UAC_PATH/p_chmask      # 设备到主机，单声道
+echo 48000 > $UAC_PATH/p_srate
+echo 2 > $UAC_PATH/p_ssize       # S16_LE
+# 关闭主机到设备的扬声器，旧内核不支持 0
+echo 0 > $UAC_PATH/c_chmask 2>/dev/null || echo 1 > $UAC_PATH/c_chmask
+echo 48000 > $UAC_PATH/c_srate
+echo 2 > $UAC_PATH/c_ssize
+ln -s $UAC_PATH $CONFIG_PATH/ 2>/dev/null
+
 # 6. 启用/重新启用 gadget
 echo "启用 USB gadget..."
 UDC_CONTROLLER=$(ls /sys/class/udc/ | head -n1)
@@ -65,3 +79,9 @@ else
     echo "⚠️  HID 设备未创建，但配置可能仍部分成功"
     echo "检查内核消息: dmesg | tail -10"
 fi
+
+if grep -q UAC2Gadget /proc/asound/cards; then
+    echo "✓ UAC2 声卡已创建: hw:UAC2Gadget,0"
+else
+    echo "⚠️  UAC2 声卡未创建，内核可能没有 CONFIG_USB_CONFIGFS_F_UAC2"
+fi
@@ -3,6 +3,9 @@ package src
 import (
 	"flag"
 	"log"
+	"time"
+
+	"device-go/src/libs/webrtc"
 )
 
 type Args struct {
@@ -16,14 +19,30 @@ type Args struct {
 	VideoPath       string
 	VideoBinPath    string
 	VideoSocketPath string
+	VideoCodecs     string
+	SyntheticPath   string
+
+	WebRTCDisconnectTimeout time.Duration
+
+	SessionIdleTimeout time.Duration
+	SessionMaxDuration time.Duration
 
 	VideoMonitorPath       string
 	VideoMonitorBinPath    string
 	VideoMonitorSocketPath string
 
+	EdidPath string
+
 	HidPath    string
 	HidUdcPath string
 
+	ClipboardAgentUrl   string
+	ClipboardAgentToken string
+	OcrBinPath          string
+	OcrLang             string
+
+	PowerBinPath string
+
 	FrontBinPath    string
 	FrontSocketPath string
 
@@ -33,6 +52,35 @@ type Args struct {
 	SpeechSampleRate uint
 	SpeechChannel    uint
 
+	LocalApiAddr string
+	LocalSignal  string
+
+	RtspAddr       string
+	RtspMaxClients uint
+
+	WhepMaxSessions uint
+
+	// raw video helper, nv12 frames of snapshots and frame processors
+	RawBinPath    string
+	RawSocketPath string
+
+	RecordPath            string
+	RecordMaxFileSize     uint
+	RecordMaxFileDuration time.Duration
+	RecordRetention       time.Duration
+	RecordMaxTotalSize    uint
+
+	AudioSource     uint
+	AudioHardware   string
+	AudioBinPath    string
+	AudioSocketPath string
+	AudioBitRate    uint
+
+	MicSink       uint
+	MicHardware   string
+	MicBinPath    string
+	MicSocketPath string
+
 	Version bool
 	Help    bool
 }
@@ -48,13 +96,27 @@ func ParseArgs() Args {
 	var videoPath string
 	var videoBinPath string
 	var videoSocketPath string
+	var videoCodecs string
+	var syntheticPath string
+	var webrtcDisconnectTimeout time.Duration
+
+	var sessionIdleTimeout time.Duration
+	var sessionMaxDuration time.Duration
 	var videoMonitorPath string
 	var videoMonitorBinPath string
 	var videoMonitorSocketPath string
+	var edidPath string
 
 	var hidPath string
 	var hidUdcPath string
 
+	var clipboardAgentUrl string
+	var clipboardAgentToken string
+	var ocrBinPath string
+	var ocrLang string
+
+	var powerBinPath string
+
 	var frontBinPath string
 	var frontSocketPath string
 
@@ -64,6 +126,34 @@ func ParseArgs() Args {
 	var speechSampleRate uint
 	var speechChannel uint
 
+	var localApiAddr string
+	var localSignal string
+
+	var rtspAddr string
+	var rtspMaxClients uint
+
+	var whepMaxSessions uint
+
+	var rawBinPath string
+	var rawSocketPath string
+
+	var recordPath string
+	var recordMaxFileSize uint
+	var recordMaxFileDuration time.Duration
+	var recordRetention time.Duration
+	var recordMaxTotalSize uint
+
+	var audioSource uint
+	var audioHardware string
+	var audioBinPath string
+	var audioSocketPath string
+	var audioBitRate uint
+
+	var micSink uint
+	var micHardware string
+	var micBinPath string
+	var micSocketPath string
+
 	var version bool
 	var help bool
 
@@ -73,17 +163,30 @@ func ParseArgs() Args {
 
 	flag.StringVar(&configPath, "config-path", "/etc/kvvm-ai", "Config file path")
 
-	flag.UintVar(&mediaSource, "media-source", 1, "Media source, 1 video, 2 gstreamer")
+	flag.UintVar(&mediaSource, "media-source", 1, "Media source, 1 video, 2 gstreamer, 3 synthetic")
 	flag.StringVar(&videoPath, "video-path", "/dev/video0", "Video path")
 	flag.StringVar(&videoBinPath, "video-bin-path", "/root/video", "Video bin path")
 	flag.StringVar(&videoSocketPath, "video-socket-path", "/var/run/capture.sock", "Video socket path")
+	flag.StringVar(&videoCodecs, "video-codecs", "h264", "Video codecs in preference order, h264, h265, vp8, vp9")
+	flag.StringVar(&syntheticPath, "synthetic-path", "", "Synthetic source h264 annex b file to loop, empty for test pattern")
+	flag.DurationVar(&webrtcDisconnectTimeout, "webrtc-disconnect-timeout", 30*time.Second, "Webrtc session grace of a disconnected peer, before it is closed")
+	flag.DurationVar(&sessionIdleTimeout, "session-idle-timeout", 30*time.Minute, "Webrtc session is closed without hid input or viewer activity, 0 to disable")
+	flag.DurationVar(&sessionMaxDuration, "session-max-duration", 0, "Webrtc session max duration, 0 for unlimited")
 	flag.StringVar(&videoMonitorPath, "video-monitor-path", "/dev/v4l-subdev2", "Video sub device path")
 	flag.StringVar(&videoMonitorBinPath, "video-monitor-bin-path", "/root/video-monitor", "Video monitor bin path")
 	flag.StringVar(&videoMonitorSocketPath, "video-monitor-socket-path", "/var/run/monitor.sock", "Video monitor socket path")
+	flag.StringVar(&edidPath, "edid-path", "", "Capture input edid, v4l2 device or sysfs file, empty to disable")
 
 	flag.StringVar(&hidPath, "hid-path", "/dev/hidg0", "HID path")
 	flag.StringVar(&hidUdcPath, "hid-udc-path", "/sys/kernel/config/usb_gadget/rockchip/UDC", "HID udc path")
 
+	flag.StringVar(&clipboardAgentUrl, "clipboard-agent-url", "", "Clipboard agent url on the target, e.g. http://192.168.1.10:8090, empty to disable")
+	flag.StringVar(&clipboardAgentToken, "clipboard-agent-token", "", "Clipboard agent bearer token")
+	flag.StringVar(&ocrBinPath, "ocr-bin-path", "", "Text recognition bin path of clipboard, tesseract compatible, empty to disable")
+	flag.StringVar(&ocrLang, "ocr-lang", "eng", "Text recognition language")
+
+	flag.StringVar(&powerBinPath, "power-bin-path", "", "Power control bin path of target, run with on, off, reset or cycle, empty to disable")
+
 	flag.StringVar(&frontBinPath, "front-bin-path", "/root/font", "Front bin path")
 	flag.StringVar(&frontSocketPath, "front-socket-path", "/var/run/front.sock", "Front socket path")
 
@@ -93,6 +196,34 @@ func ParseArgs() Args {
 	flag.UintVar(&speechSampleRate, "speech-sample-rate", 44100, "Speech sample rate")
 	flag.UintVar(&speechChannel, "speech-channel", 1, "Speech channel")
 
+	flag.StringVar(&localApiAddr, "local-api-addr", ":8080", "Local http api address, empty to disable")
+	flag.StringVar(&localSignal, "local-signal", "auto", "Local signaling of local api, auto when cloud is unreachable, always, off")
+
+	flag.StringVar(&rtspAddr, "rtsp-addr", "", "Rtsp server address, e.g. :8554, empty to disable")
+	flag.UintVar(&rtspMaxClients, "rtsp-max-clients", 4, "Rtsp server max concurrent clients, 0 for unlimited")
+
+	flag.UintVar(&whepMaxSessions, "whep-max-sessions", 0, "Whep endpoint of local api max concurrent sessions, 0 to disable")
+
+	flag.StringVar(&rawBinPath, "raw-bin-path", "/root/raw", "Raw video bin path, one capture is shared by snapshots and frame processors")
+	flag.StringVar(&rawSocketPath, "raw-socket-path", "/var/run/raw.sock", "Raw video socket path")
+
+	flag.StringVar(&recordPath, "record-path", "", "Session record directory, empty to disable")
+	flag.UintVar(&recordMaxFileSize, "record-max-file-size", 256, "Session record max file size in MB")
+	flag.DurationVar(&recordMaxFileDuration, "record-max-file-duration", 10*time.Minute, "Session record max file duration")
+	flag.DurationVar(&recordRetention, "record-retention", 7*24*time.Hour, "Session record retention, 0 to keep forever")
+	flag.UintVar(&recordMaxTotalSize, "record-max-total-size", 4096, "Session record max total size in MB, 0 for unlimited")
+
+	flag.UintVar(&audioSource, "audio-source", 0, "Audio source, 0 none, 1 helper, 2 gstreamer")
+	flag.StringVar(&audioHardware, "audio-hw", "hw:0,0", "Audio alsa hardware of hdmi capture")
+	flag.StringVar(&audioBinPath, "audio-bin-path", "/root/audio", "Audio opus helper bin path")
+	flag.StringVar(&audioSocketPath, "audio-socket-path", "/var/run/audio.sock", "Audio socket path")
+	flag.UintVar(&audioBitRate, "audio-bit-rate", 64, "Audio opus bit rate in kbit/s")
+
+	flag.UintVar(&micSink, "mic-sink", 0, "Browser microphone sink, 0 none, 1 helper, 2 gstreamer")
+	flag.StringVar(&micHardware, "mic-hw", "hw:UAC2Gadget,0", "Microphone alsa hardware of usb audio gadget")
+	flag.StringVar(&micBinPath, "mic-bin-path", "/root/uac", "Microphone opus decode helper bin path")
+	flag.StringVar(&micSocketPath, "mic-socket-path", "/var/run/uac.sock", "Microphone socket path")
+
 	flag.BoolVar(&version, "version", false, "Print version")
 	flag.BoolVar(&help, "help", false, "Print help")
 
@@ -107,6 +238,10 @@ func ParseArgs() Args {
 			log.Fatalln("Server url is required")
 		} else if serveClientId == "" {
 			log.Fatalln("Server oauth client id is required")
+		} else if _, err := webrtc.ParseVideoCodecs(videoCodecs); err != nil {
+			log.Fatalln("Video codecs invalid", err)
+		} else if localSignal != LocalSignalAuto && localSignal != LocalSignalAlways && localSignal != LocalSignalOff {
+			log.Fatalln("Local signal invalid", localSignal)
 		}
 	}
 
@@ -121,12 +256,28 @@ func ParseArgs() Args {
 		VideoPath:              videoPath,
 		VideoBinPath:           videoBinPath,
 		VideoSocketPath:        videoSocketPath,
+		VideoCodecs:            videoCodecs,
+		SyntheticPath:          syntheticPath,
 		VideoMonitorPath:       videoMonitorPath,
 		VideoMonitorBinPath:    videoMonitorBinPath,
 		VideoMonitorSocketPath: videoMonitorSocketPath,
 
+		WebRTCDisconnectTimeout: webrtcDisconnectTimeout,
+
+		SessionIdleTimeout: sessionIdleTimeout,
+		SessionMaxDuration: sessionMaxDuration,
+
+		EdidPath: edidPath,
+
 		HidPath: hidPath,
 
+		ClipboardAgentUrl:   clipboardAgentUrl,
+		ClipboardAgentToken: clipboardAgentToken,
+		OcrBinPath:          ocrBinPath,
+		OcrLang:             ocrLang,
+
+		PowerBinPath: powerBinPath,
+
 		FrontBinPath:    frontBinPath,
 		FrontSocketPath: frontSocketPath,
 
@@ -136,6 +287,34 @@ func ParseArgs() Args {
 		SpeechSampleRate: speechSampleRate,
 		SpeechChannel:    speechChannel,
 
+		LocalApiAddr: localApiAddr,
+		LocalSignal:  localSignal,
+
+		RtspAddr:       rtspAddr,
+		RtspMaxClients: rtspMaxClients,
+
+		WhepMaxSessions: whepMaxSessions,
+
+		RawBinPath:    rawBinPath,
+		RawSocketPath: rawSocketPath,
+
+		RecordPath:            recordPath,
+		RecordMaxFileSize:     recordMaxFileSize,
+		RecordMaxFileDuration: recordMaxFileDuration,
+		RecordRetention:       recordRetention,
+		RecordMaxTotalSize:    recordMaxTotalSize,
+
+		AudioSource:     audioSource,
+		AudioHardware:   audioHardware,
+		AudioBinPath:    audioBinPath,
+		AudioSocketPath: audioSocketPath,
+		AudioBitRate:    audioBitRate,
+
+		MicSink:       micSink,
+		MicHardware:   micHardware,
+		MicBinPath:    micBinPath,
+		MicSocketPath: micSocketPath,
+
 		Version: version,
 		Help:    help,
 	}
@@ -0,0 +1,117 @@
+package src
+
+import (
+	"fmt"
+	"log"
+
+	WEBRTC "github.com/pion/webrtc/v4"
+
+	"device-go/src/libs/webrtc"
+	"device-go/src/packages/audio"
+	"device-go/src/packages/gstreamer"
+)
+
+const DeviceAudioSourceNone uint = 0
+const DeviceAudioSourceHelper uint = 1
+const DeviceAudioSourceGst uint = 2
+
+// opus is always 48kHz in webrtc
+const audioSampleRate uint = 48000
+const audioChannel uint = 2
+
+// rtp port of gstreamer audio, video uses 10000
+const audioGstPort = 10002
+
+// audio start, the track is added if the session enables audio and the offer receives it
+//
+// audio is optional, so errors are logged and the session goes on without it
+func (d *Device) wrtcAudioStart(offer *WEBRTC.SessionDescription) {
+	if d.audioSource == DeviceAudioSourceNone || !d.wrtcAudio || d.ma != nil || d.mga != nil {
+		return
+	} else if !webrtc.OfferAudio(offer) {
+		log.Println("device audio skip, offer does not receive audio")
+		return
+	}
+
+	err := d.audioStart()
+	if err != nil {
+		log.Println("device audio start error", err)
+		d.audioStop()
+		return
+	}
+
+	log.Println("device audio start")
+}
+
+func (d *Device) audioStart() error {
+	wrtc := d.useWrtc()
+	capability := webrtc.AudioCodecCapability()
+
+	switch d.audioSource {
+	case DeviceAudioSourceHelper:
+		{
+			err := wrtc.AddAudioTrackSample(capability)
+			if err != nil {
+				return err
+			}
+
+			ma := audio.NewAudio(
+				d.audioHardware,
+				d.audioBinPath,
+				d.audioSocketPath,
+				audioSampleRate,
+				audioChannel,
+				d.audioBitRate,
+			)
+			d.ma = &ma
+
+			d.ma.OnData = func(id uint32, timestamp uint64, packet []byte) {
+				wrtc.WriteAudioTrackSample(packet, timestamp)
+			}
+
+			return d.ma.Open()
+		}
+	case DeviceAudioSourceGst:
+		{
+			err := wrtc.AddAudioTrackRtp(capability)
+			if err != nil {
+				return err
+			}
+
+			mga, err := gstreamer.NewGstreamer(
+				d.gstProfile,
+				d.audioHardware,
+				"localhost",
+				audioGstPort,
+				0,
+				0,
+				d.audioBitRate,
+				0,
+				0,
+				webrtc.AudioCodecOpus,
+			)
+			if err != nil {
+				return err
+			}
+			d.mga = &mga
+
+			d.mga.OnData = func(b []byte) {
+				wrtc.WriteAudioTrackRtp(b)
+			}
+
+			return d.mga.Open()
+		}
+	default:
+		return fmt.Errorf("unknown audio source %d", d.audioSource)
+	}
+}
+
+func (d *Device) audioStop() {
+	if d.ma != nil {
+		d.ma.Close()
+		d.ma = nil
+	} else if d.mga != nil {
+		d.mga.Close()
+		d.mga = nil
+	}
+}
@@ -0,0 +1,157 @@
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	WEBRTC "github.com/pion/webrtc/v4"
+
+	"device-go/src/packages/clipboard"
+	"device-go/src/packages/snapshot"
+)
+
+const (
+	ClipboardActionPaste = "paste"
+	ClipboardActionCopy  = "copy"
+)
+
+const (
+	ClipboardViaHid   = "hid"
+	ClipboardViaAgent = "agent"
+	ClipboardViaOcr   = "ocr"
+)
+
+// clipboard data channel of the session, requests are json of `DeviceMessageClipboard`
+func (d *Device) useClipboardDataChannel(dc *WEBRTC.DataChannel) {
+	dc.OnOpen(func() {
+		log.Println("data channel clipboard open", *dc.ID())
+
+		// paste types by hid, it may be opened by hid data channel
+		d.hid.Open()
+	})
+
+	dc.OnMessage(func(dcmsg WEBRTC.DataChannelMessage) {
+		d.sessionActive()
+
+		req := DeviceMessageClipboard{}
+		err := json.Unmarshal(dcmsg.Data, &req)
+		if err != nil {
+			log.Println("device clipboard request unmarshal error", err)
+			d.sendDataChannelMessage(dc, NewDeviceMessage(Error))
+			return
+		}
+
+		res, err := d.handleClipboard(context.Background(), &req)
+		if err != nil {
+			log.Println("device clipboard error", req.Action, req.Via, err)
+			d.sendDataChannelMessage(dc, NewDeviceMessage(Error))
+			return
+		}
+
+		m := NewDeviceMessage(Clipboard)
+		m.Clipboard = res
+		d.sendDataChannelMessage(dc, m)
+	})
+}
+
+func (d *Device) handleClipboard(ctx context.Context, req *DeviceMessageClipboard) (*DeviceMessageClipboard, error) {
+	switch req.Action {
+	case ClipboardActionPaste:
+		return d.clipboardPaste(ctx, req)
+	case ClipboardActionCopy:
+		return d.clipboardCopy(ctx, req)
+	default:
+		return nil, fmt.Errorf("device clipboard unknown action %s", req.Action)
+	}
+}
+
+// paste text of the browser to the target, agent by default if it exists, hid otherwise
+func (d *Device) clipboardPaste(ctx context.Context, req *DeviceMessageClipboard) (*DeviceMessageClipboard, error) {
+	if len(req.Text) > clipboard.MaxTextSize {
+		return nil, fmt.Errorf("device clipboard text too large")
+	}
+
+	via := req.Via
+	if via == "" && d.clipboardAgent != nil {
+		via = ClipboardViaAgent
+	} else if via == "" {
+		via = ClipboardViaHid
+	}
+
+	res := &DeviceMessageClipboard{Action: req.Action, Via: via}
+
+	switch via {
+	case ClipboardViaAgent:
+		if d.clipboardAgent == nil {
+			return nil, fmt.Errorf("device clipboard null agent")
+		}
+
+		return res, d.clipboardAgent.Write(ctx, req.Text)
+	case ClipboardViaHid:
+		typed, err := d.hid.Type(req.Text)
+		res.Typed = typed
+
+		return res, err
+	default:
+		return nil, fmt.Errorf("device clipboard unknown paste via %s", via)
+	}
+}
+
+// copy text of the target to the browser, agent by default if it exists, ocr otherwise
+func (d *Device) clipboardCopy(ctx context.Context, req *DeviceMessageClipboard) (*DeviceMessageClipboard, error) {
+	via := req.Via
+	if via == "" && d.clipboardAgent != nil {
+		via = ClipboardViaAgent
+	} else if via == "" {
+		via = ClipboardViaOcr
+	}
+
+	res := &DeviceMessageClipboard{Action: req.Action, Via: via}
+
+	var err error
+	switch via {
+	case ClipboardViaAgent:
+		if d.clipboardAgent == nil {
+			return nil, fmt.Errorf("device clipboard null agent")
+		}
+
+		res.Text, err = d.clipboardAgent.Read(ctx)
+	case ClipboardViaOcr:
+		res.Text, err = d.recognizeText(ctx, req)
+	default:
+		return nil, fmt.Errorf("device clipboard unknown copy via %s", via)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// text of a region of the target screen, privacy masks are applied before recognition
+func (d *Device) recognizeText(ctx context.Context, req *DeviceMessageClipboard) (string, error) {
+	if d.ocr == nil {
+		return "", fmt.Errorf("device clipboard null ocr")
+	}
+
+	f, err := d.snapshot.NextProcessed()
+	if err != nil {
+		return "", err
+	}
+
+	if req.Width > 0 && req.Height > 0 {
+		f, err = f.Crop(req.X, req.Y, req.Width, req.Height)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	img, err := snapshot.Encode(f, 0, 0, snapshot.SnapshotFormatPng)
+	if err != nil {
+		return "", err
+	}
+
+	return d.ocr.Recognize(ctx, img)
+}
@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"os"
 	"time"
+
+	"device-go/src/libs/frame"
+	"device-go/src/packages/gstreamer"
+	"device-go/src/packages/screen"
 )
 
 type Config struct {
@@ -15,6 +19,32 @@ type Config struct {
 	RefreshTokenExpiresAt time.Time `json:"refreshTokenExpiresAt"`
 
 	WakeOnLanMac string `json:"wakeOnLanMac"`
+
+	// bearer token of local http api
+	LocalApiToken string `json:"localApiToken"`
+
+	// hmac key of session grants, provisioned by mqtt, sessions are view only if empty
+	GrantKey []byte `json:"grantKey,omitempty"`
+
+	// digest auth credentials of rtsp server
+	RtspUsername string `json:"rtspUsername,omitempty"`
+	RtspPassword string `json:"rtspPassword,omitempty"`
+
+	// gstreamer pipeline profile, builtin `rockchip-mpp`, `x264`, `rpi`, or a custom one
+	GstreamerProfile string `json:"gstreamerProfile,omitempty"`
+	// custom gstreamer profiles, name to codec pipeline templates
+	GstreamerProfiles map[string]gstreamer.GstreamerProfile `json:"gstreamerProfiles,omitempty"`
+
+	// privacy masks and text overlay, applied to frames before encoding
+	FrameMasks   []frame.Mask   `json:"frameMasks,omitempty"`
+	FrameOverlay *frame.Overlay `json:"frameOverlay,omitempty"`
+
+	// screen change and idle detection, disabled if empty
+	Screen *screen.ScreenConfig `json:"screen,omitempty"`
+
+	// edid of capture input, builtin preset `1080p60`, `720p60`, `4k-disabled`, or a custom blob
+	EdidPreset string `json:"edidPreset,omitempty"`
+	EdidData   []byte `json:"edidData,omitempty"`
 }
 
 type ConfigFile struct {
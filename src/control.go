@@ -0,0 +1,202 @@
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	WEBRTC "github.com/pion/webrtc/v4"
+
+	"device-go/src/libs/rpc"
+	"device-go/src/packages/hid"
+	"device-go/src/packages/power"
+)
+
+// status of control
+type ControlStatus struct {
+	Version   string                `json:"version"`
+	Mqtt      bool                  `json:"mqtt"`
+	Hid       bool                  `json:"hid"`
+	Video     bool                  `json:"video"`
+	Codec     string                `json:"codec,omitempty"`
+	Quality   *DeviceMessageQuality `json:"quality,omitempty"`
+	Recording bool                  `json:"recording"`
+}
+
+// remaining seconds before session limits, zero of a disabled limit
+type ControlSession struct {
+	IdleRemaining     uint `json:"idleRemaining"`
+	DurationRemaining uint `json:"durationRemaining"`
+}
+
+type ControlPowerParams struct {
+	Action string `json:"action"`
+}
+
+type ControlMacroParams struct {
+	Steps []hid.HidMacroStep `json:"steps"`
+}
+
+// control data channel of the session, json rpc requests, and events of the session as notifications
+//
+// requests are handled concurrently, a macro does not block others, it is cancelled when the channel closes
+func (d *Device) useControlDataChannel(dc *WEBRTC.DataChannel) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := d.newControlServer(ctx)
+
+	dc.OnOpen(func() {
+		log.Println("data channel control open", *dc.ID())
+
+		// macros use hid, it may be opened by hid data channel
+		d.hid.Open()
+
+		d.controlMu.Lock()
+		d.controlDc = dc
+		d.controlMu.Unlock()
+	})
+
+	dc.OnClose(func() {
+		cancel()
+
+		d.controlMu.Lock()
+		if d.controlDc == dc {
+			d.controlDc = nil
+		}
+		d.controlMu.Unlock()
+	})
+
+	dc.OnMessage(func(dcmsg WEBRTC.DataChannelMessage) {
+		d.sessionActive()
+
+		go func() {
+			res := s.Serve(dcmsg.Data)
+			if res == nil {
+				return
+			}
+
+			err := dc.SendText(string(res))
+			if err != nil {
+				log.Println("device control send error", err)
+			}
+		}()
+	})
+}
+
+// notification of an event, the method is the message type
+func (d *Device) sendControlNotification(m DeviceMessage) {
+	d.controlMu.Lock()
+	dc := d.controlDc
+	d.controlMu.Unlock()
+
+	if dc == nil {
+		return
+	}
+
+	b, err := rpc.MarshalNotification(m.Type, m)
+	if err != nil {
+		log.Println("device control notification marshal error", err)
+		return
+	}
+
+	err = dc.SendText(string(b))
+	if err != nil {
+		log.Println("device control send error", err)
+	}
+}
+
+func (d *Device) newControlServer(ctx context.Context) rpc.Server {
+	s := rpc.NewServer()
+	// a method must have its role, it is not found otherwise
+	handle := func(method string, handler rpc.Handler) {
+		required, ok := controlMethodRoles[method]
+		if !ok {
+			log.Println("device control method without role", method)
+			return
+		}
+
+		s.Handle(method, d.withControlRole(required, handler))
+	}
+
+	handle("status.get", func(params json.RawMessage) (any, error) {
+		return d.controlStatus(), nil
+	})
+
+	// viewer is watching, eg. the tab is visible, a request is activity itself
+	handle("session.keepalive", func(params json.RawMessage) (any, error) {
+		idle, duration := d.sessionRemaining()
+
+		return ControlSession{
+			IdleRemaining:     uint(idle / time.Second),
+			DurationRemaining: uint(duration / time.Second),
+		}, nil
+	})
+
+	handle("wol.send", func(params json.RawMessage) (any, error) {
+		if d.cf.Config.WakeOnLanMac == "" {
+			return nil, rpc.NewError(rpc.ErrorCodeUnavailable, "wake on lan mac is empty")
+		}
+
+		return nil, d.sendWOL()
+	})
+
+	handle("quality.set", func(params json.RawMessage) (any, error) {
+		q := DeviceMessageQuality{}
+		err := rpc.UnmarshalParams(params, &q)
+		if err != nil {
+			return nil, err
+		}
+
+		return d.wrtcSetQuality(&q)
+	})
+
+	handle("power.action", func(params json.RawMessage) (any, error) {
+		p := ControlPowerParams{}
+		err := rpc.UnmarshalParams(params, &p)
+		if err != nil {
+			return nil, err
+		} else if !power.ValidAction(p.Action) {
+			return nil, rpc.NewError(rpc.ErrorCodeInvalidParams, "unknown power action %s", p.Action)
+		} else if d.power == nil {
+			return nil, rpc.NewError(rpc.ErrorCodeUnavailable, "power control is not configured")
+		}
+
+		log.Println("device control power action", p.Action)
+		return nil, d.power.Action(ctx, p.Action)
+	})
+
+	handle("macro.run", func(params json.RawMessage) (any, error) {
+		p := ControlMacroParams{}
+		err := rpc.UnmarshalParams(params, &p)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, d.hid.RunMacro(ctx, p.Steps)
+	})
+
+	return s
+}
+
+func (d *Device) controlStatus() ControlStatus {
+	s := ControlStatus{
+		Version: Version,
+		Mqtt:    d.cloudReachable(),
+		Hid:     d.hid.ReadStatus(),
+		Video:   d.vm.IsConnected,
+	}
+
+	d.recordMu.Lock()
+	s.Recording = d.recording
+	d.recordMu.Unlock()
+
+	d.mediaMu.Lock()
+	if d.mediaRunning() {
+		q := d.mediaQuality
+		s.Codec = d.mediaCodec
+		s.Quality = &q
+	}
+	d.mediaMu.Unlock()
+
+	return s
+}
@@ -2,32 +2,55 @@ package src
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	WEBRTC "github.com/pion/webrtc/v4"
 
 	"device-go/src/apis"
+	"device-go/src/libs/frame"
+	"device-go/src/libs/grant"
+	"device-go/src/libs/h264"
+	"device-go/src/libs/hls"
+	"device-go/src/libs/rtsp"
+	"device-go/src/libs/server"
 	"device-go/src/libs/webrtc"
 	"device-go/src/libs/websocket"
+	"device-go/src/packages/audio"
+	"device-go/src/packages/clipboard"
 	"device-go/src/packages/front"
 	"device-go/src/packages/gstreamer"
 	"device-go/src/packages/hid"
 	"device-go/src/packages/mqtt"
+	"device-go/src/packages/power"
+	"device-go/src/packages/recorder"
+	"device-go/src/packages/screen"
+	"device-go/src/packages/snapshot"
+	"device-go/src/packages/synthetic"
+	"device-go/src/packages/uac"
 	"device-go/src/packages/video"
 	"device-go/src/packages/wake_on_lan"
 )
 
+// capture size and frame rate
 const videoWidth uint = 1920
 const videoHeight uint = 1080
-const bitRate uint = 10 * 1024
-const gop uint = 60
+const videoFps uint = 30
+
+// snapshot cache time to live
+const snapshotTTL = time.Second
+
+// data channel message size limit is 16KB on some browsers
+const dataChannelChunkSize = 16 * 1024
 
 const DeviceMediaSourceVideo uint = 1
 const DeviceMediaSourceGst uint = 2
+const DeviceMediaSourceSynthetic uint = 3
 
 type Device struct {
 	cancel context.CancelFunc
@@ -39,24 +62,148 @@ type Device struct {
 	api        apis.ServeApi
 	mqttUrl    string
 	mqtt       *mqtt.Mqtt
+	mqttCancel context.CancelFunc
 	responseWs *websocket.WebSocket
-
-	// webrtc
-	wrtc *webrtc.WebRTC
+	// signaling of local api, see `handleLocalSignal`
+	responseWsLocal bool
+	localSignal     string
+	// mqtt is set by the retry, websocket by local api handlers
+	signalMu sync.Mutex
+
+	// local api
+	localApiAddr string
+	local        server.Server
+
+	// rtsp server
+	rtspAddr       string
+	rtspMaxClients int
+	rtsp           *rtsp.Server
+
+	// whep of local api
+	whepMaxSessions int
+	whepSessions    map[string]*webrtc.WebRTC
+	whepMu          sync.Mutex
+	// slots of whep sessions in setup, see `whepReserve`
+	whepReserved int
+
+	// hls of local api
+	hls      *hls.Muxer
+	hlsTimer *time.Timer
+	hlsMu    sync.Mutex
+
+	// webrtc, it is replaced by signaling and closed by the peer, see `useWrtc`
+	wrtc   *webrtc.WebRTC
+	wrtcMu sync.Mutex
+	// session enables audio and microphone
+	wrtcAudio      bool
+	wrtcMicrophone bool
+	wrtcQuality    DeviceMessageQuality
+	// role of the session grant, see `useRole`
+	wrtcRole string
+	// grant key of config is provisioned by mqtt, see `setGrantKey`
+	grantMu sync.Mutex
+	// grace of a disconnected peer
+	wrtcDisconnectTimeout time.Duration
+	// limits of the session, see `sessionStart`
+	sessionIdleTimeout time.Duration
+	sessionMaxDuration time.Duration
+	sessionStarted     time.Time
+	sessionActivity    atomic.Int64
+	sessionCancel      context.CancelFunc
+	// connection quality of sessions
+	wrtcStats wrtcStats
+	// events of the session
+	eventsDc *WEBRTC.DataChannel
+	eventsMu sync.Mutex
+	// control of the session, events are notifications too
+	controlDc *WEBRTC.DataChannel
+	controlMu sync.Mutex
 
 	// device resources
 	mediaSource     uint
 	videoPath       string
 	videoBinPath    string
 	videoSocketPath string
+	videoCodecs     []string
 	mv              *video.Video
 	mg              *gstreamer.Gstreamer
+	gstProfile      gstreamer.GstreamerProfile
+	ms              *synthetic.Synthetic
+	syntheticPath   string
+	frameChain      frame.Chain
+	rawBinPath      string
+	rawSocketPath   string
+	mr              *video.VideoRaw
+	rawEncoder      *gstreamer.Gstreamer
+	rawChain        frame.Chain
+	rawMu           sync.Mutex
+	snapshotOpened  bool
+	snapshotDecode  atomic.Bool
+	snapshotBusy    atomic.Bool
+	mediaMu         sync.Mutex
+	mediaCodec      string
+	mediaQuality    DeviceMessageQuality
+	mediaSinks      map[string]mediaSink
+	mediaSinksMu    sync.RWMutex
+	videoParams     h264.ParameterSets
+	videoStats      h264.Stats
+	videoRtp        h264.Depacketizer
+	recordPath      string
+	record          recorder.Recorder
+	recording       bool
+	// recording and quality of the session, record start and stop are serialized with media restarts
+	recordMu        sync.Mutex
+	audioSource     uint
+	audioHardware   string
+	audioBinPath    string
+	audioSocketPath string
+	audioBitRate    uint
+	ma              *audio.Audio
+	mga             *gstreamer.Gstreamer
+	micSink         uint
+	micHardware     string
+	micBinPath      string
+	micSocketPath   string
+	mic             *uac.Uac
+	micMu           sync.Mutex
 	vm              video.VideoMonitor
+	edidPath        string
 	hid             hid.HidController
+	clipboardAgent  *clipboard.Agent
+	ocr             *clipboard.Ocr
+	power           *power.Power
 	front           front.Front
+	snapshot        snapshot.Snapshot
+	screen          *screen.Screen
+	screenCancel    context.CancelFunc
 }
 
 func NewDevice(args Args) Device {
+	videoCodecs, err := webrtc.ParseVideoCodecs(args.VideoCodecs)
+	if err != nil {
+		log.Println("device parse video codecs error", err)
+		videoCodecs = []string{webrtc.VideoCodecH264}
+	}
+
+	// clipboard of target, both are optional
+	var clipboardAgent *clipboard.Agent
+	if args.ClipboardAgentUrl != "" {
+		a := clipboard.NewAgent(args.ClipboardAgentUrl, args.ClipboardAgentToken)
+		clipboardAgent = &a
+	}
+	var ocr *clipboard.Ocr
+	if args.OcrBinPath != "" {
+		o := clipboard.NewOcr(args.OcrBinPath, args.OcrLang)
+		ocr = &o
+	}
+
+	// optional power control of target
+	var pw *power.Power
+	if args.PowerBinPath != "" {
+		p := power.NewPower(args.PowerBinPath)
+		pw = &p
+	}
+
 	return Device{
 		cf: ConfigFile{
 			path: args.ConfigPath,
@@ -66,15 +213,63 @@ func NewDevice(args Args) Device {
 		api:     apis.NewServeApi(args.ServeUrl, args.ServeClientId),
 		mqttUrl: args.MqttUrl,
 
+		localSignal: args.LocalSignal,
+
+		// local api
+		localApiAddr: args.LocalApiAddr,
+		local:        server.NewServer(args.LocalApiAddr),
+
+		// rtsp server
+		rtspAddr:       args.RtspAddr,
+		rtspMaxClients: int(args.RtspMaxClients),
+
+		// whep
+		whepMaxSessions: int(args.WhepMaxSessions),
+		whepSessions:    map[string]*webrtc.WebRTC{},
+
+		// webrtc
+		wrtcDisconnectTimeout: args.WebRTCDisconnectTimeout,
+		sessionIdleTimeout:    args.SessionIdleTimeout,
+		sessionMaxDuration:    args.SessionMaxDuration,
+
 		// device resources
 		mediaSource:     args.MediaSource,
 		videoPath:       args.VideoPath,
 		videoBinPath:    args.VideoBinPath,
 		videoSocketPath: args.VideoSocketPath,
+		videoCodecs:     videoCodecs,
+		mediaQuality:    defaultQuality(),
+		mediaSinks:      map[string]mediaSink{},
+		syntheticPath:   args.SyntheticPath,
+		rawBinPath:      args.RawBinPath,
+		rawSocketPath:   args.RawSocketPath,
+		recordPath:      args.RecordPath,
+		audioSource:     args.AudioSource,
+		audioHardware:   args.AudioHardware,
+		audioBinPath:    args.AudioBinPath,
+		audioSocketPath: args.AudioSocketPath,
+		audioBitRate:    args.AudioBitRate,
+		micSink:         args.MicSink,
+		micHardware:     args.MicHardware,
+		micBinPath:      args.MicBinPath,
+		micSocketPath:   args.MicSocketPath,
+		edidPath:        args.EdidPath,
+		record: recorder.NewRecorder(
+			args.RecordPath,
+			videoWidth,
+			videoHeight,
+			int64(args.RecordMaxFileSize)*1024*1024,
+			args.RecordMaxFileDuration,
+			args.RecordRetention,
+			int64(args.RecordMaxTotalSize)*1024*1024,
+		),
 		hid: hid.NewHidController(
 			args.HidPath,
 			args.HidUdcPath,
 		),
+		clipboardAgent: clipboardAgent,
+		ocr:            ocr,
+		power:          pw,
 		vm: video.NewVideoMonitor(
 			args.VideoMonitorPath,
 			args.VideoMonitorBinPath,
@@ -85,58 +280,113 @@ func NewDevice(args Args) Device {
 			args.FrontSocketPath,
 			Version,
 		),
+		snapshot: snapshot.NewSnapshot(snapshotTTL),
 	}
 }
 
 // webrtc start
 func (d *Device) wrtcStart(msg DeviceMessage) error {
-	if d.wrtc != nil {
+	if d.useWrtc() != nil {
 		return fmt.Errorf("device webrtc exists")
 	}
 
+	role, err := d.useRole(msg)
+	if err != nil {
+		return err
+	} else if msg.Microphone && !grant.RoleAllows(role, grant.RoleControl) {
+		return newDeviceError(DeviceErrorPermissionDenied, "role %s requires %s for microphone", role, grant.RoleControl)
+	}
+
+	quality, err := d.useQuality(msg.Quality)
+	if err != nil {
+		return err
+	}
+
 	// create webrtc
-	wrtc := webrtc.WebRTC{
-		OnIceCandidate: d.sendIceCandidate,
-		OnDataChannel:  d.useDataChannel,
-		OnClose: func() {
-			log.Println("device webrtc close")
-			d.wsStop()
-			d.mediaStop()
-			d.hid.Close()
+	wrtc := &webrtc.WebRTC{
+		DisconnectTimeout: d.wrtcDisconnectTimeout,
+		OnIceCandidates:   d.sendIceCandidates,
+		OnDataChannel:     d.useDataChannel,
+		OnTrack:           d.useTrack,
+		OnIceRestart:      d.sendIceRestart,
+		StatsInterval:     wrtcStatsInterval,
+		OnStats:           d.sendWebRTCStats,
+	}
+	wrtc.OnClose = func() {
+		log.Println("device webrtc close")
+		d.sessionStop()
+		if summary := d.wrtcStats.close(); summary != nil {
+			d.sendWebRTCStatsSummary(summary)
+		}
+		d.wsStop()
+		d.wrtcMediaStop()
+		d.hid.Close()
+
+		// a new session may have replaced it
+		d.wrtcMu.Lock()
+		if d.wrtc == wrtc {
 			d.wrtc = nil
-		},
+		}
+		d.wrtcMu.Unlock()
 	}
-	d.wrtc = &wrtc
+
+	d.wrtcMu.Lock()
+	d.wrtc = wrtc
+	d.wrtcMu.Unlock()
+	d.wrtcStats.open()
+	d.sessionStart()
+	d.wrtcAudio = msg.Audio
+	d.wrtcMicrophone = msg.Microphone
+	d.wrtcRole = role
+
+	d.recordMu.Lock()
+	d.wrtcQuality = quality
+	d.recordMu.Unlock()
 
 	// use ice servers
 	iss := make([]WEBRTC.ICEServer, len(msg.IceServers))
 	for i, v := range msg.IceServers {
 		iss[i] = v.ToWebrtcIceServer()
 	}
-
-	// open wrtc
-	err := wrtc.Open(iss)
-	if err != nil {
-		return err
+	// lan session of local signaling, ice servers are unreachable, host candidates only
+	if d.signalLocal() {
+		iss = nil
 	}
 
-	// media start
-	return d.mediaStart()
+	// open wrtc
+	// media will start on offer, after the codec is negotiated
+	return wrtc.Open(iss)
 }
 
 // webrt stop
 func (d *Device) wrtcStop() error {
-	if d.wrtc == nil {
+	d.wrtcMu.Lock()
+	wrtc := d.wrtc
+	d.wrtc = nil
+	d.wrtcMu.Unlock()
+
+	if wrtc == nil {
 		return fmt.Errorf("device null webrtc")
 	}
 
-	d.wrtc.Close()
-	d.wrtc = nil
+	wrtc.Close()
 
 	return nil
 }
 
+// session of signaling, the session timer and mqtt requests end it too
+func (d *Device) useWrtc() *webrtc.WebRTC {
+	d.wrtcMu.Lock()
+	defer d.wrtcMu.Unlock()
+
+	return d.wrtc
+}
+
 func (d *Device) useDataChannel(dc *WEBRTC.DataChannel) bool {
+	if !d.allowDataChannel(dc) {
+		return false
+	}
+
 	switch dc.Label() {
 	case "hid":
 		{
@@ -147,9 +397,41 @@ func (d *Device) useDataChannel(dc *WEBRTC.DataChannel) bool {
 			})
 
 			dc.OnMessage(func(dcmsg WEBRTC.DataChannelMessage) {
+				d.sessionActive()
 				d.hid.Send(dcmsg.Data)
 			})
 
+			return true
+		}
+	case "events":
+		{
+			d.useEventsDataChannel(dc)
+
+			return true
+		}
+	case "control":
+		{
+			d.useControlDataChannel(dc)
+
+			return true
+		}
+	case "clipboard":
+		{
+			d.useClipboardDataChannel(dc)
+
+			return true
+		}
+	case "snapshot":
+		{
+			dc.OnOpen(func() {
+				log.Println("data channel snapshot open", *dc.ID())
+			})
+
+			dc.OnMessage(func(dcmsg WEBRTC.DataChannelMessage) {
+				d.sessionActive()
+				d.sendSnapshot(dc, dcmsg.Data)
+			})
+
 			return true
 		}
 	default:
@@ -161,100 +443,126 @@ func (d *Device) useDataChannel(dc *WEBRTC.DataChannel) bool {
 	}
 }
 
-func (d *Device) sendIceCandidate(candidate *WEBRTC.ICECandidateInit) {
-	m := NewDeviceMessage(WebRTCIceCandidate)
-	m.IceCandidate = candidate
+// capture snapshot
+func (d *Device) captureSnapshot(req *DeviceMessageSnapshot) (*DeviceMessageSnapshot, error) {
+	if req == nil {
+		req = &DeviceMessageSnapshot{}
+	}
 
-	err := d.wsSend(m)
+	format := req.Format
+	if format == "" {
+		format = snapshot.SnapshotFormatJpeg
+	}
 
+	data, err := d.snapshot.Capture(req.Width, req.Height, format)
 	if err != nil {
-		log.Println("device send ice cadidate error", err)
+		return nil, err
 	}
+
+	return &DeviceMessageSnapshot{
+		Width:  req.Width,
+		Height: req.Height,
+		Format: format,
+		Size:   len(data),
+		Data:   data,
+	}, nil
 }
 
-// media start
-func (d *Device) mediaStart() error {
-	if d.wrtc == nil {
-		return fmt.Errorf("device null webrtc")
+// send snapshot through data channel, a json message first, then binary chunks
+func (d *Device) sendSnapshot(dc *WEBRTC.DataChannel, msg []byte) {
+	req := DeviceMessageSnapshot{}
+	err := json.Unmarshal(msg, &req)
+	if err != nil {
+		log.Println("device snapshot request unmarshal error", err)
+		d.sendDataChannelMessage(dc, NewDeviceMessage(Error))
+		return
 	}
 
-	switch d.mediaSource {
-	case DeviceMediaSourceVideo:
-		{
-			if d.mv != nil {
-				return fmt.Errorf("device mv exists")
-			}
+	res, err := d.captureSnapshot(&req)
+	if err != nil {
+		log.Println("device snapshot capture error", err)
+		d.sendDataChannelMessage(dc, NewDeviceMessage(Error))
+		return
+	}
 
-			mv := video.NewVideo(
-				d.videoPath,
-				d.videoBinPath,
-				d.videoSocketPath,
-				videoWidth,
-				videoHeight,
-				bitRate,
-				gop,
-			)
-			d.mv = &mv
-
-			// use video
-			d.wrtc.AddVideoTrackSample(WEBRTC.RTPCodecCapability{MimeType: WEBRTC.MimeTypeH264})
-
-			// set callback
-			d.mv.OnData = func(id uint32, timestamp uint64, frame []byte) {
-				d.wrtc.WriteVideoTrackSample(frame, timestamp)
-			}
+	data := res.Data
+	res.Data = nil
+
+	m := NewDeviceMessage(SnapshotCapture)
+	m.Snapshot = res
+	err = d.sendDataChannelMessage(dc, m)
+	if err != nil {
+		return
+	}
 
-			d.mv.Open()
-			break
+	for i := 0; i < len(data); i += dataChannelChunkSize {
+		err = dc.Send(data[i:min(i+dataChannelChunkSize, len(data))])
+		if err != nil {
+			log.Println("device snapshot send error", err)
+			return
 		}
-	case DeviceMediaSourceGst:
-		{
-			if d.mg != nil {
-				return fmt.Errorf("device mg exists")
-			}
+	}
+}
 
-			mg := gstreamer.NewGstreamer(
-				d.videoPath,
-				"localhost",
-				10000,
-				videoWidth,
-				videoHeight,
-				bitRate,
-				gop,
-			)
-			d.mg = &mg
-
-			// use video
-			d.wrtc.AddVideoTrackRtp(WEBRTC.RTPCodecCapability{MimeType: WEBRTC.MimeTypeH264})
-
-			d.mg.OnData = func(frame []byte) {
-				d.wrtc.WriteVideoTrackRtp(frame)
-			}
+func (d *Device) sendDataChannelMessage(dc *WEBRTC.DataChannel, m DeviceMessage) error {
+	j, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
 
-			d.mg.Open()
-			break
-		}
-	default:
-		return fmt.Errorf("unknown media source %d", d.mediaSource)
+	err = dc.SendText(string(j))
+	if err != nil {
+		log.Println("device data channel send error", dc.Label(), err)
 	}
 
-	return nil
+	return err
+}
+
+// send a batch of local candidates
+func (d *Device) sendIceCandidates(candidates []WEBRTC.ICECandidateInit, done bool) {
+	m := NewDeviceMessage(WebRTCIceCandidate)
+	m.IceCandidates = candidates
+	m.IceCandidatesDone = done
+
+	err := d.wsSend(m)
+
+	if err != nil {
+		log.Println("device send ice cadidate error", err)
+	}
 }
 
-// media stop
-func (d *Device) mediaStop() {
-	if d.mv != nil {
-		d.mv.Close()
-		d.mv = nil
-	} else if d.mg != nil {
-		d.mg.Close()
-		d.mg = nil
+// ice restart offer of device, when the peer fails, the client answers it by webrtc answer
+func (d *Device) sendIceRestart(offer *WEBRTC.SessionDescription) {
+	m := NewDeviceMessage(WebRTCIceRestart)
+	m.Offer = offer
+
+	err := d.wsSend(m)
+
+	if err != nil {
+		log.Println("device send ice restart error", err)
 	}
 }
 
+// use offer, negotiate video codec and start media at the first offer
+func (d *Device) useOffer(offer *WEBRTC.SessionDescription) (*WEBRTC.SessionDescription, error) {
+	wrtc := d.useWrtc()
+	if wrtc == nil {
+		return nil, fmt.Errorf("device null webrtc")
+	} else if offer == nil {
+		return nil, fmt.Errorf("device null offer")
+	}
+
+	err := d.wrtcMediaStart(wrtc, offer)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrtc.UseOffer(offer)
+}
+
 // websocket start
 func (d *Device) wsStart() error {
-	if d.responseWs != nil {
+	if ws, _ := d.useResponseWs(); ws != nil {
 		return fmt.Errorf("device websocket exists")
 	}
 
@@ -277,6 +585,14 @@ func (d *Device) wsStart() error {
 	// send first message
 	ws.Send(NewDeviceMessage(""))
 
+	d.signalMu.Lock()
+	defer d.signalMu.Unlock()
+
+	// local signaling started meanwhile
+	if d.responseWs != nil {
+		ws.Close()
+		return fmt.Errorf("device websocket exists")
+	}
 	d.responseWs = ws
 
 	return nil
@@ -284,23 +600,50 @@ func (d *Device) wsStart() error {
 
 // websocket stop
 func (d *Device) wsStop() error {
-	if d.responseWs == nil {
+	d.signalMu.Lock()
+	ws := d.responseWs
+	d.responseWs = nil
+	d.responseWsLocal = false
+	d.signalMu.Unlock()
+
+	if ws == nil {
 		return fmt.Errorf("device null websocket")
 	}
 
-	d.responseWs.Close()
-	d.responseWs = nil
+	ws.Close()
 
 	return nil
 }
 
 // websocket send data
 func (d *Device) wsSend(m any) error {
-	if d.responseWs == nil {
+	ws, _ := d.useResponseWs()
+	if ws == nil {
 		return fmt.Errorf("device null websocket")
 	}
 
-	return d.responseWs.Send(m)
+	return ws.Send(m)
+}
+
+// websocket of signaling, and whether it is of local api
+func (d *Device) useResponseWs() (*websocket.WebSocket, bool) {
+	d.signalMu.Lock()
+	defer d.signalMu.Unlock()
+
+	return d.responseWs, d.responseWsLocal
+}
+
+// signaling is of local api
+func (d *Device) signalLocal() bool {
+	_, local := d.useResponseWs()
+	return local
+}
+
+func (d *Device) useMqtt() *mqtt.Mqtt {
+	d.signalMu.Lock()
+	defer d.signalMu.Unlock()
+
+	return d.mqtt
 }
 
 // send status to front
@@ -316,8 +659,8 @@ func (d *Device) sendStatus() {
 	// )
 
 	mqttIsConnected := false
-	if d.mqtt != nil {
-		mqttIsConnected = d.mqtt.IsConnected()
+	if m := d.useMqtt(); m != nil {
+		mqttIsConnected = m.IsConnected()
 	}
 
 	log.Println("status", mqttIsConnected, d.vm.IsConnected, d.hid.ReadStatus())
@@ -359,6 +702,58 @@ func (d *Device) handleMqttMessage(msg []byte) DeviceMessage {
 			}
 			return NewDeviceMessage(WebSocketStop)
 		}
+	case SnapshotCapture:
+		{
+			res, err := d.captureSnapshot(m.Snapshot)
+			if err != nil {
+				log.Println("device snapshot capture error", err)
+				return NewDeviceMessage(Error)
+			}
+
+			mm := NewDeviceMessage(SnapshotCapture)
+			mm.Snapshot = res
+			return mm
+		}
+	case SessionKick:
+		{
+			reason := SessionReasonKick
+			if m.Session != nil && m.Session.Reason != "" {
+				reason = m.Session.Reason
+			}
+
+			err = d.sessionEnd(reason)
+			if err != nil {
+				log.Println("device session kick error", err)
+				return NewDeviceMessage(Error)
+			}
+			return NewDeviceMessage(SessionKick)
+		}
+	case GrantKeySet:
+		{
+			err = d.setGrantKey(m.GrantKey)
+			if err != nil {
+				log.Println("device grant key error", err)
+				return NewDeviceMessage(Error)
+			}
+			return NewDeviceMessage(GrantKeySet)
+		}
+	case EdidGet, EdidSet:
+		{
+			var res *DeviceMessageEdid
+			if m.Type == EdidGet {
+				res, err = d.getEdid()
+			} else {
+				res, err = d.setEdid(m.Edid)
+			}
+			if err != nil {
+				log.Println("device edid error", m.Type, err)
+				return NewDeviceMessage(Error)
+			}
+
+			mm := NewDeviceMessage(m.Type)
+			mm.Edid = res
+			return mm
+		}
 	case Error, "":
 		{
 			return NewDeviceMessage("")
@@ -386,7 +781,7 @@ func (d *Device) handleWsMessage(msg []byte) DeviceMessage {
 			err = d.wrtcStart(m)
 			if err != nil {
 				log.Println("device wrtc start error", err)
-				return NewDeviceMessage(Error)
+				return NewDeviceErrorMessage(err)
 			}
 			return NewDeviceMessage(WebRTCStart)
 		}
@@ -399,13 +794,35 @@ func (d *Device) handleWsMessage(msg []byte) DeviceMessage {
 			}
 			return NewDeviceMessage(WebRTCStop)
 		}
+	case WebRTCQuality:
+		{
+			res, err := d.wrtcSetQuality(m.Quality)
+			if err != nil {
+				log.Println("device wrtc quality error", err)
+				return NewDeviceMessage(Error)
+			}
+
+			mm := NewDeviceMessage(WebRTCQuality)
+			mm.Quality = res
+			return mm
+		}
 	case WebRTCIceCandidate:
 		{
-			if d.wrtc == nil {
+			wrtc := d.useWrtc()
+			if wrtc == nil {
 				return NewDeviceMessage(Error)
 			}
 
-			err = d.wrtc.AddIceCandidate(m.IceCandidate)
+			// a single candidate or a batch
+			candidates := m.IceCandidates
+			if m.IceCandidate != nil {
+				candidates = append([]WEBRTC.ICECandidateInit{*m.IceCandidate}, candidates...)
+			}
+			if m.IceCandidatesDone {
+				candidates = append(candidates, WEBRTC.ICECandidateInit{})
+			}
+
+			err = wrtc.AddIceCandidates(candidates)
 			if err != nil {
 				log.Println("device wrtc add ice candidtae error", err)
 				return NewDeviceMessage(Error)
@@ -414,12 +831,12 @@ func (d *Device) handleWsMessage(msg []byte) DeviceMessage {
 		}
 	case WebRTCOffer:
 		{
-			if d.wrtc == nil {
+			if d.useWrtc() == nil {
 				return NewDeviceMessage(Error)
 			}
 
 			mm := NewDeviceMessage(WebRTCAnswer)
-			answer, err := d.wrtc.UseOffer(m.Offer)
+			answer, err := d.useOffer(m.Offer)
 			if err != nil {
 				log.Println("device wrtc use offer error", err)
 				return NewDeviceMessage(Error)
@@ -428,6 +845,38 @@ func (d *Device) handleWsMessage(msg []byte) DeviceMessage {
 			mm.Answer = answer
 			return mm
 		}
+	case WebRTCIceRestart:
+		{
+			wrtc := d.useWrtc()
+			if wrtc == nil {
+				return NewDeviceMessage(Error)
+			}
+
+			// client asks device to offer
+			offer, err := wrtc.RestartIce()
+			if err != nil {
+				log.Println("device wrtc ice restart error", err)
+				return NewDeviceMessage(Error)
+			}
+
+			mm := NewDeviceMessage(WebRTCIceRestart)
+			mm.Offer = offer
+			return mm
+		}
+	case WebRTCAnswer:
+		{
+			wrtc := d.useWrtc()
+			if wrtc == nil || m.Answer == nil {
+				return NewDeviceMessage(Error)
+			}
+
+			err = wrtc.UseAnswer(m.Answer)
+			if err != nil {
+				log.Println("device wrtc use answer error", err)
+				return NewDeviceMessage(Error)
+			}
+			return NewDeviceMessage(WebRTCAnswer)
+		}
 	case Error, "":
 		{
 			return NewDeviceMessage("")
@@ -472,6 +921,20 @@ func (d *Device) Open() {
 		log.Println("device config load error", err)
 	}
 
+	// valid gstreamer profile, fallback to default
+	d.gstProfile, err = gstreamer.UseProfile(d.cf.Config.GstreamerProfile, d.cf.Config.GstreamerProfiles)
+	if err != nil {
+		log.Println("device gstreamer profile error", err)
+		d.gstProfile, _ = gstreamer.UseProfile("", nil)
+	}
+
+	// masks and overlay of frames
+	d.useFrameChain()
+
+	// snapshots share raw capture with frame processors
+	d.snapshot.OnOpen = d.snapshotOpen
+	d.snapshot.OnClose = d.snapshotClose
+
 	// set api auth
 	d.api.SetOAuthToken(
 		d.cf.Config.AccessToken,
@@ -491,30 +954,34 @@ func (d *Device) Open() {
 	}
 
 	// if id exists, use mqtt
-	if d.cf.Config.ID != "" {
-		mqtt := mqtt.NewMqtt(d.cf.Config.ID, d.mqttUrl)
-		mqtt.OnRequest = func(msg []byte) {
-			m := d.handleMqttMessage(msg)
-			d.mqtt.Send(m)
-		}
-		err = mqtt.Open()
-		if err != nil {
-			log.Println("device mqtt open error", err)
-		} else {
-			d.mqtt = &mqtt
-		}
-	}
+	d.mqttStart()
 
 	// err := d.front.Open()
 	// if err != nil {
 	// 	log.Printf("device front open error %v\n", err)
 	// }
 
+	// before video monitor, the target sees a hot plug
+	d.edidStart()
+
 	err = d.vm.Open()
 	if err != nil {
 		log.Println("device video monitor open error", err)
 	}
 
+	// before local api, it serves events
+	d.screenStart()
+
+	err = d.openLocalApi()
+	if err != nil {
+		log.Println("device local api open error", err)
+	}
+
+	err = d.openRtsp()
+	if err != nil {
+		log.Println("device rtsp open error", err)
+	}
+
 	// start
 	// ctx, cancel := context.WithCancel(context.Background())
 	// d.cancel = cancel
@@ -528,17 +995,26 @@ func (d *Device) Close() {
 		d.cancel()
 		d.cancel = nil
 	}
+	d.screenStop()
+	d.mqttStop()
+	d.sessionStop()
 
 	d.wg.Wait()
 
-	if d.mqtt != nil {
-		d.mqtt.Close()
+	if m := d.useMqtt(); m != nil {
+		m.Close()
 	}
 
+	d.closeLocalApi()
+	d.whepClose()
+	d.closeRtsp()
+	d.hlsStop()
+
 	d.wsStop()
-	d.mediaStop()
+	d.mediaClose()
 	d.vm.Close()
 	d.hid.Close()
+	d.snapshot.Close()
 
 	d.wrtcStop()
 }
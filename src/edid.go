@@ -0,0 +1,126 @@
+package src
+
+import (
+	"fmt"
+	"log"
+
+	"device-go/src/libs/edid"
+)
+
+// edid of config, preset first, nil if not set
+func (d *Device) useConfigEdid() ([]byte, error) {
+	if d.cf.Config.EdidPreset != "" {
+		return edid.UsePreset(d.cf.Config.EdidPreset)
+	} else if len(d.cf.Config.EdidData) > 0 {
+		return d.cf.Config.EdidData, nil
+	}
+
+	return nil, nil
+}
+
+// write edid to capture input, skipped if it is not changed, so the target does not see a hot plug
+func (d *Device) writeEdid(b []byte) error {
+	if d.edidPath == "" {
+		return fmt.Errorf("device edid path empty")
+	}
+
+	current, err := edid.Read(d.edidPath)
+	if err == nil && string(current) == string(b) {
+		return nil
+	}
+
+	err = edid.Write(d.edidPath, b)
+	if err != nil {
+		return err
+	}
+
+	e, _ := edid.Parse(b)
+	p, _ := e.Preferred()
+	log.Println("device edid written", d.edidPath, e.Name, p)
+
+	return nil
+}
+
+// apply edid of config at start
+func (d *Device) edidStart() {
+	if d.edidPath == "" {
+		return
+	}
+
+	b, err := d.useConfigEdid()
+	if err != nil {
+		log.Println("device edid config error", err)
+		return
+	} else if b == nil {
+		return
+	}
+
+	err = d.writeEdid(b)
+	if err != nil {
+		log.Println("device edid write error", err)
+	}
+}
+
+// current edid of capture input
+func (d *Device) getEdid() (*DeviceMessageEdid, error) {
+	if d.edidPath == "" {
+		return nil, fmt.Errorf("device edid path empty")
+	}
+
+	b, err := edid.Read(d.edidPath)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &DeviceMessageEdid{
+		Preset:  d.cf.Config.EdidPreset,
+		Presets: edid.Presets(),
+		Data:    b,
+	}
+
+	// edid of input could be empty or invalid, data is still returned
+	e, err := edid.Parse(b)
+	if err != nil {
+		log.Println("device edid parse error", err)
+	} else {
+		res.Info = &e
+	}
+
+	return res, nil
+}
+
+// set edid by preset or data, it is saved to config
+func (d *Device) setEdid(req *DeviceMessageEdid) (*DeviceMessageEdid, error) {
+	if req == nil {
+		return nil, fmt.Errorf("device edid request empty")
+	}
+
+	var b []byte
+	var err error
+	if req.Preset != "" {
+		b, err = edid.UsePreset(req.Preset)
+	} else {
+		b = req.Data
+		_, err = edid.Parse(b)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.writeEdid(b)
+	if err != nil {
+		return nil, err
+	}
+
+	d.cf.Config.EdidPreset = req.Preset
+	d.cf.Config.EdidData = nil
+	if req.Preset == "" {
+		d.cf.Config.EdidData = b
+	}
+	err = d.cf.Save()
+	if err != nil {
+		log.Println("device config save error", err)
+	}
+
+	return d.getEdid()
+}
@@ -0,0 +1,74 @@
+package src
+
+import (
+	"log"
+
+	WEBRTC "github.com/pion/webrtc/v4"
+)
+
+// events data channel of the session, it is opened by the client
+func (d *Device) useEventsDataChannel(dc *WEBRTC.DataChannel) {
+	dc.OnOpen(func() {
+		log.Println("data channel events open", *dc.ID())
+
+		d.eventsMu.Lock()
+		d.eventsDc = dc
+		d.eventsMu.Unlock()
+	})
+
+	dc.OnClose(func() {
+		d.eventsMu.Lock()
+		if d.eventsDc == dc {
+			d.eventsDc = nil
+		}
+		d.eventsMu.Unlock()
+	})
+}
+
+// send event to mqtt and the events data channel
+func (d *Device) sendEvent(m DeviceMessage) {
+	d.sendMqttEvent(m)
+	d.sendSessionEvent(m)
+}
+
+func (d *Device) sendMqttEvent(m DeviceMessage) {
+	mq := d.useMqtt()
+	if mq == nil {
+		return
+	}
+
+	err := mq.SendEvent(m)
+	if err != nil {
+		log.Println("device mqtt send event error", m.Type, err)
+	}
+}
+
+// send event to the events data channel of the session only, and as notification of the control data channel
+func (d *Device) sendSessionEvent(m DeviceMessage) {
+	d.eventsMu.Lock()
+	dc := d.eventsDc
+	d.eventsMu.Unlock()
+
+	if dc != nil {
+		d.sendDataChannelMessage(dc, m)
+	}
+
+	d.sendControlNotification(m)
+}
+
+// video helper or pipeline is restarted by its watchdog
+func (d *Device) sendMediaRestart(reason string, count uint, stderr []string, err error) {
+	r := &DeviceMessageMediaRestart{
+		Reason: reason,
+		Count:  count,
+		Stderr: stderr,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	m := NewDeviceMessage(MediaRestart)
+	m.MediaRestart = r
+
+	d.sendEvent(m)
+}
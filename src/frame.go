@@ -0,0 +1,215 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"device-go/src/libs/frame"
+	"device-go/src/libs/h264"
+	"device-go/src/libs/webrtc"
+	"device-go/src/packages/gstreamer"
+	"device-go/src/packages/video"
+)
+
+// frame processors of config, masks run after the overlay, so a mask always wins
+func (d *Device) useFrameChain() {
+	chain := frame.Chain{}
+
+	if d.cf.Config.FrameOverlay != nil && d.cf.Config.FrameOverlay.Text != "" {
+		chain = append(chain, *d.cf.Config.FrameOverlay)
+	}
+	for _, m := range d.cf.Config.FrameMasks {
+		chain = append(chain, m)
+	}
+
+	d.frameChain = nil
+	if len(chain) > 0 {
+		log.Println("device frame processors", len(chain))
+		d.frameChain = chain
+	}
+
+	d.snapshot.Processor = d.frameChain
+}
+
+// raw capture, one helper on the video device is shared by frame processors and snapshots
+//
+// it runs for media with frame processors, or for snapshots when media does not capture the device,
+// snapshots use key frames of media otherwise
+
+// open raw capture if it is closed, called under media lock
+func (d *Device) rawOpen() error {
+	if d.mr != nil {
+		return nil
+	}
+
+	mr := video.NewVideoRaw(
+		d.videoPath,
+		d.rawBinPath,
+		d.rawSocketPath,
+		videoWidth,
+		videoHeight,
+	)
+	mr.OnFrame = d.writeRawFrame
+	mr.OnRestart = d.sendMediaRestart
+
+	err := mr.Open()
+	if err != nil {
+		return err
+	}
+	d.mr = &mr
+
+	return nil
+}
+
+func (d *Device) rawClose() {
+	if d.mr != nil {
+		d.mr.Close()
+		d.mr = nil
+	}
+}
+
+// media of video helper or gstreamer captures the device itself, raw capture could not open
+func (d *Device) rawBusy() bool {
+	d.rawMu.Lock()
+	defer d.rawMu.Unlock()
+
+	return d.rawEncoder == nil && (d.mv != nil || d.mg != nil)
+}
+
+// open or close raw capture by its users, called under media lock
+func (d *Device) rawSync() {
+	d.rawMu.Lock()
+	media := d.rawEncoder != nil
+	d.rawMu.Unlock()
+
+	if !media && (!d.snapshotOpened || d.rawBusy()) {
+		d.rawClose()
+		return
+	}
+
+	err := d.rawOpen()
+	if err != nil {
+		log.Println("device raw open error", err)
+	}
+}
+
+// frame of raw capture, snapshots get it before processors
+func (d *Device) writeRawFrame(f frame.Frame) {
+	d.snapshot.WriteFrame(f)
+
+	d.rawMu.Lock()
+	mg := d.rawEncoder
+	chain := d.rawChain
+	d.rawMu.Unlock()
+
+	if mg == nil {
+		return
+	}
+
+	chain.Process(&f)
+
+	err := mg.WriteFrame(f)
+	if err != nil {
+		log.Println("device write frame error", err)
+	}
+}
+
+// snapshot wants frames, they are of raw capture,
+// or decoded key frames of media when it captures the device, only h264 is decoded
+func (d *Device) snapshotOpen() error {
+	d.mediaMu.Lock()
+	defer d.mediaMu.Unlock()
+
+	if d.rawBusy() && d.mediaCodec != webrtc.VideoCodecH264 {
+		return fmt.Errorf("device snapshot unsupported media codec %s", d.mediaCodec)
+	}
+
+	d.snapshotOpened = true
+	d.snapshotSync()
+	if d.rawBusy() {
+		return nil
+	}
+
+	return d.rawOpen()
+}
+
+func (d *Device) snapshotClose() {
+	d.mediaMu.Lock()
+	defer d.mediaMu.Unlock()
+
+	d.snapshotOpened = false
+	d.rawSync()
+	d.snapshotSync()
+}
+
+// key frames of media are decoded for snapshots, called under media lock
+func (d *Device) snapshotSync() {
+	d.snapshotDecode.Store(d.snapshotOpened && d.rawBusy() && d.mediaCodec == webrtc.VideoCodecH264)
+}
+
+// decode key frame for a waiting snapshot, one at a time, other frames are dropped
+func (d *Device) writeSnapshotKeyFrame(au []byte) {
+	if !h264.IsKeyFrame(au) || !d.snapshot.Waiting() || !d.snapshotBusy.CompareAndSwap(false, true) {
+		return
+	}
+
+	b := make([]byte, len(au))
+	copy(b, au)
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer d.snapshotBusy.Store(false)
+
+		f, err := gstreamer.DecodeH264(context.Background(), b)
+		if err != nil {
+			log.Println("device snapshot decode error", err)
+			return
+		}
+		d.snapshot.WriteFrame(f)
+	}()
+}
+
+// media start with frame processors, video and gstreamer source
+//
+// the capture helper does not expose frames before encoding, so raw frames are captured,
+// processed, then encoded by gstreamer with the capture element replaced
+func (d *Device) mediaStartRaw(codec string) error {
+	if d.mg != nil {
+		return fmt.Errorf("device raw media exists")
+	}
+
+	q := d.mediaQuality
+	mg, err := gstreamer.NewGstreamerRaw(
+		d.gstProfile,
+		"localhost",
+		10000,
+		q.Width,
+		q.Height,
+		q.BitRate,
+		q.Gop,
+		q.Fps,
+		codec,
+	)
+	if err != nil {
+		return err
+	}
+	d.mg = &mg
+
+	d.mg.OnData = d.writeMediaRtp
+	d.mg.OnRestart = d.restartMediaRtp
+
+	err = d.mg.Open()
+	if err != nil {
+		return err
+	}
+
+	// raw capture of snapshots keeps running
+	d.rawMu.Lock()
+	d.rawEncoder = d.mg
+	d.rawChain = d.frameChain
+	d.rawMu.Unlock()
+
+	return d.rawOpen()
+}
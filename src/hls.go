@@ -0,0 +1,79 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"device-go/src/libs/hls"
+	"device-go/src/libs/server"
+	"device-go/src/libs/webrtc"
+)
+
+// hls muxer is closed after this idle duration
+const hlsIdleTimeout = 30 * time.Second
+
+// done segments in playlist, a segment is a gop
+const hlsSegmentCount = 4
+
+const hlsPartTarget = 200 * time.Millisecond
+
+// hls start at the first request, or delay its stop
+func (d *Device) hlsAcquire() (*hls.Muxer, error) {
+	d.hlsMu.Lock()
+	defer d.hlsMu.Unlock()
+
+	if d.hls != nil {
+		d.hlsTimer.Reset(hlsIdleTimeout)
+		return d.hls, nil
+	}
+
+	m := hls.NewMuxer(videoWidth, videoHeight, hlsSegmentCount, hlsPartTarget)
+	err := d.mediaAcquire(mediaSinkHls, webrtc.VideoCodecH264, func(codec string) (mediaSink, error) {
+		if codec != webrtc.VideoCodecH264 {
+			return mediaSink{}, fmt.Errorf("unsupported codec %s", codec)
+		}
+
+		return mediaSink{OnAccessUnit: m.WriteAccessUnit}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("device hls start")
+
+	d.hls = &m
+	d.hlsTimer = time.AfterFunc(hlsIdleTimeout, d.hlsStop)
+
+	return d.hls, nil
+}
+
+// hls stop, waiting requests are finished
+func (d *Device) hlsStop() {
+	d.hlsMu.Lock()
+	defer d.hlsMu.Unlock()
+
+	if d.hls == nil {
+		return
+	}
+
+	log.Println("device hls stop")
+
+	d.hlsTimer.Stop()
+	d.mediaRelease(mediaSinkHls)
+	d.hls.Close()
+	d.hls = nil
+}
+
+// GET /hls/{name}, low latency hls of h264 stream, start with `index.m3u8`
+func (d *Device) handleLocalHls(w http.ResponseWriter, req *http.Request) {
+	m, err := d.hlsAcquire()
+	if err != nil {
+		log.Println("device local hls error", err)
+		server.WriteError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	m.Serve(w, req, req.PathValue("name"))
+}
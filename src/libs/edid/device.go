@@ -0,0 +1,92 @@
+package edid
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// max blocks of v4l2 edid
+const v4l2MaxBlocks = 4
+
+// struct v4l2_edid of videodev2.h
+type v4l2Edid struct {
+	pad        uint32
+	startBlock uint32
+	blocks     uint32
+	reserved   [5]uint32
+	edid       unsafe.Pointer
+}
+
+// _IOWR('V', nr, struct v4l2_edid)
+func v4l2Ioctl(nr uintptr) uintptr {
+	return 3<<30 | unsafe.Sizeof(v4l2Edid{})<<16 | 'V'<<8 | nr
+}
+
+var (
+	vidiocGEdid = v4l2Ioctl(40)
+	vidiocSEdid = v4l2Ioctl(41)
+)
+
+// device file is v4l2 device or sub device, others are sysfs files
+func isV4l2(path string) bool {
+	return strings.HasPrefix(path, "/dev/")
+}
+
+func ioctlEdid(path string, req uintptr, e *v4l2Edid) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(unsafe.Pointer(e)))
+	runtime.KeepAlive(e)
+	if errno != 0 {
+		return fmt.Errorf("edid ioctl error %v", errno)
+	}
+
+	return nil
+}
+
+// read edid of capture input, eg. /dev/v4l-subdev2 or a sysfs file
+func Read(path string) ([]byte, error) {
+	if !isV4l2(path) {
+		return os.ReadFile(path)
+	}
+
+	b := make([]byte, v4l2MaxBlocks*BlockSize)
+	e := v4l2Edid{blocks: v4l2MaxBlocks, edid: unsafe.Pointer(&b[0])}
+
+	err := ioctlEdid(path, vidiocGEdid, &e)
+	runtime.KeepAlive(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return b[:e.blocks*BlockSize], nil
+}
+
+// write edid to capture input, it is validated first
+//
+// the target sees a hot plug, and chooses its output mode again
+func Write(path string, b []byte) error {
+	_, err := Parse(b)
+	if err != nil {
+		return err
+	}
+
+	if !isV4l2(path) {
+		return os.WriteFile(path, b, 0644)
+	}
+
+	e := v4l2Edid{blocks: uint32(len(b) / BlockSize), edid: unsafe.Pointer(&b[0])}
+
+	err = ioctlEdid(path, vidiocSEdid, &e)
+	runtime.KeepAlive(b)
+
+	return err
+}
@@ -0,0 +1,250 @@
+package edid
+
+import (
+	"fmt"
+	"strings"
+)
+
+const BlockSize = 128
+
+// cea-861 extension tag
+const ceaTag = 0x02
+
+const (
+	ceaBlockAudio   = 1
+	ceaBlockVideo   = 2
+	ceaBlockVendor  = 3
+	ceaBlockSpeaker = 4
+)
+
+// ieee oui of hdmi vendor specific data block, lsb first
+var hdmiOui = []byte{0x03, 0x0c, 0x00}
+
+var header = []byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}
+
+// display descriptor tags
+const (
+	descriptorName  = 0xfc
+	descriptorRange = 0xfd
+)
+
+// detailed timing, pixel clock in kHz
+type Timing struct {
+	PixelClock uint `json:"pixelClock"`
+	Width      uint `json:"width"`
+	Height     uint `json:"height"`
+	HBlank     uint `json:"hBlank"`
+	VBlank     uint `json:"vBlank"`
+	HFront     uint `json:"hFront"`
+	HSync      uint `json:"hSync"`
+	VFront     uint `json:"vFront"`
+	VSync      uint `json:"vSync"`
+	Interlaced bool `json:"interlaced,omitempty"`
+}
+
+// refresh rate in Hz
+func (t Timing) Refresh() float64 {
+	total := (t.Width + t.HBlank) * (t.Height + t.VBlank)
+	if total == 0 {
+		return 0
+	}
+
+	r := float64(t.PixelClock) * 1000 / float64(total)
+	if t.Interlaced {
+		r *= 2
+	}
+	return r
+}
+
+func (t Timing) Valid() error {
+	if t.PixelClock == 0 || t.Width == 0 || t.Height == 0 {
+		return fmt.Errorf("edid timing empty %dx%d %dkHz", t.Width, t.Height, t.PixelClock)
+	} else if t.HFront+t.HSync > t.HBlank || t.HSync == 0 {
+		return fmt.Errorf("edid timing invalid horizontal blank %d front %d sync %d", t.HBlank, t.HFront, t.HSync)
+	} else if t.VFront+t.VSync > t.VBlank || t.VSync == 0 {
+		return fmt.Errorf("edid timing invalid vertical blank %d front %d sync %d", t.VBlank, t.VFront, t.VSync)
+	}
+
+	return nil
+}
+
+func (t Timing) String() string {
+	return fmt.Sprintf("%dx%d@%.2f", t.Width, t.Height, t.Refresh())
+}
+
+// parsed edid, base block and cea-861 extensions
+type Edid struct {
+	Manufacturer string `json:"manufacturer"`
+	Product      uint16 `json:"product"`
+	Serial       uint32 `json:"serial"`
+	Year         uint   `json:"year"`
+	Version      string `json:"version"`
+	Name         string `json:"name,omitempty"`
+	// detailed timings, the first one is preferred
+	Timings []Timing `json:"timings"`
+	// short video descriptors of cea-861
+	Vics []uint8 `json:"vics,omitempty"`
+	// max tmds clock in MHz of hdmi vendor block, 0 if not set
+	MaxTmdsClock uint `json:"maxTmdsClock,omitempty"`
+	Extensions   int  `json:"extensions"`
+}
+
+// preferred timing
+func (e *Edid) Preferred() (Timing, bool) {
+	if len(e.Timings) == 0 {
+		return Timing{}, false
+	}
+
+	return e.Timings[0], true
+}
+
+func checksum(block []byte) byte {
+	sum := byte(0)
+	for _, b := range block {
+		sum += b
+	}
+	return sum
+}
+
+func parseTiming(d []byte) Timing {
+	return Timing{
+		PixelClock: (uint(d[0]) | uint(d[1])<<8) * 10,
+		Width:      uint(d[2]) | uint(d[4]>>4)<<8,
+		HBlank:     uint(d[3]) | uint(d[4]&0x0f)<<8,
+		Height:     uint(d[5]) | uint(d[7]>>4)<<8,
+		VBlank:     uint(d[6]) | uint(d[7]&0x0f)<<8,
+		HFront:     uint(d[8]) | uint(d[11]>>6)<<8,
+		HSync:      uint(d[9]) | uint(d[11]>>4&0x03)<<8,
+		VFront:     uint(d[10]>>4) | uint(d[11]>>2&0x03)<<4,
+		VSync:      uint(d[10]&0x0f) | uint(d[11]&0x03)<<4,
+		Interlaced: d[17]&0x80 != 0,
+	}
+}
+
+// parse 18 bytes descriptor, timing or display descriptor
+func (e *Edid) parseDescriptor(d []byte) error {
+	if d[0] != 0 || d[1] != 0 {
+		t := parseTiming(d)
+		err := t.Valid()
+		if err != nil {
+			return err
+		}
+		e.Timings = append(e.Timings, t)
+		return nil
+	}
+
+	if d[3] == descriptorName {
+		name, _, _ := strings.Cut(string(d[5:]), "\n")
+		e.Name = strings.TrimSpace(name)
+	}
+
+	return nil
+}
+
+func (e *Edid) parseCea(b []byte) error {
+	if b[1] < 3 {
+		return fmt.Errorf("edid cea revision %d unsupported", b[1])
+	}
+
+	// 0 means no data block and detailed timing
+	offset := int(b[2])
+	if offset == 0 {
+		return nil
+	} else if offset < 4 || offset > BlockSize-1 {
+		return fmt.Errorf("edid cea invalid timing offset %d", offset)
+	}
+
+	// data blocks
+	for i := 4; i < offset; {
+		tag := b[i] >> 5
+		n := int(b[i] & 0x1f)
+		if i+1+n > offset {
+			return fmt.Errorf("edid cea data block overflow at %d", i)
+		}
+		data := b[i+1 : i+1+n]
+
+		switch tag {
+		case ceaBlockVideo:
+			for _, v := range data {
+				e.Vics = append(e.Vics, v&0x7f)
+			}
+		case ceaBlockVendor:
+			if n >= 7 && string(data[:3]) == string(hdmiOui) {
+				e.MaxTmdsClock = uint(data[6]) * 5
+			}
+		}
+
+		i += 1 + n
+	}
+
+	// detailed timings
+	for i := offset; i+18 <= BlockSize-1; i += 18 {
+		if b[i] == 0 && b[i+1] == 0 {
+			break
+		}
+		err := e.parseDescriptor(b[i : i+18])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parse and validate edid, header, checksums and detailed timings
+func Parse(b []byte) (Edid, error) {
+	e := Edid{}
+
+	if len(b) < BlockSize || len(b)%BlockSize != 0 {
+		return e, fmt.Errorf("edid invalid size %d", len(b))
+	} else if string(b[:8]) != string(header) {
+		return e, fmt.Errorf("edid invalid header")
+	}
+
+	e.Extensions = int(b[126])
+	if len(b) != (e.Extensions+1)*BlockSize {
+		return e, fmt.Errorf("edid size %d not match extensions %d", len(b), e.Extensions)
+	}
+
+	for i := range e.Extensions + 1 {
+		if c := checksum(b[i*BlockSize : (i+1)*BlockSize]); c != 0 {
+			return e, fmt.Errorf("edid block %d checksum error %d", i, c)
+		}
+	}
+
+	// vendor and product
+	id := uint16(b[8])<<8 | uint16(b[9])
+	e.Manufacturer = string([]byte{
+		byte(id>>10&0x1f) + 'A' - 1,
+		byte(id>>5&0x1f) + 'A' - 1,
+		byte(id&0x1f) + 'A' - 1,
+	})
+	e.Product = uint16(b[10]) | uint16(b[11])<<8
+	e.Serial = uint32(b[12]) | uint32(b[13])<<8 | uint32(b[14])<<16 | uint32(b[15])<<24
+	e.Year = uint(b[17]) + 1990
+	e.Version = fmt.Sprintf("%d.%d", b[18], b[19])
+
+	for i := 54; i < 126; i += 18 {
+		err := e.parseDescriptor(b[i : i+18])
+		if err != nil {
+			return e, err
+		}
+	}
+	if len(e.Timings) == 0 {
+		return e, fmt.Errorf("edid no detailed timing")
+	}
+
+	for i := 1; i <= e.Extensions; i++ {
+		block := b[i*BlockSize : (i+1)*BlockSize]
+		if block[0] != ceaTag {
+			continue
+		}
+
+		err := e.parseCea(block)
+		if err != nil {
+			return e, err
+		}
+	}
+
+	return e, nil
+}
@@ -0,0 +1,117 @@
+package edid
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("should parse presets", func(t *testing.T) {
+		expected := map[string]struct {
+			width    uint
+			height   uint
+			name     string
+			maxClock uint
+		}{
+			Preset1080p60:    {1920, 1080, "KVVM 1080P", 150},
+			Preset720p60:     {1280, 720, "KVVM 720P", 80},
+			Preset4kDisabled: {1920, 1080, "KVVM NO 4K", 165},
+		}
+
+		for _, name := range Presets() {
+			b, err := UsePreset(name)
+			if err != nil {
+				t.Fatalf("use preset %s error %v", name, err)
+			}
+
+			e, err := Parse(b)
+			if err != nil {
+				t.Fatalf("parse preset %s error %v", name, err)
+			}
+
+			p, _ := e.Preferred()
+			x := expected[name]
+			if p.Width != x.width || p.Height != x.height || math.Abs(p.Refresh()-60) > 0.01 {
+				t.Errorf("preset %s preferred not match %s", name, p)
+			}
+			if e.Name != x.name || e.Manufacturer != "KVM" || e.Version != "1.3" || e.Extensions != 1 {
+				t.Errorf("preset %s info not match %+v", name, e)
+			}
+			if e.MaxTmdsClock != x.maxClock || len(e.Vics) == 0 {
+				t.Errorf("preset %s cea not match %d %v", name, e.MaxTmdsClock, e.Vics)
+			}
+		}
+	})
+
+	t.Run("should round trip timing", func(t *testing.T) {
+		d := make([]byte, 18)
+		encodeTiming(d, timing1080p50)
+
+		if tt := parseTiming(d); tt != timing1080p50 {
+			t.Errorf("timing not match %+v", tt)
+		}
+	})
+
+	t.Run("should be error, because edid invalid", func(t *testing.T) {
+		b, _ := UsePreset(Preset1080p60)
+
+		cases := map[string]func(b []byte) []byte{
+			"size":     func(b []byte) []byte { return b[:200] },
+			"header":   func(b []byte) []byte { b[0] = 1; return b },
+			"checksum": func(b []byte) []byte { b[130]++; return b },
+			"blocks":   func(b []byte) []byte { b[126] = 2; b[127]--; return b },
+			"timing": func(b []byte) []byte {
+				// sync is out of blank
+				b[54+9] = 0xff
+				b[127] -= 0xff - 44
+				return b
+			},
+		}
+
+		for name, f := range cases {
+			c := make([]byte, len(b))
+			copy(c, b)
+
+			_, err := Parse(f(c))
+			if err == nil {
+				t.Errorf("%s should be error", name)
+			}
+		}
+
+		_, err := UsePreset("4k")
+		if err == nil {
+			t.Errorf("preset should not be found")
+		}
+	})
+}
+
+func TestWrite(t *testing.T) {
+	t.Run("should write and read sysfs file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "edid")
+		b, _ := UsePreset(Preset720p60)
+
+		err := Write(path, b)
+		if err != nil {
+			t.Fatalf("write error %v", err)
+		}
+
+		r, err := Read(path)
+		if err != nil || string(r) != string(b) {
+			t.Errorf("read not match %v", err)
+		}
+	})
+
+	t.Run("should not write invalid edid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "edid")
+
+		err := Write(path, make([]byte, BlockSize))
+		if err == nil {
+			t.Errorf("should be error")
+		}
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("file should not be written")
+		}
+	})
+}
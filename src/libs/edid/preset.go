@@ -0,0 +1,230 @@
+package edid
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	Preset1080p60    = "1080p60"
+	Preset720p60     = "720p60"
+	Preset4kDisabled = "4k-disabled"
+)
+
+// cea-861 timings
+var (
+	timing1080p60 = Timing{PixelClock: 148500, Width: 1920, Height: 1080, HBlank: 280, VBlank: 45, HFront: 88, HSync: 44, VFront: 4, VSync: 5}
+	timing1080p50 = Timing{PixelClock: 148500, Width: 1920, Height: 1080, HBlank: 720, VBlank: 45, HFront: 528, HSync: 44, VFront: 4, VSync: 5}
+	timing720p60  = Timing{PixelClock: 74250, Width: 1280, Height: 720, HBlank: 370, VBlank: 30, HFront: 110, HSync: 40, VFront: 5, VSync: 5}
+	timing720p50  = Timing{PixelClock: 74250, Width: 1280, Height: 720, HBlank: 700, VBlank: 30, HFront: 440, HSync: 40, VFront: 5, VSync: 5}
+)
+
+// cea-861 video identification codes
+const (
+	vic480p60  = 3
+	vic720p60  = 4
+	vic1080p60 = 16
+	vic720p50  = 19
+	vic1080p50 = 31
+	vic1080p24 = 32
+	vic1080p30 = 34
+)
+
+// established timings 640x480@60, 800x600@60, 1024x768@60
+var establishedTimings = []byte{0x21, 0x08, 0x00}
+
+// srgb chromaticity
+var chromaticity = []byte{0xee, 0x91, 0xa3, 0x54, 0x4c, 0x99, 0x26, 0x0f, 0x50, 0x54}
+
+// lpcm 2 channels, 32/44.1/48 kHz, 16/20/24 bit, hdmi audio is captured
+var shortAudioDescriptor = []byte{0x09, 0x07, 0x07}
+
+type preset struct {
+	name string
+	// detailed timings, the first one is preferred
+	timings []Timing
+	vics    []uint8
+	// max pixel clock in MHz of range limits, also the max tmds clock
+	maxClock uint
+	// standard timings of legacy modes, x resolution, aspect ratio bits, 60 Hz
+	standard [][2]byte
+}
+
+var presets = map[string]preset{
+	Preset1080p60: {
+		name:     "KVVM 1080P",
+		timings:  []Timing{timing1080p60, timing1080p50},
+		vics:     []uint8{vic1080p60, vic1080p50, vic1080p30, vic1080p24, vic720p60, vic720p50, vic480p60},
+		maxClock: 150,
+	},
+	Preset720p60: {
+		name:     "KVVM 720P",
+		timings:  []Timing{timing720p60, timing720p50},
+		vics:     []uint8{vic720p60, vic720p50, vic480p60},
+		maxClock: 80,
+	},
+	// broad compatibility up to 1080p, eg. 1280x1024 for old machines, no mode above 165 MHz
+	Preset4kDisabled: {
+		name:     "KVVM NO 4K",
+		timings:  []Timing{timing1080p60, timing720p60},
+		vics:     []uint8{vic1080p60, vic1080p50, vic1080p30, vic1080p24, vic720p60, vic720p50, vic480p60},
+		maxClock: 165,
+		standard: [][2]byte{
+			{(1280 / 8) - 31, 0x80}, // 1280x1024
+			{(1280 / 8) - 31, 0x00}, // 1280x800
+			{(1440 / 8) - 31, 0x00}, // 1440x900
+			{(1600 / 8) - 31, 0x40}, // 1600x1200
+			{(1680 / 8) - 31, 0x00}, // 1680x1050
+		},
+	},
+}
+
+// names of builtin presets
+func Presets() []string {
+	names := []string{}
+	for k := range presets {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// build edid blob of a builtin preset
+func UsePreset(name string) ([]byte, error) {
+	p, ok := presets[name]
+	if !ok {
+		return nil, fmt.Errorf("edid preset %s not found", name)
+	}
+
+	return p.build(), nil
+}
+
+func encodeTiming(d []byte, t Timing) {
+	clock := t.PixelClock / 10
+	d[0] = byte(clock)
+	d[1] = byte(clock >> 8)
+	d[2] = byte(t.Width)
+	d[3] = byte(t.HBlank)
+	d[4] = byte(t.Width>>8)<<4 | byte(t.HBlank>>8)&0x0f
+	d[5] = byte(t.Height)
+	d[6] = byte(t.VBlank)
+	d[7] = byte(t.Height>>8)<<4 | byte(t.VBlank>>8)&0x0f
+	d[8] = byte(t.HFront)
+	d[9] = byte(t.HSync)
+	d[10] = byte(t.VFront&0x0f)<<4 | byte(t.VSync&0x0f)
+	d[11] = byte(t.HFront>>8&0x03)<<6 | byte(t.HSync>>8&0x03)<<4 | byte(t.VFront>>4&0x03)<<2 | byte(t.VSync>>4&0x03)
+	// image size 800x450 mm
+	d[12] = 0x20
+	d[13] = 0xc2
+	d[14] = 0x31
+	// digital separate sync, positive polarity
+	d[17] = 0x1e
+	if t.Interlaced {
+		d[17] |= 0x80
+	}
+}
+
+func encodeName(d []byte, name string) {
+	d[3] = descriptorName
+	n := copy(d[5:], name)
+	if n < 13 {
+		d[5+n] = '\n'
+		for i := 5 + n + 1; i < 18; i++ {
+			d[i] = ' '
+		}
+	}
+}
+
+func encodeRange(d []byte, maxClock uint) {
+	d[3] = descriptorRange
+	// vertical 24 to 75 Hz, horizontal 15 to 80 kHz
+	d[5] = 24
+	d[6] = 75
+	d[7] = 15
+	d[8] = 80
+	d[9] = byte((maxClock + 9) / 10)
+	// default gtf, padding
+	d[10] = 0x00
+	d[11] = '\n'
+	for i := 12; i < 18; i++ {
+		d[i] = ' '
+	}
+}
+
+func (p preset) build() []byte {
+	b := make([]byte, BlockSize*2)
+
+	// base block
+	copy(b, header)
+	// manufacturer KVM
+	id := uint16('K'-'A'+1)<<10 | uint16('V'-'A'+1)<<5 | uint16('M'-'A'+1)
+	b[8] = byte(id >> 8)
+	b[9] = byte(id)
+	b[10] = 0x01
+	b[16] = 1
+	// 2024
+	b[17] = 34
+	// version 1.3
+	b[18] = 1
+	b[19] = 3
+	// digital input, 80x45 cm, gamma 2.2, rgb, preferred timing in first descriptor
+	b[20] = 0x80
+	b[21] = 80
+	b[22] = 45
+	b[23] = 0x78
+	b[24] = 0x0a
+	copy(b[25:35], chromaticity)
+	copy(b[35:38], establishedTimings)
+	for i := range 8 {
+		b[38+i*2] = 0x01
+		b[38+i*2+1] = 0x01
+		if i < len(p.standard) {
+			b[38+i*2] = p.standard[i][0]
+			b[38+i*2+1] = p.standard[i][1]
+		}
+	}
+
+	encodeTiming(b[54:72], p.timings[0])
+	if len(p.timings) > 1 {
+		encodeTiming(b[72:90], p.timings[1])
+	} else {
+		// dummy descriptor
+		b[75] = 0x10
+	}
+	encodeRange(b[90:108], p.maxClock)
+	encodeName(b[108:126], p.name)
+	b[126] = 1
+	b[127] = -checksum(b[:127])
+
+	// cea-861 block
+	c := b[BlockSize:]
+	c[0] = ceaTag
+	c[1] = 3
+	// basic audio, ycbcr 4:4:4 and 4:2:2, 1 native detailed timing
+	c[3] = 0x71
+
+	i := 4
+	addBlock := func(tag byte, data []byte) {
+		c[i] = tag<<5 | byte(len(data))
+		copy(c[i+1:], data)
+		i += 1 + len(data)
+	}
+
+	vics := make([]byte, len(p.vics))
+	copy(vics, p.vics)
+	// first vic is native
+	vics[0] |= 0x80
+	addBlock(ceaBlockVideo, vics)
+	addBlock(ceaBlockAudio, shortAudioDescriptor)
+	// front left and right
+	addBlock(ceaBlockSpeaker, []byte{0x01, 0x00, 0x00})
+	// hdmi, physical address 1.0.0.0, max tmds clock
+	addBlock(ceaBlockVendor, append(append([]byte{}, hdmiOui...), 0x10, 0x00, 0x00, byte(p.maxClock/5)))
+
+	// no detailed timing, they are in base block
+	c[2] = byte(i)
+	c[127] = -checksum(c[:127])
+
+	return b
+}
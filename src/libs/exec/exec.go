@@ -2,33 +2,101 @@ package exec
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"sync"
+	"time"
 )
 
+// keep last lines of stderr for diagnostics
+const execStderrLines = 20
+
+const execWaitDelay = time.Second
+
+// long line is split
+const execStderrLineSize = 1024
+
+// stderr writer, logs every line and keeps the last lines
+type execStderr struct {
+	path string
+
+	mu    sync.Mutex
+	line  []byte
+	lines []string
+}
+
+func (s *execStderr) push(line string) {
+	log.Println("exec stderr", s.path, line)
+
+	s.lines = append(s.lines, line)
+	if len(s.lines) > execStderrLines {
+		s.lines = s.lines[len(s.lines)-execStderrLines:]
+	}
+}
+
+func (s *execStderr) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range b {
+		if c == '\n' || len(s.line) >= execStderrLineSize {
+			s.push(string(s.line))
+			s.line = s.line[:0]
+		}
+		if c != '\n' {
+			s.line = append(s.line, c)
+		}
+	}
+
+	return len(b), nil
+}
+
+func (s *execStderr) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.line = nil
+	s.lines = nil
+}
+
+func (s *execStderr) tail() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lines := make([]string, len(s.lines))
+	copy(lines, s.lines)
+	if len(s.line) > 0 {
+		lines = append(lines, string(s.line))
+	}
+
+	return lines
+}
+
 type Exec struct {
 	path string
 	args []string
 
-	cmd   *exec.Cmd
-	cmdMu sync.RWMutex
+	cmd    *exec.Cmd
+	cmdMu  sync.RWMutex
+	stderr *execStderr
 }
 
 func NewExec(path string, args ...string) Exec {
 	return Exec{
-		path: path,
-		args: args,
+		path:   path,
+		args:   args,
+		stderr: &execStderr{path: path},
 	}
 }
 
-func (e *Exec) startCmd() error {
+func (e *Exec) startCmd(stdin bool) (io.WriteCloser, error) {
 	e.cmdMu.Lock()
 	defer e.cmdMu.Unlock()
 
 	if e.cmd != nil {
-		return fmt.Errorf("exec cmd exists")
+		return nil, fmt.Errorf("exec cmd exists")
 	}
 
 	e.cmd = exec.Command(
@@ -36,14 +104,31 @@ func (e *Exec) startCmd() error {
 		e.args...,
 	)
 
+	// pipe is closed after the command exits
+	var w io.WriteCloser
+	if stdin {
+		var err error
+		w, err = e.cmd.StdinPipe()
+		if err != nil {
+			e.cmd = nil
+			return nil, err
+		}
+	}
+
+	// capture stderr
+	e.stderr.reset()
+	e.cmd.Stderr = e.stderr
+	// do not wait stderr forever, if it is inherited by a child process
+	e.cmd.WaitDelay = execWaitDelay
+
 	// start
 	err := e.cmd.Start()
 	if err != nil {
 		e.cmd = nil
-		return err
+		return nil, err
 	}
 
-	return nil
+	return w, nil
 }
 
 func (e *Exec) stopCmd() error {
@@ -69,7 +154,13 @@ func (e *Exec) stopCmd() error {
 }
 
 func (e *Exec) Start() error {
-	return e.startCmd()
+	_, err := e.startCmd(false)
+	return err
+}
+
+// start with a pipe to stdin of the command
+func (e *Exec) StartStdin() (io.WriteCloser, error) {
+	return e.startCmd(true)
 }
 
 func (e *Exec) Stop() {
@@ -78,3 +169,8 @@ func (e *Exec) Stop() {
 		log.Println("exec stop error", e.path, err)
 	}
 }
+
+// last lines of stderr, of the running or the last command
+func (e *Exec) Stderr() []string {
+	return e.stderr.tail()
+}
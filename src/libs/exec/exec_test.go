@@ -1,6 +1,8 @@
 package exec
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -19,3 +21,67 @@ func TestExec(t *testing.T) {
 		time.Sleep(100 * time.Millisecond)
 	})
 }
+
+func TestExecStderr(t *testing.T) {
+	ex := NewExec("sh", "-c", "echo first >&2; echo second >&2; printf third >&2; exec sleep 60")
+
+	t.Run("should capture stderr", func(t *testing.T) {
+		err := ex.Start()
+		if err != nil {
+			t.Fatalf("start error %v", err)
+		}
+		defer ex.Stop()
+
+		expected := []string{"first", "second", "third"}
+
+		var lines []string
+		for range 50 {
+			lines = ex.Stderr()
+			if len(lines) == len(expected) {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		if len(lines) != len(expected) {
+			t.Fatalf("lines not match %v %v", lines, expected)
+		}
+		for i, v := range expected {
+			if lines[i] != v {
+				t.Errorf("line %d not match %s %s", i, lines[i], v)
+			}
+		}
+	})
+}
+
+func TestExecStdin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out")
+	ex := NewExec("sh", "-c", "cat > "+path+"; exec sleep 60")
+
+	t.Run("should write stdin", func(t *testing.T) {
+		w, err := ex.StartStdin()
+		if err != nil {
+			t.Fatalf("start error %v", err)
+		}
+		defer ex.Stop()
+
+		_, err = w.Write([]byte("frame"))
+		if err != nil {
+			t.Fatalf("write error %v", err)
+		}
+		w.Close()
+
+		var b []byte
+		for range 50 {
+			b, _ = os.ReadFile(path)
+			if len(b) == 5 {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		if string(b) != "frame" {
+			t.Errorf("stdin not match %s", b)
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package frame
+
+import "unicode"
+
+// yuv color, bt.601 limited range
+type Color struct {
+	Y byte
+	U byte
+	V byte
+}
+
+var (
+	ColorBlack = Color{Y: 16, U: 128, V: 128}
+	ColorWhite = Color{Y: 235, U: 128, V: 128}
+)
+
+func clampByte(v int) byte {
+	if v < 0 {
+		return 0
+	} else if v > 255 {
+		return 255
+	}
+	return byte(v)
+}
+
+// create color from rgb, bt.601 limited range
+func NewColor(r byte, g byte, b byte) Color {
+	ri := int(r)
+	gi := int(g)
+	bi := int(b)
+
+	return Color{
+		Y: clampByte((66*ri+129*gi+25*bi+128)>>8 + 16),
+		U: clampByte((-38*ri-74*gi+112*bi+128)>>8 + 128),
+		V: clampByte((112*ri-94*gi-18*bi+128)>>8 + 128),
+	}
+}
+
+// fill rect, it is clipped to the frame
+func (f *Frame) FillRect(x int, y int, width int, height int, c Color) {
+	if f.Valid() != nil {
+		return
+	}
+
+	fw := int(f.Width)
+	fh := int(f.Height)
+
+	x0 := max(x, 0)
+	y0 := max(y, 0)
+	x1 := min(x+width, fw)
+	y1 := min(y+height, fh)
+	if x0 >= x1 || y0 >= y1 {
+		return
+	}
+
+	for py := y0; py < y1; py++ {
+		row := f.Data[py*fw:]
+		for px := x0; px < x1; px++ {
+			row[px] = c.Y
+		}
+	}
+
+	// uv sample covers 2x2 pixels
+	uv := f.Data[fw*fh:]
+	for py := y0 / 2; py < (y1+1)/2; py++ {
+		for px := x0 / 2; px < (x1+1)/2; px++ {
+			uv[py*fw+px*2] = c.U
+			uv[py*fw+px*2+1] = c.V
+		}
+	}
+}
+
+func useGlyph(r rune) [fontHeight]byte {
+	g, ok := font[r]
+	if !ok {
+		g, ok = font[unicode.ToUpper(r)]
+	}
+	if !ok {
+		g = font['?']
+	}
+
+	return g
+}
+
+// size of text drawn with scale
+func TextSize(text string, scale int) (int, int) {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0, 0
+	}
+
+	return (n*(fontWidth+1) - 1) * scale, fontHeight * scale
+}
+
+// draw text with built in 5x7 font, every font pixel is scale x scale pixels
+func (f *Frame) DrawText(x int, y int, scale int, text string, c Color) {
+	if scale <= 0 {
+		return
+	}
+
+	for i, r := range []rune(text) {
+		g := useGlyph(r)
+		gx := x + i*(fontWidth+1)*scale
+
+		for row := range fontHeight {
+			for col := range fontWidth {
+				if g[row]>>(fontWidth-1-col)&1 == 0 {
+					continue
+				}
+				f.FillRect(gx+col*scale, y+row*scale, scale, scale, c)
+			}
+		}
+	}
+}
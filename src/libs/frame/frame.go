@@ -0,0 +1,167 @@
+package frame
+
+import (
+	"fmt"
+	"image"
+)
+
+// raw video frame, pixel format is NV12
+//
+// data is y plane, then interleaved uv plane with half height
+type Frame struct {
+	Width     uint
+	Height    uint
+	Timestamp uint64
+	Data      []byte
+}
+
+// nv12 data size of width and height
+func Size(width uint, height uint) int {
+	return int(width*height) + int(width*height)/2
+}
+
+// create a black frame
+func NewFrame(width uint, height uint) Frame {
+	f := Frame{
+		Width:  width,
+		Height: height,
+		Data:   make([]byte, Size(width, height)),
+	}
+
+	// black is y 16, uv 128
+	ys := int(width * height)
+	for i := range ys {
+		f.Data[i] = 16
+	}
+	for i := ys; i < len(f.Data); i++ {
+		f.Data[i] = 128
+	}
+
+	return f
+}
+
+func (f *Frame) Valid() error {
+	if f.Width == 0 || f.Height == 0 {
+		return fmt.Errorf("frame empty size %dx%d", f.Width, f.Height)
+	} else if f.Width%2 != 0 || f.Height%2 != 0 {
+		return fmt.Errorf("frame odd size %dx%d", f.Width, f.Height)
+	} else if len(f.Data) < Size(f.Width, f.Height) {
+		return fmt.Errorf("frame data not enough, expected %d, got %d", Size(f.Width, f.Height), len(f.Data))
+	}
+
+	return nil
+}
+
+// convert to image, the planes are copied
+func (f *Frame) ToImage() (*image.YCbCr, error) {
+	err := f.Valid()
+	if err != nil {
+		return nil, err
+	}
+
+	w := int(f.Width)
+	h := int(f.Height)
+
+	img := image.NewYCbCr(image.Rect(0, 0, w, h), image.YCbCrSubsampleRatio420)
+
+	copy(img.Y, f.Data[:w*h])
+
+	uv := f.Data[w*h:]
+	for i := range len(img.Cb) {
+		img.Cb[i] = uv[i*2]
+		img.Cr[i] = uv[i*2+1]
+	}
+
+	return img, nil
+}
+
+// scale frame with nearest neighbour, this is cheap and good enough for preview
+func (f *Frame) Scale(width uint, height uint) (Frame, error) {
+	err := f.Valid()
+	if err != nil {
+		return Frame{}, err
+	}
+
+	// keep even
+	width &^= 1
+	height &^= 1
+	if width == 0 || height == 0 {
+		return Frame{}, fmt.Errorf("frame scale empty size %dx%d", width, height)
+	} else if width == f.Width && height == f.Height {
+		return *f, nil
+	}
+
+	sw := int(f.Width)
+	sh := int(f.Height)
+	dw := int(width)
+	dh := int(height)
+
+	nf := Frame{
+		Width:     width,
+		Height:    height,
+		Timestamp: f.Timestamp,
+		Data:      make([]byte, Size(width, height)),
+	}
+
+	// y
+	for y := range dh {
+		sy := y * sh / dh
+		for x := range dw {
+			nf.Data[y*dw+x] = f.Data[sy*sw+x*sw/dw]
+		}
+	}
+
+	// uv
+	suv := f.Data[sw*sh:]
+	duv := nf.Data[dw*dh:]
+	for y := range dh / 2 {
+		sy := y * sh / dh
+		for x := range dw / 2 {
+			sx := x * sw / dw
+			duv[y*dw+x*2] = suv[sy*sw+sx*2]
+			duv[y*dw+x*2+1] = suv[sy*sw+sx*2+1]
+		}
+	}
+
+	return nf, nil
+}
+
+// crop a region, it is aligned to even pixels and clamped to the frame
+func (f *Frame) Crop(x int, y int, width int, height int) (Frame, error) {
+	err := f.Valid()
+	if err != nil {
+		return Frame{}, err
+	}
+
+	fw := int(f.Width)
+	fh := int(f.Height)
+
+	x = max(x, 0) &^ 1
+	y = max(y, 0) &^ 1
+	width = min(width, fw-x) &^ 1
+	height = min(height, fh-y) &^ 1
+	if width <= 0 || height <= 0 {
+		return Frame{}, fmt.Errorf("frame crop empty size %dx%d", width, height)
+	}
+
+	nf := Frame{
+		Width:     uint(width),
+		Height:    uint(height),
+		Timestamp: f.Timestamp,
+		Data:      make([]byte, Size(uint(width), uint(height))),
+	}
+
+	// y
+	for r := range height {
+		copy(nf.Data[r*width:(r+1)*width], f.Data[(y+r)*fw+x:])
+	}
+
+	// uv, a row is of two pixel rows
+	suv := f.Data[fw*fh:]
+	duv := nf.Data[width*height:]
+	for r := range height / 2 {
+		copy(duv[r*width:(r+1)*width], suv[(y/2+r)*fw+x:])
+	}
+
+	return nf, nil
+}
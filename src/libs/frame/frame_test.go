@@ -0,0 +1,172 @@
+package frame
+
+import "testing"
+
+func useTestFrame(width uint, height uint) Frame {
+	f := NewFrame(width, height)
+
+	// y is x, u is 100, v is 200
+	for y := range height {
+		for x := range width {
+			f.Data[y*width+x] = byte(x)
+		}
+	}
+	uv := f.Data[width*height:]
+	for i := 0; i < len(uv); i += 2 {
+		uv[i] = 100
+		uv[i+1] = 200
+	}
+
+	return f
+}
+
+func TestFrame(t *testing.T) {
+	t.Run("should be valid", func(t *testing.T) {
+		f := NewFrame(4, 2)
+		if len(f.Data) != 12 {
+			t.Errorf("data length not match %d 12", len(f.Data))
+		}
+
+		err := f.Valid()
+		if err != nil {
+			t.Errorf("valid error %v", err)
+		}
+	})
+
+	t.Run("should be invalid, because data not enough", func(t *testing.T) {
+		f := Frame{Width: 4, Height: 2, Data: make([]byte, 11)}
+
+		err := f.Valid()
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+
+	t.Run("should be invalid, because odd size", func(t *testing.T) {
+		f := Frame{Width: 3, Height: 2, Data: make([]byte, 9)}
+
+		err := f.Valid()
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+
+	t.Run("should convert to image right", func(t *testing.T) {
+		f := useTestFrame(8, 4)
+
+		img, err := f.ToImage()
+		if err != nil {
+			t.Fatalf("to image error %v", err)
+		}
+
+		c := img.YCbCrAt(5, 3)
+		if c.Y != 5 || c.Cb != 100 || c.Cr != 200 {
+			t.Errorf("color not match %v", c)
+		}
+	})
+
+	t.Run("should scale right", func(t *testing.T) {
+		f := useTestFrame(8, 4)
+
+		nf, err := f.Scale(4, 2)
+		if err != nil {
+			t.Fatalf("scale error %v", err)
+		}
+
+		if nf.Width != 4 || nf.Height != 2 {
+			t.Fatalf("size not match %dx%d 4x2", nf.Width, nf.Height)
+		}
+
+		for x := range 4 {
+			if nf.Data[4+x] != byte(x*2) {
+				t.Errorf("y at %d not match %d %d", x, nf.Data[4+x], x*2)
+			}
+		}
+
+		uv := nf.Data[8:]
+		if uv[0] != 100 || uv[1] != 200 {
+			t.Errorf("uv not match %d %d", uv[0], uv[1])
+		}
+	})
+
+	t.Run("should crop clamped to frame", func(t *testing.T) {
+		f := useTestFrame(8, 4)
+
+		nf, err := f.Crop(3, 1, 10, 10)
+		if err != nil {
+			t.Fatalf("crop error %v", err)
+		}
+
+		// aligned to 2,0 and clamped to 6x4
+		if nf.Width != 6 || nf.Height != 4 {
+			t.Fatalf("size not match %dx%d 6x4", nf.Width, nf.Height)
+		}
+		if nf.Data[0] != 2 || nf.Data[3*6+5] != 7 {
+			t.Errorf("y not match %d %d", nf.Data[0], nf.Data[3*6+5])
+		}
+
+		uv := nf.Data[24:]
+		if len(uv) != 12 || uv[0] != 100 || uv[11] != 200 {
+			t.Errorf("uv not match %v", uv)
+		}
+	})
+
+	t.Run("should be error, because crop is outside", func(t *testing.T) {
+		f := useTestFrame(8, 4)
+
+		_, err := f.Crop(8, 0, 4, 4)
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+}
+
+func TestDraw(t *testing.T) {
+	t.Run("should convert rgb right", func(t *testing.T) {
+		if c := NewColor(0, 0, 0); c != ColorBlack {
+			t.Errorf("black not match %v", c)
+		}
+		if c := NewColor(255, 255, 255); c != ColorWhite {
+			t.Errorf("white not match %v", c)
+		}
+	})
+
+	t.Run("should fill rect with clip", func(t *testing.T) {
+		f := NewFrame(8, 4)
+		c := Color{Y: 200, U: 10, V: 20}
+
+		f.FillRect(6, 2, 10, 10, c)
+
+		for y := range 4 {
+			for x := range 8 {
+				inside := x >= 6 && y >= 2
+				if (f.Data[y*8+x] == c.Y) != inside {
+					t.Errorf("y at %d,%d not match %d", x, y, f.Data[y*8+x])
+				}
+			}
+		}
+
+		uv := f.Data[32:]
+		if uv[1*8+3*2] != c.U || uv[1*8+3*2+1] != c.V {
+			t.Errorf("uv not match %d %d", uv[1*8+3*2], uv[1*8+3*2+1])
+		}
+		if uv[0] != 128 {
+			t.Errorf("uv outside changed %d", uv[0])
+		}
+	})
+
+	t.Run("should draw text", func(t *testing.T) {
+		w, h := TextSize("1x", 2)
+		if w != 22 || h != 14 {
+			t.Errorf("text size not match %dx%d 22x14", w, h)
+		}
+
+		f := NewFrame(32, 16)
+		f.DrawText(0, 0, 2, "1x", ColorWhite)
+
+		// top of 1 is at column 2
+		if f.Data[4] != ColorWhite.Y || f.Data[0] != ColorBlack.Y {
+			t.Errorf("glyph not match %d %d", f.Data[4], f.Data[0])
+		}
+	})
+}
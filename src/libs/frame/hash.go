@@ -0,0 +1,101 @@
+package frame
+
+import "math/bits"
+
+// difference hash size, 9x8 cells give 64 bits
+const hashWidth = 9
+const hashHeight = 8
+
+// max luma samples of a cell side, keeps hash cheap on large frames
+const hashCellSamples = 8
+
+// difference hash of luma in rect, it is clipped to the frame
+//
+// every bit is set if a cell is brighter than its right neighbour,
+// it is stable with noise and small changes, eg. mouse cursor
+func (f *Frame) DHash(x int, y int, width int, height int) uint64 {
+	if f.Valid() != nil {
+		return 0
+	}
+
+	fw := int(f.Width)
+	x0 := max(x, 0)
+	y0 := max(y, 0)
+	x1 := min(x+width, fw)
+	y1 := min(y+height, int(f.Height))
+	if x1-x0 < hashWidth || y1-y0 < hashHeight {
+		return 0
+	}
+
+	cells := [hashHeight][hashWidth]int{}
+	for cy := range hashHeight {
+		cy0 := y0 + (y1-y0)*cy/hashHeight
+		cy1 := y0 + (y1-y0)*(cy+1)/hashHeight
+		sy := max((cy1-cy0)/hashCellSamples, 1)
+
+		for cx := range hashWidth {
+			cx0 := x0 + (x1-x0)*cx/hashWidth
+			cx1 := x0 + (x1-x0)*(cx+1)/hashWidth
+			sx := max((cx1-cx0)/hashCellSamples, 1)
+
+			sum := 0
+			n := 0
+			for py := cy0; py < cy1; py += sy {
+				row := f.Data[py*fw:]
+				for px := cx0; px < cx1; px += sx {
+					sum += int(row[px])
+					n++
+				}
+			}
+			cells[cy][cx] = sum / n
+		}
+	}
+
+	h := uint64(0)
+	for cy := range hashHeight {
+		for cx := range hashWidth - 1 {
+			h <<= 1
+			if cells[cy][cx] > cells[cy][cx+1] {
+				h |= 1
+			}
+		}
+	}
+
+	return h
+}
+
+// number of different bits of hashes, 0 to 64
+func HashDistance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// average luma of rect with sampling, it is clipped to the frame
+func (f *Frame) Luma(x int, y int, width int, height int) int {
+	if f.Valid() != nil {
+		return 0
+	}
+
+	fw := int(f.Width)
+	x0 := max(x, 0)
+	y0 := max(y, 0)
+	x1 := min(x+width, fw)
+	y1 := min(y+height, int(f.Height))
+	if x0 >= x1 || y0 >= y1 {
+		return 0
+	}
+
+	sx := max((x1-x0)/(hashWidth*hashCellSamples), 1)
+	sy := max((y1-y0)/(hashHeight*hashCellSamples), 1)
+
+	sum := 0
+	n := 0
+	for py := y0; py < y1; py += sy {
+		row := f.Data[py*fw:]
+		for px := x0; px < x1; px += sx {
+			sum += int(row[px])
+			n++
+		}
+	}
+
+	return sum / n
+}
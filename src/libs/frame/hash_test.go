@@ -0,0 +1,67 @@
+package frame
+
+import "testing"
+
+func TestDHash(t *testing.T) {
+	t.Run("should hash gradient", func(t *testing.T) {
+		// y is x, every cell is darker than its right neighbour
+		f := useTestFrame(72, 16)
+		if h := f.DHash(0, 0, 72, 16); h != 0 {
+			t.Errorf("hash not match %x 0", h)
+		}
+
+		for y := range 16 {
+			for x := range 72 {
+				f.Data[y*72+x] = byte(255 - x)
+			}
+		}
+		if h := f.DHash(0, 0, 72, 16); h != 1<<64-1 {
+			t.Errorf("hash not match %x", h)
+		}
+	})
+
+	t.Run("should ignore small changes", func(t *testing.T) {
+		f := useTestFrame(72, 16)
+		for y := range 16 {
+			for x := range 72 {
+				f.Data[y*72+x] = byte(x * 3)
+			}
+		}
+		a := f.DHash(0, 0, 72, 16)
+
+		f.FillRect(30, 4, 1, 1, ColorWhite)
+		if d := HashDistance(a, f.DHash(0, 0, 72, 16)); d != 0 {
+			t.Errorf("distance not match %d 0", d)
+		}
+
+		f.FillRect(0, 0, 36, 16, ColorWhite)
+		if d := HashDistance(a, f.DHash(0, 0, 72, 16)); d < 8 {
+			t.Errorf("distance should be large %d", d)
+		}
+	})
+
+	t.Run("should hash rect only", func(t *testing.T) {
+		f := useTestFrame(72, 32)
+		a := f.DHash(0, 0, 72, 16)
+
+		f.FillRect(0, 16, 36, 16, ColorWhite)
+		if d := HashDistance(a, f.DHash(0, 0, 72, 16)); d != 0 {
+			t.Errorf("distance not match %d 0", d)
+		}
+		if h := f.DHash(0, 0, 4, 4); h != 0 {
+			t.Errorf("small rect should be 0 %x", h)
+		}
+	})
+
+	t.Run("should average luma", func(t *testing.T) {
+		f := NewFrame(64, 32)
+		f.FillRect(0, 0, 32, 32, ColorWhite)
+
+		if l := f.Luma(0, 0, 64, 32); l != (16+235)/2 {
+			t.Errorf("luma not match %d", l)
+		}
+		if l := f.Luma(32, 0, 100, 100); l != 16 {
+			t.Errorf("luma not match %d 16", l)
+		}
+	})
+}
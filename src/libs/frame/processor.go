@@ -0,0 +1,139 @@
+package frame
+
+import (
+	"strings"
+	"time"
+)
+
+// frame processor, it changes the frame in place before encoding
+type Processor interface {
+	Process(f *Frame)
+}
+
+// processors in order
+type Chain []Processor
+
+func (c Chain) Process(f *Frame) {
+	for _, p := range c {
+		p.Process(f)
+	}
+}
+
+const (
+	MaskModePixelate = "pixelate"
+	MaskModeFill     = "fill"
+)
+
+// pixelate block size, large enough to hide text
+const maskDefaultBlock = 16
+
+// mask a rect of frame, eg. password fields
+//
+// empty mode is pixelate, unknown mode is fill, so a typo never leaks the region
+type Mask struct {
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Mode   string `json:"mode,omitempty"`
+	// pixelate block size in pixels
+	Block int `json:"block,omitempty"`
+}
+
+func (m Mask) Process(f *Frame) {
+	if m.Mode != "" && m.Mode != MaskModePixelate {
+		f.FillRect(m.X, m.Y, m.Width, m.Height, ColorBlack)
+		return
+	}
+
+	if f.Valid() != nil {
+		return
+	}
+
+	block := m.Block
+	if block <= 0 {
+		block = maskDefaultBlock
+	}
+	// uv sample covers 2x2 pixels, keep blocks aligned
+	block = (block + 1) &^ 1
+
+	fw := int(f.Width)
+	fh := int(f.Height)
+
+	x0 := max(m.X, 0) &^ 1
+	y0 := max(m.Y, 0) &^ 1
+	x1 := min(m.X+m.Width, fw)
+	y1 := min(m.Y+m.Height, fh)
+
+	for by := y0; by < y1; by += block {
+		for bx := x0; bx < x1; bx += block {
+			bw := min(block, x1-bx)
+			bh := min(block, y1-by)
+			f.FillRect(bx, by, bw, bh, f.average(bx, by, bw, bh))
+		}
+	}
+}
+
+// average color of a rect inside the frame
+func (f *Frame) average(x int, y int, width int, height int) Color {
+	fw := int(f.Width)
+	fh := int(f.Height)
+
+	ys := 0
+	for py := y; py < y+height; py++ {
+		for px := x; px < x+width; px++ {
+			ys += int(f.Data[py*fw+px])
+		}
+	}
+
+	us := 0
+	vs := 0
+	n := 0
+	uv := f.Data[fw*fh:]
+	for py := y / 2; py < (y+height+1)/2; py++ {
+		for px := x / 2; px < (x+width+1)/2; px++ {
+			us += int(uv[py*fw+px*2])
+			vs += int(uv[py*fw+px*2+1])
+			n++
+		}
+	}
+
+	return Color{
+		Y: byte(ys / (width * height)),
+		U: byte(us / n),
+		V: byte(vs / n),
+	}
+}
+
+// overlay text placeholder, replaced by local time
+const OverlayTime = "{time}"
+
+const overlayTimeFormat = "2006-01-02 15:04:05"
+
+// text burned into frame on a black box, eg. operator name and time
+type Overlay struct {
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Scale int    `json:"scale,omitempty"`
+	Text  string `json:"text"`
+
+	now func() time.Time
+}
+
+func (o Overlay) Process(f *Frame) {
+	if o.Text == "" {
+		return
+	}
+
+	now := o.now
+	if now == nil {
+		now = time.Now
+	}
+
+	scale := max(o.Scale, 1)
+	text := strings.ReplaceAll(o.Text, OverlayTime, now().Format(overlayTimeFormat))
+
+	w, h := TextSize(text, scale)
+	f.FillRect(o.X, o.Y, w+scale*2, h+scale*2, ColorBlack)
+	f.DrawText(o.X+scale, o.Y+scale, scale, text, ColorWhite)
+}
@@ -0,0 +1,89 @@
+package frame
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMask(t *testing.T) {
+	t.Run("should pixelate blocks with average", func(t *testing.T) {
+		f := useTestFrame(16, 8)
+
+		Mask{X: 0, Y: 0, Width: 8, Height: 4, Block: 4}.Process(&f)
+
+		// y of first block is average of 0..3
+		if f.Data[0] != 1 || f.Data[3*16+3] != 1 {
+			t.Errorf("first block not match %d %d", f.Data[0], f.Data[3*16+3])
+		}
+		if f.Data[4] != 5 {
+			t.Errorf("second block not match %d", f.Data[4])
+		}
+		// outside
+		if f.Data[8] != 8 || f.Data[4*16] != 0 {
+			t.Errorf("outside changed %d %d", f.Data[8], f.Data[4*16])
+		}
+		uv := f.Data[128:]
+		if uv[0] != 100 || uv[1] != 200 {
+			t.Errorf("uv not match %d %d", uv[0], uv[1])
+		}
+	})
+
+	t.Run("should clip to the frame", func(t *testing.T) {
+		f := useTestFrame(16, 8)
+
+		Mask{X: 12, Y: -4, Width: 100, Height: 8}.Process(&f)
+
+		if f.Data[15] != f.Data[12] || f.Data[3*16+12] != f.Data[12] {
+			t.Errorf("block not match %d %d", f.Data[15], f.Data[12])
+		}
+		if f.Data[4*16+15] != 15 {
+			t.Errorf("outside changed %d", f.Data[4*16+15])
+		}
+	})
+
+	t.Run("should fill, because mode is not pixelate", func(t *testing.T) {
+		for _, mode := range []string{MaskModeFill, "blur"} {
+			f := useTestFrame(16, 8)
+
+			Mask{X: 2, Y: 2, Width: 4, Height: 4, Mode: mode}.Process(&f)
+
+			if f.Data[2*16+2] != ColorBlack.Y || f.Data[5*16+5] != ColorBlack.Y {
+				t.Errorf("%s not filled %d", mode, f.Data[2*16+2])
+			}
+		}
+	})
+}
+
+func TestOverlay(t *testing.T) {
+	t.Run("should draw text with time", func(t *testing.T) {
+		now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+		o := Overlay{X: 2, Y: 2, Scale: 1, Text: "OP " + OverlayTime, now: func() time.Time { return now }}
+
+		f := useTestFrame(160, 16)
+		o.Process(&f)
+
+		e := useTestFrame(160, 16)
+		w, h := TextSize("OP 2024-01-02 03:04:05", 1)
+		e.FillRect(2, 2, w+2, h+2, ColorBlack)
+		e.DrawText(3, 3, 1, "OP 2024-01-02 03:04:05", ColorWhite)
+
+		if string(f.Data) != string(e.Data) {
+			t.Errorf("overlay not match")
+		}
+	})
+
+	t.Run("should run chain in order", func(t *testing.T) {
+		f := useTestFrame(16, 8)
+
+		Chain{
+			Overlay{Text: "1"},
+			Mask{X: 0, Y: 0, Width: 16, Height: 8, Mode: MaskModeFill},
+		}.Process(&f)
+
+		for i, v := range f.Data[:128] {
+			if v != ColorBlack.Y {
+				t.Fatalf("y at %d not match %d", i, v)
+			}
+		}
+	})
+}
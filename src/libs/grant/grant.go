@@ -0,0 +1,108 @@
+package grant
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// roles of a session, a role has the permissions of lower ones
+const (
+	RoleView    = "view"
+	RoleControl = "control"
+	RoleAdmin   = "admin"
+)
+
+var roles = []string{RoleView, RoleControl, RoleAdmin}
+
+// codes of grant errors
+const (
+	GrantErrorInvalid = "grant-invalid"
+	GrantErrorExpired = "grant-expired"
+)
+
+type GrantError struct {
+	Code    string
+	Message string
+}
+
+func (e *GrantError) Error() string {
+	return fmt.Sprintf("grant %s %s", e.Code, e.Message)
+}
+
+func newGrantError(code string, format string, a ...any) *GrantError {
+	return &GrantError{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+// grant of a session, signed by the server, device is the device id, expires at is unix seconds
+type Grant struct {
+	Role      string `json:"role"`
+	Device    string `json:"device"`
+	Subject   string `json:"sub,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func ValidRole(role string) bool {
+	return slices.Contains(roles, role)
+}
+
+// role has the permissions of required role
+func RoleAllows(role string, required string) bool {
+	return slices.Index(roles, role) >= slices.Index(roles, required) && ValidRole(role)
+}
+
+func sign(payload string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sign grant, the token is base64url json payload and base64url hmac sha256 of it, joined by dot
+func Sign(g Grant, key []byte) (string, error) {
+	b, err := json.Marshal(g)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(b)
+
+	return payload + "." + sign(payload, key), nil
+}
+
+// verify token of the device at now
+func Verify(token string, key []byte, device string, now time.Time) (Grant, error) {
+	g := Grant{}
+
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return g, newGrantError(GrantErrorInvalid, "malformed")
+	} else if !hmac.Equal([]byte(signature), []byte(sign(payload, key))) {
+		return g, newGrantError(GrantErrorInvalid, "signature mismatch")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return g, newGrantError(GrantErrorInvalid, "payload %v", err)
+	}
+
+	err = json.Unmarshal(b, &g)
+	if err != nil {
+		return g, newGrantError(GrantErrorInvalid, "payload %v", err)
+	}
+
+	if !ValidRole(g.Role) {
+		return g, newGrantError(GrantErrorInvalid, "unknown role %s", g.Role)
+	} else if g.Device != device {
+		return g, newGrantError(GrantErrorInvalid, "device %s mismatch", g.Device)
+	} else if now.Unix() >= g.ExpiresAt {
+		return g, newGrantError(GrantErrorExpired, "expired at %d", g.ExpiresAt)
+	}
+
+	return g, nil
+}
@@ -0,0 +1,94 @@
+package grant
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("secret")
+
+func useTestToken(t *testing.T, g Grant) string {
+	token, err := Sign(g, testKey)
+	if err != nil {
+		t.Fatalf("sign error %v", err)
+	}
+
+	return token
+}
+
+func TestGrant(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	t.Run("should verify signed grant", func(t *testing.T) {
+		token := useTestToken(t, Grant{Role: RoleControl, Device: "d1", Subject: "u1", ExpiresAt: 2000})
+
+		g, err := Verify(token, testKey, "d1", now)
+		if err != nil {
+			t.Fatalf("verify error %v", err)
+		}
+		if g.Role != RoleControl || g.Subject != "u1" {
+			t.Errorf("grant not match %+v", g)
+		}
+	})
+
+	cases := []struct {
+		name  string
+		token func() string
+		code  string
+	}{
+		{
+			"should be invalid, because key is another",
+			func() string {
+				token, _ := Sign(Grant{Role: RoleAdmin, Device: "d1", ExpiresAt: 2000}, []byte("other"))
+				return token
+			},
+			GrantErrorInvalid,
+		},
+		{
+			"should be invalid, because device is another",
+			func() string { return useTestToken(t, Grant{Role: RoleAdmin, Device: "d2", ExpiresAt: 2000}) },
+			GrantErrorInvalid,
+		},
+		{
+			"should be invalid, because role is unknown",
+			func() string { return useTestToken(t, Grant{Role: "root", Device: "d1", ExpiresAt: 2000}) },
+			GrantErrorInvalid,
+		},
+		{
+			"should be invalid, because malformed",
+			func() string { return "token" },
+			GrantErrorInvalid,
+		},
+		{
+			"should be expired",
+			func() string { return useTestToken(t, Grant{Role: RoleAdmin, Device: "d1", ExpiresAt: 1000}) },
+			GrantErrorExpired,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := Verify(c.token(), testKey, "d1", now)
+
+			var ge *GrantError
+			if !errors.As(err, &ge) || ge.Code != c.code {
+				t.Errorf("error not match %v %s", err, c.code)
+			}
+		})
+	}
+}
+
+func TestRole(t *testing.T) {
+	t.Run("should allow lower roles", func(t *testing.T) {
+		if !RoleAllows(RoleAdmin, RoleControl) || !RoleAllows(RoleControl, RoleControl) || !RoleAllows(RoleControl, RoleView) {
+			t.Errorf("should allow")
+		}
+	})
+
+	t.Run("should not allow higher or unknown roles", func(t *testing.T) {
+		if RoleAllows(RoleView, RoleControl) || RoleAllows(RoleControl, RoleAdmin) || RoleAllows("root", RoleView) {
+			t.Errorf("should not allow")
+		}
+	})
+}
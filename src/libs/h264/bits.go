@@ -0,0 +1,181 @@
+package h264
+
+import "fmt"
+
+// remove emulation prevention bytes, 0x000003 to 0x0000
+func RBSP(nalu []byte) []byte {
+	b := make([]byte, 0, len(nalu))
+
+	zeros := 0
+	for _, v := range nalu {
+		if zeros >= 2 && v == 0x03 {
+			zeros = 0
+			continue
+		}
+
+		if v == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		b = append(b, v)
+	}
+
+	return b
+}
+
+// bit reader with exp golomb
+type bitReader struct {
+	b      []byte
+	offset int
+}
+
+func (r *bitReader) bit() (uint, error) {
+	if r.offset >= len(r.b)*8 {
+		return 0, fmt.Errorf("h264 bit reader out of range")
+	}
+
+	v := (r.b[r.offset/8] >> (7 - r.offset%8)) & 1
+	r.offset++
+
+	return uint(v), nil
+}
+
+func (r *bitReader) bits(n int) (uint, error) {
+	v := uint(0)
+	for range n {
+		b, err := r.bit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | b
+	}
+
+	return v, nil
+}
+
+func (r *bitReader) skip(n int) error {
+	_, err := r.bits(n)
+	return err
+}
+
+// unsigned exp golomb
+func (r *bitReader) ue() (uint, error) {
+	zeros := 0
+	for {
+		b, err := r.bit()
+		if err != nil {
+			return 0, err
+		} else if b == 1 {
+			break
+		}
+
+		zeros++
+		if zeros > 31 {
+			return 0, fmt.Errorf("h264 bit reader invalid exp golomb")
+		}
+	}
+
+	v, err := r.bits(zeros)
+	if err != nil {
+		return 0, err
+	}
+
+	return (1 << zeros) - 1 + v, nil
+}
+
+// signed exp golomb
+func (r *bitReader) se() (int, error) {
+	v, err := r.ue()
+	if err != nil {
+		return 0, err
+	}
+
+	if v%2 == 1 {
+		return int(v+1) / 2, nil
+	}
+	return -int(v / 2), nil
+}
+
+// add emulation prevention bytes, 0x0000 followed by 0x00 to 0x03
+func EBSP(rbsp []byte) []byte {
+	b := make([]byte, 0, len(rbsp)+len(rbsp)/64)
+
+	zeros := 0
+	for _, v := range rbsp {
+		if zeros >= 2 && v <= 0x03 {
+			b = append(b, 0x03)
+			zeros = 0
+		}
+
+		if v == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		b = append(b, v)
+	}
+
+	return b
+}
+
+// bit writer with exp golomb
+type bitWriter struct {
+	b      []byte
+	offset int
+}
+
+func (w *bitWriter) bit(v uint) {
+	if w.offset%8 == 0 {
+		w.b = append(w.b, 0)
+	}
+	if v&1 == 1 {
+		w.b[len(w.b)-1] |= 1 << (7 - w.offset%8)
+	}
+	w.offset++
+}
+
+func (w *bitWriter) bits(v uint, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.bit(v >> i)
+	}
+}
+
+// unsigned exp golomb
+func (w *bitWriter) ue(v uint) {
+	v++
+	n := 0
+	for (v >> n) > 1 {
+		n++
+	}
+	w.bits(0, n)
+	w.bits(v, n+1)
+}
+
+// signed exp golomb
+func (w *bitWriter) se(v int) {
+	if v > 0 {
+		w.ue(uint(v)*2 - 1)
+	} else {
+		w.ue(uint(-v) * 2)
+	}
+}
+
+// zero bits to byte aligned
+func (w *bitWriter) align() {
+	for w.offset%8 != 0 {
+		w.bit(0)
+	}
+}
+
+// append bytes, writer must be byte aligned
+func (w *bitWriter) bytes(b []byte) {
+	w.b = append(w.b, b...)
+	w.offset += len(b) * 8
+}
+
+// rbsp stop bit and alignment
+func (w *bitWriter) trailing() {
+	w.bit(1)
+	w.align()
+}
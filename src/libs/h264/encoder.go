@@ -0,0 +1,331 @@
+package h264
+
+import (
+	"fmt"
+
+	"device-go/src/libs/frame"
+)
+
+// minimal h264 encoder, constrained baseline with cavlc
+//
+// changed macroblocks are coded as I_PCM and unchanged macroblocks are skipped,
+// it is lossless and only cheap for mostly static content like test patterns
+
+const (
+	encoderProfileIdc = 66
+	// constraint set 0 and 1, constrained baseline
+	encoderConstraintFlags = 0xc0
+
+	encoderLog2MaxFrameNum = 4
+
+	encoderSliceTypeP = 5
+	encoderSliceTypeI = 7
+
+	encoderMbTypeIPCM  = 25
+	encoderMbTypePIPCM = 30
+)
+
+// level by max frame size in macroblocks
+var encoderLevels = []struct {
+	idc uint
+	mbs int
+}{
+	{30, 1620},
+	{31, 3600},
+	{32, 5120},
+	{40, 8192},
+	{50, 22080},
+	{51, 36864},
+}
+
+type Encoder struct {
+	width    uint
+	height   uint
+	mbWidth  int
+	mbHeight int
+	gop      uint
+
+	sps []byte
+	pps []byte
+
+	// last encoded frame, it is the reference of the next one
+	last     []byte
+	count    uint
+	frameNum uint
+	idrPicID uint
+	forceKey bool
+}
+
+// create encoder, gop 0 means only the first frame is key frame
+func NewEncoder(width uint, height uint, gop uint) (Encoder, error) {
+	if width == 0 || height == 0 || width%2 != 0 || height%2 != 0 {
+		return Encoder{}, fmt.Errorf("h264 encoder invalid size %dx%d", width, height)
+	}
+
+	e := Encoder{
+		width:    width,
+		height:   height,
+		mbWidth:  int(width+15) / 16,
+		mbHeight: int(height+15) / 16,
+		gop:      gop,
+	}
+
+	level := uint(0)
+	for _, l := range encoderLevels {
+		if e.mbWidth*e.mbHeight <= l.mbs {
+			level = l.idc
+			break
+		}
+	}
+	if level == 0 {
+		return Encoder{}, fmt.Errorf("h264 encoder size too large %dx%d", width, height)
+	}
+
+	e.sps = e.createSPS(level)
+	e.pps = e.createPPS()
+
+	return e, nil
+}
+
+func (e *Encoder) createSPS(level uint) []byte {
+	w := bitWriter{}
+	w.bits(0x67, 8) // nal header
+	w.bits(encoderProfileIdc, 8)
+	w.bits(encoderConstraintFlags, 8)
+	w.bits(level, 8)
+	w.ue(0)                          // sps id
+	w.ue(encoderLog2MaxFrameNum - 4) // log2 max frame num
+	w.ue(2)                          // poc type, output order is decode order
+	w.ue(1)                          // max num ref frames
+	w.bit(0)                         // gaps
+	w.ue(uint(e.mbWidth - 1))
+	w.ue(uint(e.mbHeight - 1))
+	w.bit(1) // frame mbs only
+	w.bit(1) // direct 8x8
+
+	// crop to frame size, unit is 2 pixels
+	cropRight := (uint(e.mbWidth*16) - e.width) / 2
+	cropBottom := (uint(e.mbHeight*16) - e.height) / 2
+	if cropRight > 0 || cropBottom > 0 {
+		w.bit(1)
+		w.ue(0)
+		w.ue(cropRight)
+		w.ue(0)
+		w.ue(cropBottom)
+	} else {
+		w.bit(0)
+	}
+
+	w.bit(0) // vui
+	w.trailing()
+
+	return EBSP(w.b)
+}
+
+func (e *Encoder) createPPS() []byte {
+	w := bitWriter{}
+	w.bits(0x68, 8) // nal header
+	w.ue(0)         // pps id
+	w.ue(0)         // sps id
+	w.bit(0)        // cavlc
+	w.bit(0)        // bottom field pic order
+	w.ue(0)         // slice groups
+	w.ue(0)         // num ref idx l0
+	w.ue(0)         // num ref idx l1
+	w.bit(0)        // weighted pred
+	w.bits(0, 2)    // weighted bipred
+	w.se(0)         // pic init qp
+	w.se(0)         // pic init qs
+	w.se(0)         // chroma qp index offset
+	w.bit(1)        // deblocking filter control
+	w.bit(0)        // constrained intra pred
+	w.bit(0)        // redundant pic cnt
+	w.trailing()
+
+	return EBSP(w.b)
+}
+
+func (e *Encoder) SPS() []byte {
+	return e.sps
+}
+
+func (e *Encoder) PPS() []byte {
+	return e.pps
+}
+
+// next frame is key frame
+func (e *Encoder) ForceKeyFrame() {
+	e.forceKey = true
+}
+
+// is macroblock same as the last frame
+func (e *Encoder) mbEqual(data []byte, mx int, my int) bool {
+	w := int(e.width)
+	h := int(e.height)
+
+	x0 := mx * 16
+	x1 := min(x0+16, w)
+	for y := my * 16; y < min(my*16+16, h); y++ {
+		row := y * w
+		for x := x0; x < x1; x++ {
+			if data[row+x] != e.last[row+x] {
+				return false
+			}
+		}
+	}
+
+	uv := w * h
+	for y := my * 8; y < min(my*8+8, h/2); y++ {
+		row := uv + y*w
+		for x := x0; x < x1; x++ {
+			if data[row+x] != e.last[row+x] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// 0 is not allowed for pcm samples in early versions of the spec
+func pcmSample(v byte) byte {
+	return max(v, 1)
+}
+
+func (e *Encoder) writeMbPCM(wr *bitWriter, data []byte, mx int, my int) {
+	w := int(e.width)
+	h := int(e.height)
+
+	wr.align()
+
+	// edge pixels are repeated for padding
+	b := make([]byte, 0, 384)
+
+	for r := range 16 {
+		y := min(my*16+r, h-1)
+		for c := range 16 {
+			x := min(mx*16+c, w-1)
+			b = append(b, pcmSample(data[y*w+x]))
+		}
+	}
+
+	uv := data[w*h:]
+	for plane := range 2 {
+		for r := range 8 {
+			y := min(my*8+r, h/2-1)
+			for c := range 8 {
+				x := min(mx*8+c, w/2-1)
+				b = append(b, pcmSample(uv[y*w+x*2+plane]))
+			}
+		}
+	}
+
+	wr.bytes(b)
+}
+
+func (e *Encoder) createSlice(f *frame.Frame, key bool) []byte {
+	wr := bitWriter{}
+
+	// nal header
+	if key {
+		wr.bits(0x65, 8)
+	} else {
+		wr.bits(0x41, 8)
+	}
+
+	wr.ue(0) // first mb
+	if key {
+		wr.ue(encoderSliceTypeI)
+	} else {
+		wr.ue(encoderSliceTypeP)
+	}
+	wr.ue(0) // pps id
+	wr.bits(e.frameNum, encoderLog2MaxFrameNum)
+	if key {
+		wr.ue(e.idrPicID)
+	} else {
+		wr.bit(0) // num ref idx override
+		wr.bit(0) // ref pic list modification
+	}
+
+	// dec ref pic marking
+	if key {
+		wr.bit(0) // no output of prior pics
+		wr.bit(0) // long term reference
+	} else {
+		wr.bit(0) // adaptive ref pic marking
+	}
+
+	wr.se(0) // slice qp delta
+	wr.ue(1) // disable deblocking filter
+
+	// slice data
+	skip := uint(0)
+	for my := range e.mbHeight {
+		for mx := range e.mbWidth {
+			if key {
+				wr.ue(encoderMbTypeIPCM)
+				e.writeMbPCM(&wr, f.Data, mx, my)
+				continue
+			}
+
+			if e.mbEqual(f.Data, mx, my) {
+				skip++
+				continue
+			}
+
+			wr.ue(skip)
+			skip = 0
+			wr.ue(encoderMbTypePIPCM)
+			e.writeMbPCM(&wr, f.Data, mx, my)
+		}
+	}
+	if skip > 0 {
+		wr.ue(skip)
+	}
+
+	wr.trailing()
+
+	return EBSP(wr.b)
+}
+
+// encode nv12 frame to annex b access unit, key frames have sps and pps
+func (e *Encoder) Encode(f frame.Frame) ([]byte, error) {
+	err := f.Valid()
+	if err != nil {
+		return nil, err
+	} else if f.Width != e.width || f.Height != e.height {
+		return nil, fmt.Errorf("h264 encoder frame size not match %dx%d %dx%d", f.Width, f.Height, e.width, e.height)
+	}
+
+	key := e.last == nil || e.forceKey || (e.gop > 0 && e.count >= e.gop)
+	if key {
+		e.count = 0
+		e.frameNum = 0
+		e.forceKey = false
+	}
+
+	slice := e.createSlice(&f, key)
+
+	au := []byte{}
+	if key {
+		au = append(au, 0, 0, 0, 1)
+		au = append(au, e.sps...)
+		au = append(au, 0, 0, 0, 1)
+		au = append(au, e.pps...)
+		e.idrPicID = (e.idrPicID + 1) % 2
+	}
+	au = append(au, 0, 0, 0, 1)
+	au = append(au, slice...)
+
+	// keep reference
+	if e.last == nil {
+		e.last = make([]byte, frame.Size(e.width, e.height))
+	}
+	copy(e.last, f.Data)
+
+	e.count++
+	e.frameNum = (e.frameNum + 1) % (1 << encoderLog2MaxFrameNum)
+
+	return au, nil
+}
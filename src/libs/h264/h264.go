@@ -0,0 +1,106 @@
+package h264
+
+const (
+	NALUnitTypeSlice = 1
+	NALUnitTypeIDR   = 5
+	NALUnitTypeSEI   = 6
+	NALUnitTypeSPS   = 7
+	NALUnitTypePPS   = 8
+	NALUnitTypeAUD   = 9
+)
+
+// nal unit type of the nal unit without start code
+func NALUnitType(nalu []byte) byte {
+	if len(nalu) == 0 {
+		return 0
+	}
+
+	return nalu[0] & 0x1f
+}
+
+// split annex b stream into nal units, start codes are removed
+func Split(b []byte) [][]byte {
+	nalus := [][]byte{}
+
+	start := -1
+	i := 0
+	for i+2 < len(b) {
+		// find 0x000001, 0x00000001 ends with it too
+		if b[i] != 0 || b[i+1] != 0 || b[i+2] != 1 {
+			i++
+			continue
+		}
+
+		if start >= 0 {
+			end := i
+			// trailing zero of 4 bytes start code
+			for end > start && b[end-1] == 0 {
+				end--
+			}
+			if end > start {
+				nalus = append(nalus, b[start:end])
+			}
+		}
+
+		i += 3
+		start = i
+	}
+
+	if start >= 0 && start < len(b) {
+		nalus = append(nalus, b[start:])
+	} else if start < 0 && len(b) > 0 {
+		// no start code, treat as single nal unit
+		nalus = append(nalus, b)
+	}
+
+	return nalus
+}
+
+// is access unit a key frame, it contains an idr slice
+func IsKeyFrame(b []byte) bool {
+	for _, nalu := range Split(b) {
+		if NALUnitType(nalu) == NALUnitTypeIDR {
+			return true
+		}
+	}
+
+	return false
+}
+
+// is nal unit a slice
+func isSlice(nalu []byte) bool {
+	t := NALUnitType(nalu)
+	return t == NALUnitTypeSlice || t == NALUnitTypeIDR
+}
+
+// split annex b stream into access units, every access unit keeps start codes
+//
+// a new access unit starts at a non slice nal unit after slices,
+// or at a slice which first mb is 0
+func SplitAccessUnits(b []byte) [][]byte {
+	aus := [][]byte{}
+
+	au := []byte{}
+	hasSlice := false
+	for _, nalu := range Split(b) {
+		// first mb 0 is ue bit 1, the first bit after nal header
+		first := isSlice(nalu) && len(nalu) > 1 && nalu[1]&0x80 != 0
+		if hasSlice && (!isSlice(nalu) || first) {
+			aus = append(aus, au)
+			au = []byte{}
+			hasSlice = false
+		}
+
+		au = append(au, 0, 0, 0, 1)
+		au = append(au, nalu...)
+		if isSlice(nalu) {
+			hasSlice = true
+		}
+	}
+
+	if hasSlice {
+		aus = append(aus, au)
+	}
+
+	return aus
+}
@@ -0,0 +1,492 @@
+package h264
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/pion/rtp"
+
+	"device-go/src/libs/frame"
+)
+
+// bit writer with exp golomb, for creating test sps
+type testBitWriter struct {
+	b      []byte
+	offset int
+}
+
+func (w *testBitWriter) bits(v uint, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.offset%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		if (v>>i)&1 == 1 {
+			w.b[len(w.b)-1] |= 1 << (7 - w.offset%8)
+		}
+		w.offset++
+	}
+}
+
+func (w *testBitWriter) ue(v uint) {
+	v++
+	n := 0
+	for (v >> n) > 1 {
+		n++
+	}
+	w.bits(0, n)
+	w.bits(v, n+1)
+}
+
+// baseline sps, 1920x1080 with crop bottom 8
+func useTestSPS() []byte {
+	w := testBitWriter{}
+	w.bits(0x67, 8) // nal header
+	w.bits(66, 8)   // profile
+	w.bits(0, 8)    // constraint flags
+	w.bits(40, 8)   // level
+	w.ue(0)         // sps id
+	w.ue(0)         // log2 max frame num
+	w.ue(2)         // poc type
+	w.ue(1)         // max num ref frames
+	w.bits(0, 1)    // gaps
+	w.ue(119)       // width in mbs - 1
+	w.ue(67)        // height in map units - 1
+	w.bits(1, 1)    // frame mbs only
+	w.bits(1, 1)    // direct 8x8
+	w.bits(1, 1)    // frame cropping
+	w.ue(0)
+	w.ue(0)
+	w.ue(0)
+	w.ue(4)      // bottom 4 * 2
+	w.bits(0, 1) // vui
+	w.bits(1, 1) // stop bit
+
+	return w.b
+}
+
+func TestSplit(t *testing.T) {
+	t.Run("should split 3 and 4 bytes start code", func(t *testing.T) {
+		b := []byte{
+			0, 0, 0, 1, 0x67, 0x42,
+			0, 0, 1, 0x68, 0xce,
+			0, 0, 0, 1, 0x65, 0x88, 0x00,
+		}
+
+		nalus := Split(b)
+		if len(nalus) != 3 {
+			t.Fatalf("nal units length not match %d 3", len(nalus))
+		}
+
+		types := []byte{NALUnitTypeSPS, NALUnitTypePPS, NALUnitTypeIDR}
+		for i, v := range types {
+			if NALUnitType(nalus[i]) != v {
+				t.Errorf("type at %d not match %d %d", i, NALUnitType(nalus[i]), v)
+			}
+		}
+
+		if !bytes.Equal(nalus[1], []byte{0x68, 0xce}) {
+			t.Errorf("pps not match %v", nalus[1])
+		}
+	})
+
+	t.Run("should treat data without start code as one nal unit", func(t *testing.T) {
+		nalus := Split([]byte{0x41, 0x9a})
+		if len(nalus) != 1 {
+			t.Errorf("nal units length not match %d 1", len(nalus))
+		}
+	})
+
+	t.Run("should detect key frame", func(t *testing.T) {
+		if !IsKeyFrame([]byte{0, 0, 0, 1, 0x09, 0xf0, 0, 0, 0, 1, 0x65, 0x88}) {
+			t.Errorf("should be key frame")
+		}
+		if IsKeyFrame([]byte{0, 0, 0, 1, 0x41, 0x9a}) {
+			t.Errorf("should not be key frame")
+		}
+	})
+}
+
+func TestRBSP(t *testing.T) {
+	t.Run("should remove emulation prevention", func(t *testing.T) {
+		b := RBSP([]byte{0x01, 0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x03})
+		expected := []byte{0x01, 0x00, 0x00, 0x01, 0x00, 0x00}
+
+		if !bytes.Equal(b, expected) {
+			t.Errorf("rbsp not match %v %v", b, expected)
+		}
+	})
+}
+
+func TestParseSPS(t *testing.T) {
+	t.Run("should parse size right", func(t *testing.T) {
+		sps, err := ParseSPS(useTestSPS())
+		if err != nil {
+			t.Fatalf("parse error %v", err)
+		}
+
+		if sps.Width != 1920 || sps.Height != 1080 {
+			t.Errorf("size not match %dx%d 1920x1080", sps.Width, sps.Height)
+		}
+		if sps.ProfileIdc != 66 || sps.LevelIdc != 40 {
+			t.Errorf("profile level not match %d %d", sps.ProfileIdc, sps.LevelIdc)
+		}
+	})
+
+	t.Run("should be error, because not sps", func(t *testing.T) {
+		_, err := ParseSPS([]byte{0x68, 0xce})
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+
+	t.Run("should be error, because data not enough", func(t *testing.T) {
+		_, err := ParseSPS(useTestSPS()[:6])
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+}
+
+func TestParameterSets(t *testing.T) {
+	sps := []byte{0x67, 0x42}
+	pps := []byte{0x68, 0xce}
+	idr := []byte{0x65, 0x88}
+
+	join := func(nalus ...[]byte) []byte {
+		b := []byte{}
+		for _, v := range nalus {
+			b = append(b, 0, 0, 0, 1)
+			b = append(b, v...)
+		}
+		return b
+	}
+
+	ps := ParameterSets{}
+
+	t.Run("should keep access unit before parameter sets", func(t *testing.T) {
+		au := join(idr)
+		if !bytes.Equal(ps.Prepend(au), au) {
+			t.Errorf("access unit changed")
+		}
+	})
+
+	t.Run("should keep access unit with parameter sets", func(t *testing.T) {
+		au := join(sps, pps, idr)
+		if !bytes.Equal(ps.Prepend(au), au) {
+			t.Errorf("access unit changed")
+		}
+	})
+
+	t.Run("should prepend parameter sets to idr", func(t *testing.T) {
+		b := ps.Prepend(join(idr))
+		if !bytes.Equal(b, join(sps, pps, idr)) {
+			t.Errorf("access unit not match %v", b)
+		}
+	})
+
+	t.Run("should keep non idr", func(t *testing.T) {
+		au := join([]byte{0x41, 0x9a})
+		if !bytes.Equal(ps.Prepend(au), au) {
+			t.Errorf("access unit changed")
+		}
+	})
+}
+
+func TestStats(t *testing.T) {
+	t.Run("should compute stats right", func(t *testing.T) {
+		s := Stats{}
+
+		key := append([]byte{0, 0, 0, 1}, useTestSPS()...)
+		key = append(key, 0, 0, 0, 1, 0x65, 0x88)
+		delta := []byte{0, 0, 0, 1, 0x41, 0x9a, 0x00, 0x00, 0x01, 0x02}
+
+		// 30 fps, key frame every 30 frames
+		for i := range 91 {
+			ts := uint64(i) * 1000 * 1000 / 30
+			if i%30 == 0 {
+				s.Update(ts, key)
+			} else {
+				s.Update(ts, delta)
+			}
+		}
+
+		r := s.Report()
+		if r.Frames != 91 || r.KeyFrames != 4 {
+			t.Errorf("frames not match %d %d", r.Frames, r.KeyFrames)
+		}
+		if math.Abs(r.FPS-30) > 0.5 {
+			t.Errorf("fps not match %f 30", r.FPS)
+		}
+		if math.Abs(r.KeyFrameInterval-1) > 0.01 {
+			t.Errorf("key frame interval not match %f 1", r.KeyFrameInterval)
+		}
+		if r.Width != 1920 || r.Height != 1080 {
+			t.Errorf("size not match %dx%d", r.Width, r.Height)
+		}
+		if r.Bitrate <= 0 {
+			t.Errorf("bitrate not positive %f", r.Bitrate)
+		}
+
+		s.Reset()
+		if s.Report().Frames != 0 {
+			t.Errorf("reset not clear frames")
+		}
+	})
+}
+
+// decode slice of the test encoder, returns padded y, u, v planes
+func useTestDecode(t *testing.T, nalu []byte, mbWidth int, mbHeight int, ref [3][]byte) [3][]byte {
+	r := bitReader{b: RBSP(nalu)}
+	must := func(v uint, err error) uint {
+		if err != nil {
+			t.Fatalf("decode error %v", err)
+		}
+		return v
+	}
+
+	key := NALUnitType(nalu) == NALUnitTypeIDR
+	must(r.bits(8)) // nal header
+	if must(r.ue()) != 0 {
+		t.Fatalf("first mb not 0")
+	}
+	sliceType := must(r.ue())
+	must(r.ue()) // pps id
+	must(r.bits(encoderLog2MaxFrameNum))
+	if key {
+		must(r.ue()) // idr pic id
+		must(r.bits(2))
+	} else {
+		must(r.bits(3))
+	}
+	if _, err := r.se(); err != nil {
+		t.Fatalf("decode error %v", err)
+	}
+	if must(r.ue()) != 1 {
+		t.Fatalf("deblocking not disabled")
+	}
+
+	stride := mbWidth * 16
+	planes := [3][]byte{
+		make([]byte, stride*mbHeight*16),
+		make([]byte, stride*mbHeight*16/4),
+		make([]byte, stride*mbHeight*16/4),
+	}
+
+	pcm := func(mb int) {
+		for r.offset%8 != 0 {
+			if must(r.bit()) != 0 {
+				t.Fatalf("pcm alignment bit not 0")
+			}
+		}
+
+		mx := mb % mbWidth
+		my := mb / mbWidth
+		for i := range 256 {
+			planes[0][(my*16+i/16)*stride+mx*16+i%16] = byte(must(r.bits(8)))
+		}
+		for p := 1; p < 3; p++ {
+			for i := range 64 {
+				planes[p][(my*8+i/8)*stride/2+mx*8+i%8] = byte(must(r.bits(8)))
+			}
+		}
+	}
+
+	skip := func(mb int) {
+		mx := mb % mbWidth
+		my := mb / mbWidth
+		for i := range 256 {
+			o := (my*16+i/16)*stride + mx*16 + i%16
+			planes[0][o] = ref[0][o]
+		}
+		for p := 1; p < 3; p++ {
+			for i := range 64 {
+				o := (my*8+i/8)*stride/2 + mx*8 + i%8
+				planes[p][o] = ref[p][o]
+			}
+		}
+	}
+
+	total := mbWidth * mbHeight
+	for mb := 0; mb < total; {
+		if sliceType == encoderSliceTypeP {
+			run := int(must(r.ue()))
+			for range run {
+				skip(mb)
+				mb++
+			}
+			if mb >= total {
+				break
+			}
+			if must(r.ue()) != encoderMbTypePIPCM {
+				t.Fatalf("mb type not pcm at %d", mb)
+			}
+		} else if must(r.ue()) != encoderMbTypeIPCM {
+			t.Fatalf("mb type not pcm at %d", mb)
+		}
+
+		pcm(mb)
+		mb++
+	}
+
+	// stop bit
+	if must(r.bit()) != 1 {
+		t.Fatalf("stop bit not found")
+	}
+
+	return planes
+}
+
+func TestDepacketizer(t *testing.T) {
+	usePacket := func(t *testing.T, ts uint32, marker bool, nalu []byte) []byte {
+		p := rtp.Packet{
+			Header:  rtp.Header{Version: 2, PayloadType: 96, Timestamp: ts, Marker: marker},
+			Payload: nalu,
+		}
+		b, err := p.Marshal()
+		if err != nil {
+			t.Fatalf("marshal error %v", err)
+		}
+		return b
+	}
+
+	t.Run("should extend timestamp across wrap around", func(t *testing.T) {
+		d := Depacketizer{}
+
+		d.Write(usePacket(t, 0xffffff00, true, []byte{0x41, 0x9a}))
+		_, pts, ok := d.Write(usePacket(t, 100, true, []byte{0x41, 0x9a}))
+		if !ok || pts != 0x100000000+100 {
+			t.Errorf("pts not match %d %v", pts, ok)
+		}
+	})
+
+	t.Run("should start over after reset, because the source restarted", func(t *testing.T) {
+		d := Depacketizer{}
+
+		d.Write(usePacket(t, 0xffffff00, true, []byte{0x41, 0x9a}))
+		// partial access unit of the old source
+		d.Write(usePacket(t, 0xffffff00, false, []byte{0x41, 0x01}))
+		d.Reset()
+
+		au, pts, ok := d.Write(usePacket(t, 100, true, []byte{0x41, 0x02}))
+		if !ok || pts != 100 {
+			t.Errorf("pts not match %d %v", pts, ok)
+		}
+		if !bytes.Equal(au, []byte{0, 0, 0, 1, 0x41, 0x02}) {
+			t.Errorf("access unit not match %x", au)
+		}
+	})
+}
+
+func TestEncoder(t *testing.T) {
+	const width = 40
+	const height = 20
+
+	useFrame := func(n int) frame.Frame {
+		f := frame.NewFrame(width, height)
+		f.FillRect(0, 0, width/2, height, frame.NewColor(255, 255, 0))
+		f.FillRect(n*2, 4, 6, 6, frame.ColorWhite)
+		// zeros for emulation prevention
+		f.FillRect(24, 12, 4, 4, frame.Color{})
+		return f
+	}
+
+	e, err := NewEncoder(width, height, 3)
+	if err != nil {
+		t.Fatalf("new encoder error %v", err)
+	}
+
+	t.Run("should create parsable sps", func(t *testing.T) {
+		sps, err := ParseSPS(e.SPS())
+		if err != nil {
+			t.Fatalf("parse error %v", err)
+		}
+		if sps.Width != width || sps.Height != height {
+			t.Errorf("size not match %dx%d", sps.Width, sps.Height)
+		}
+	})
+
+	t.Run("should encode and decode lossless", func(t *testing.T) {
+		mbWidth := (width + 15) / 16
+		mbHeight := (height + 15) / 16
+		stride := mbWidth * 16
+
+		ref := [3][]byte{}
+		for n := range 5 {
+			f := useFrame(n)
+
+			au, err := e.Encode(f)
+			if err != nil {
+				t.Fatalf("encode error %v", err)
+			}
+
+			nalus := Split(au)
+			if key := n%3 == 0; IsKeyFrame(au) != key {
+				t.Fatalf("frame %d key not match %v", n, key)
+			} else if key && len(nalus) != 3 {
+				t.Fatalf("frame %d key frame nal units %d", n, len(nalus))
+			}
+
+			ref = useTestDecode(t, nalus[len(nalus)-1], mbWidth, mbHeight, ref)
+
+			for y := range height {
+				for x := range width {
+					if ref[0][y*stride+x] != pcmSample(f.Data[y*width+x]) {
+						t.Fatalf("frame %d y at %d,%d not match", n, x, y)
+					}
+				}
+			}
+			uv := f.Data[width*height:]
+			for y := range height / 2 {
+				for x := range width / 2 {
+					if ref[1][y*stride/2+x] != pcmSample(uv[y*width+x*2]) || ref[2][y*stride/2+x] != pcmSample(uv[y*width+x*2+1]) {
+						t.Fatalf("frame %d uv at %d,%d not match", n, x, y)
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("should be error, because size not match", func(t *testing.T) {
+		_, err := e.Encode(frame.NewFrame(8, 8))
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+}
+
+func TestSplitAccessUnits(t *testing.T) {
+	t.Run("should split by first mb", func(t *testing.T) {
+		b := []byte{
+			0, 0, 0, 1, 0x67, 0x42,
+			0, 0, 0, 1, 0x68, 0xce,
+			0, 0, 0, 1, 0x65, 0x88, // first mb 0
+			0, 0, 0, 1, 0x65, 0x40, // first mb 1, same access unit
+			0, 0, 0, 1, 0x41, 0x9a,
+			0, 0, 0, 1, 0x41, 0x9b,
+		}
+
+		aus := SplitAccessUnits(b)
+		if len(aus) != 3 {
+			t.Fatalf("access units length not match %d 3", len(aus))
+		}
+		if len(Split(aus[0])) != 4 || !IsKeyFrame(aus[0]) {
+			t.Errorf("first access unit not match %v", aus[0])
+		}
+	})
+}
+
+func TestEBSP(t *testing.T) {
+	t.Run("should add emulation prevention", func(t *testing.T) {
+		rbsp := []byte{0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x04}
+		b := EBSP(rbsp)
+		expected := []byte{0x01, 0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x03, 0x00, 0x04}
+
+		if !bytes.Equal(b, expected) {
+			t.Errorf("ebsp not match %v %v", b, expected)
+		}
+		if !bytes.Equal(RBSP(b), rbsp) {
+			t.Errorf("rbsp not match %v", RBSP(b))
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package h264
+
+import "fmt"
+
+// sequence parameter set, only the fields we use
+type SPS struct {
+	ProfileIdc      uint
+	ConstraintFlags uint
+	LevelIdc        uint
+	Width           uint
+	Height          uint
+}
+
+// profiles with chroma format and scaling matrix
+var spsHighProfiles = map[uint]bool{
+	100: true, 110: true, 122: true, 244: true, 44: true, 83: true,
+	86: true, 118: true, 128: true, 138: true, 139: true, 134: true, 135: true,
+}
+
+func skipScalingList(r *bitReader, size int) error {
+	last := 8
+	next := 8
+	for range size {
+		if next != 0 {
+			delta, err := r.se()
+			if err != nil {
+				return err
+			}
+			next = (last + delta + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+
+	return nil
+}
+
+// parse sps nal unit, with nal header
+//
+// https://www.itu.int/rec/T-REC-H.264 7.3.2.1.1
+func ParseSPS(nalu []byte) (SPS, error) {
+	sps := SPS{}
+
+	if NALUnitType(nalu) != NALUnitTypeSPS {
+		return sps, fmt.Errorf("h264 not sps nal unit %d", NALUnitType(nalu))
+	}
+
+	r := bitReader{b: RBSP(nalu[1:])}
+
+	var err error
+	read := func(n int) uint {
+		if err != nil {
+			return 0
+		}
+		var v uint
+		v, err = r.bits(n)
+		return v
+	}
+	ue := func() uint {
+		if err != nil {
+			return 0
+		}
+		var v uint
+		v, err = r.ue()
+		return v
+	}
+	se := func() int {
+		if err != nil {
+			return 0
+		}
+		var v int
+		v, err = r.se()
+		return v
+	}
+
+	sps.ProfileIdc = read(8)
+	sps.ConstraintFlags = read(8)
+	sps.LevelIdc = read(8)
+	ue() // sps id
+
+	chromaFormatIdc := uint(1)
+	separateColourPlane := uint(0)
+	if spsHighProfiles[sps.ProfileIdc] {
+		chromaFormatIdc = ue()
+		if chromaFormatIdc == 3 {
+			separateColourPlane = read(1)
+		}
+		ue()    // bit depth luma
+		ue()    // bit depth chroma
+		read(1) // qpprime y zero transform bypass
+
+		if read(1) == 1 {
+			n := 8
+			if chromaFormatIdc == 3 {
+				n = 12
+			}
+			for i := range n {
+				if read(1) == 0 || err != nil {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				err = skipScalingList(&r, size)
+			}
+		}
+	}
+
+	ue() // log2 max frame num
+
+	switch ue() {
+	case 0:
+		ue() // log2 max pic order cnt lsb
+	case 1:
+		read(1) // delta pic order always zero
+		se()    // offset for non ref pic
+		se()    // offset for top to bottom field
+		n := ue()
+		for range n {
+			se()
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	ue()    // max num ref frames
+	read(1) // gaps in frame num value allowed
+
+	widthInMbs := ue() + 1
+	heightInMapUnits := ue() + 1
+	frameMbsOnly := read(1)
+	if frameMbsOnly == 0 {
+		read(1) // mb adaptive frame field
+	}
+	read(1) // direct 8x8 inference
+
+	cropLeft, cropRight, cropTop, cropBottom := uint(0), uint(0), uint(0), uint(0)
+	if read(1) == 1 {
+		cropLeft = ue()
+		cropRight = ue()
+		cropTop = ue()
+		cropBottom = ue()
+	}
+
+	if err != nil {
+		return sps, err
+	}
+
+	// crop unit
+	cropUnitX := uint(1)
+	cropUnitY := 2 - frameMbsOnly
+	if chromaFormatIdc != 0 && separateColourPlane == 0 {
+		subWidthC, subHeightC := uint(2), uint(2)
+		if chromaFormatIdc == 2 {
+			subHeightC = 1
+		} else if chromaFormatIdc == 3 {
+			subWidthC, subHeightC = 1, 1
+		}
+		cropUnitX = subWidthC
+		cropUnitY = subHeightC * (2 - frameMbsOnly)
+	}
+
+	width := widthInMbs * 16
+	height := (2 - frameMbsOnly) * heightInMapUnits * 16
+	cropX := cropUnitX * (cropLeft + cropRight)
+	cropY := cropUnitY * (cropTop + cropBottom)
+	if cropX >= width || cropY >= height {
+		return sps, fmt.Errorf("h264 sps invalid crop %d %d", cropX, cropY)
+	}
+
+	sps.Width = width - cropX
+	sps.Height = height - cropY
+
+	return sps, nil
+}
@@ -0,0 +1,223 @@
+package h264
+
+import (
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+)
+
+var startCode = []byte{0, 0, 0, 1}
+
+// cache the latest sps and pps, prepend them to idr access unit without them
+//
+// new viewers could decode from the next idr, even the encoder only sends parameter sets once
+type ParameterSets struct {
+	SPS []byte
+	PPS []byte
+}
+
+// update parameter sets, returns access unit with parameter sets
+func (ps *ParameterSets) Prepend(au []byte) []byte {
+	hasSPS := false
+	hasPPS := false
+	idr := false
+
+	for _, nalu := range Split(au) {
+		switch NALUnitType(nalu) {
+		case NALUnitTypeSPS:
+			ps.SPS = append([]byte{}, nalu...)
+			hasSPS = true
+		case NALUnitTypePPS:
+			ps.PPS = append([]byte{}, nalu...)
+			hasPPS = true
+		case NALUnitTypeIDR:
+			idr = true
+		}
+	}
+
+	if !idr || (hasSPS && hasPPS) || ps.SPS == nil || ps.PPS == nil {
+		return au
+	}
+
+	b := make([]byte, 0, len(au)+len(ps.SPS)+len(ps.PPS)+8)
+	if !hasSPS {
+		b = append(b, startCode...)
+		b = append(b, ps.SPS...)
+	}
+	if !hasPPS {
+		b = append(b, startCode...)
+		b = append(b, ps.PPS...)
+	}
+	b = append(b, au...)
+
+	return b
+}
+
+// stream statistics window
+const statsWindow = 2 * 1000 * 1000
+
+type statsFrame struct {
+	timestamp uint64
+	size      int
+}
+
+type StatsReport struct {
+	Frames    uint64 `json:"frames"`
+	KeyFrames uint64 `json:"keyFrames"`
+	Bytes     uint64 `json:"bytes"`
+
+	// in the recent window
+	FPS     float64 `json:"fps"`
+	Bitrate float64 `json:"bitrate"`
+
+	// seconds between the last two key frames
+	KeyFrameInterval float64 `json:"keyFrameInterval"`
+
+	Width      uint `json:"width"`
+	Height     uint `json:"height"`
+	ProfileIdc uint `json:"profileIdc"`
+	LevelIdc   uint `json:"levelIdc"`
+}
+
+// stream statistics, timestamps are in microseconds
+type Stats struct {
+	report  StatsReport
+	window  []statsFrame
+	lastKey uint64
+	mu      sync.Mutex
+}
+
+func (s *Stats) Update(timestamp uint64, au []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.report.Frames++
+	s.report.Bytes += uint64(len(au))
+
+	for _, nalu := range Split(au) {
+		switch NALUnitType(nalu) {
+		case NALUnitTypeSPS:
+			sps, err := ParseSPS(nalu)
+			if err != nil {
+				continue
+			}
+			s.report.Width = sps.Width
+			s.report.Height = sps.Height
+			s.report.ProfileIdc = sps.ProfileIdc
+			s.report.LevelIdc = sps.LevelIdc
+		case NALUnitTypeIDR:
+			if s.report.KeyFrames > 0 && timestamp > s.lastKey {
+				s.report.KeyFrameInterval = float64(timestamp-s.lastKey) / 1000 / 1000
+			}
+			s.report.KeyFrames++
+			s.lastKey = timestamp
+		}
+	}
+
+	// drop frames out of window, or the timestamp jumps back
+	s.window = append(s.window, statsFrame{timestamp: timestamp, size: len(au)})
+	i := 0
+	for i < len(s.window) && (s.window[i].timestamp+statsWindow < timestamp || s.window[i].timestamp > timestamp) {
+		i++
+	}
+	s.window = s.window[i:]
+
+	if len(s.window) < 2 {
+		s.report.FPS = 0
+		s.report.Bitrate = 0
+		return
+	}
+
+	span := float64(s.window[len(s.window)-1].timestamp-s.window[0].timestamp) / 1000 / 1000
+	if span <= 0 {
+		return
+	}
+
+	// the first frame starts the span
+	bytes := 0
+	for _, f := range s.window[1:] {
+		bytes += f.size
+	}
+
+	s.report.FPS = float64(len(s.window)-1) / span
+	s.report.Bitrate = float64(bytes*8) / span
+}
+
+func (s *Stats) Report() StatsReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.report
+}
+
+func (s *Stats) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.report = StatsReport{}
+	s.window = nil
+	s.lastKey = 0
+}
+
+// merge h264 rtp packets into annex b access units
+//
+// reset it when the source restarts, the new source has another timestamp base
+type Depacketizer struct {
+	mu     sync.Mutex
+	packet codecs.H264Packet
+	au     []byte
+
+	// extended 90kHz timestamp
+	ts    uint32
+	pts   uint64
+	valid bool
+}
+
+// write rtp packet, returns access unit and its 90kHz timestamp at the marker packet
+func (d *Depacketizer) Write(b []byte) ([]byte, uint64, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p := rtp.Packet{}
+	err := p.Unmarshal(b)
+	if err != nil {
+		return nil, 0, false
+	}
+
+	// extend 32 bits rtp timestamp
+	if !d.valid {
+		d.valid = true
+		d.pts = uint64(p.Timestamp)
+	} else {
+		d.pts = uint64(int64(d.pts) + int64(int32(p.Timestamp-d.ts)))
+	}
+	d.ts = p.Timestamp
+
+	nalus, err := d.packet.Unmarshal(p.Payload)
+	if err != nil {
+		return nil, 0, false
+	}
+	d.au = append(d.au, nalus...)
+
+	if !p.Marker || len(d.au) == 0 {
+		return nil, 0, false
+	}
+
+	au := d.au
+	d.au = nil
+
+	return au, d.pts, true
+}
+
+// drop the partial access unit and the timestamp, the next packet starts over
+func (d *Depacketizer) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.packet = codecs.H264Packet{}
+	d.au = nil
+	d.ts = 0
+	d.pts = 0
+	d.valid = false
+}
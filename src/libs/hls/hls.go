@@ -0,0 +1,555 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"device-go/src/libs/h264"
+	"device-go/src/libs/mp4"
+	"device-go/src/libs/server"
+)
+
+// low latency hls of a single h264 track, fmp4 segments are cut at key frames
+// and published as partial segments
+//
+// https://datatracker.ietf.org/doc/html/draft-pantos-hls-rfc8216bis
+
+const hlsVersion = 9
+
+// used when duration can not be computed, 30 fps
+const hlsDefaultDuration = mp4.Timescale / 30
+
+// blocking requests wait at most this duration
+const hlsWaitTimeout = 10 * time.Second
+
+// done segments kept in memory after they leave the playlist, for slow clients
+const hlsExtraSegments = 2
+
+// done segments listed with their parts
+const hlsPartSegments = 2
+
+type hlsSample struct {
+	pts    uint64
+	sample mp4.Sample
+}
+
+type hlsPart struct {
+	data        []byte
+	duration    uint64
+	independent bool
+}
+
+type hlsSegment struct {
+	msn      int
+	parts    []hlsPart
+	duration uint64
+}
+
+func (s *hlsSegment) data() []byte {
+	b := []byte{}
+	for _, p := range s.parts {
+		b = append(b, p.data...)
+	}
+	return b
+}
+
+type Muxer struct {
+	width  uint
+	height uint
+	// done segments in playlist
+	count int
+	// part target duration in timescale
+	partTarget uint64
+
+	mu      sync.Mutex
+	changed chan struct{}
+	closed  bool
+
+	sps         []byte
+	pps         []byte
+	init        []byte
+	initVersion int
+	// decode time of the next part, sum of sample durations since init, timestamps may go backwards
+	dts      uint64
+	sequence uint32
+
+	segments []*hlsSegment
+	current  *hlsSegment
+	nextMsn  int
+
+	pending         *hlsSample
+	samples         []mp4.Sample
+	samplesDuration uint64
+}
+
+func NewMuxer(width uint, height uint, count int, partTarget time.Duration) Muxer {
+	return Muxer{
+		width:      width,
+		height:     height,
+		count:      max(count, 1),
+		partTarget: uint64(partTarget * mp4.Timescale / time.Second),
+		changed:    make(chan struct{}),
+	}
+}
+
+// wake up waiters, with lock held
+func (m *Muxer) notify() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// reset stream, with lock held
+func (m *Muxer) reset() {
+	m.init = nil
+	m.segments = nil
+	m.current = nil
+	m.pending = nil
+	m.samples = nil
+	m.samplesDuration = 0
+}
+
+func (m *Muxer) flushPart() {
+	if len(m.samples) == 0 || m.current == nil {
+		return
+	}
+
+	m.sequence++
+	m.current.parts = append(m.current.parts, hlsPart{
+		data:        mp4.Fragment(m.sequence, m.dts, m.samples),
+		duration:    m.samplesDuration,
+		independent: m.samples[0].Key,
+	})
+	m.current.duration += m.samplesDuration
+	m.dts += m.samplesDuration
+
+	m.samples = nil
+	m.samplesDuration = 0
+
+	m.notify()
+}
+
+func (m *Muxer) flushSegment() {
+	m.flushPart()
+
+	if m.current == nil {
+		return
+	}
+
+	if len(m.current.parts) > 0 {
+		m.segments = append(m.segments, m.current)
+		if len(m.segments) > m.count+hlsExtraSegments {
+			m.segments = m.segments[len(m.segments)-m.count-hlsExtraSegments:]
+		}
+	}
+	m.current = nil
+
+	m.notify()
+}
+
+// append pending sample to part, part is flushed before it exceeds part target
+//
+// the next sample is expected to have the same duration, so part is flushed early
+func (m *Muxer) appendSample(s hlsSample) {
+	d := uint64(s.sample.Duration)
+	if len(m.samples) > 0 && m.samplesDuration+d > m.partTarget {
+		m.flushPart()
+	}
+
+	m.samples = append(m.samples, s.sample)
+	m.samplesDuration += d
+
+	if m.samplesDuration+d > m.partTarget {
+		m.flushPart()
+	}
+}
+
+// write annex b access unit, timestamp is in microseconds
+func (m *Muxer) WriteAccessUnit(timestamp uint64, au []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return
+	}
+
+	pts := timestamp * 9 / 100
+
+	var sps, pps []byte
+	key := false
+	for _, nalu := range h264.Split(au) {
+		switch h264.NALUnitType(nalu) {
+		case h264.NALUnitTypeSPS:
+			sps = nalu
+		case h264.NALUnitTypePPS:
+			pps = nalu
+		case h264.NALUnitTypeIDR:
+			key = true
+		}
+	}
+
+	// pending sample ends at this access unit
+	if m.pending != nil {
+		d := uint64(hlsDefaultDuration)
+		if pts > m.pending.pts && pts-m.pending.pts < mp4.Timescale {
+			d = pts - m.pending.pts
+		}
+		m.pending.sample.Duration = uint32(d)
+		m.appendSample(*m.pending)
+		m.pending = nil
+	}
+
+	// parameter sets changed, clients have to load the new init segment
+	if key && sps != nil && pps != nil && (string(sps) != string(m.sps) || string(pps) != string(m.pps)) {
+		m.flushSegment()
+		m.reset()
+		m.sps = sps
+		m.pps = pps
+	}
+
+	if key {
+		m.flushSegment()
+	}
+
+	// segment starts with key frame
+	if m.current == nil {
+		if !key || m.sps == nil || m.pps == nil {
+			return
+		}
+
+		if m.init == nil {
+			err := m.useInit()
+			if err != nil {
+				return
+			}
+		}
+
+		m.current = &hlsSegment{msn: m.nextMsn}
+		m.nextMsn++
+	}
+
+	m.pending = &hlsSample{
+		pts: pts,
+		sample: mp4.Sample{
+			Data: mp4.AVCC(au),
+			Key:  key,
+		},
+	}
+}
+
+func (m *Muxer) useInit() error {
+	width := m.width
+	height := m.height
+	sps, err := h264.ParseSPS(m.sps)
+	if err == nil {
+		width = sps.Width
+		height = sps.Height
+	}
+
+	init, err := mp4.Init(mp4.Track{
+		Width:  width,
+		Height: height,
+		SPS:    m.sps,
+		PPS:    m.pps,
+	})
+	if err != nil {
+		return err
+	}
+
+	m.init = init
+	m.initVersion++
+	m.dts = 0
+
+	return nil
+}
+
+// wait until ready returns true, ready is called with lock held
+func (m *Muxer) wait(ctx context.Context, ready func() bool) error {
+	timer := time.NewTimer(hlsWaitTimeout)
+	defer timer.Stop()
+
+	for {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return fmt.Errorf("hls muxer closed")
+		} else if ready() {
+			m.mu.Unlock()
+			return nil
+		}
+		changed := m.changed
+		m.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return fmt.Errorf("hls wait timeout")
+		case <-changed:
+		}
+	}
+}
+
+// find segment by msn, current segment included, with lock held
+func (m *Muxer) useSegment(msn int) *hlsSegment {
+	if m.current != nil && m.current.msn == msn {
+		return m.current
+	}
+
+	for _, s := range m.segments {
+		if s.msn == msn {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// done segments in playlist, with lock held
+func (m *Muxer) listed() []*hlsSegment {
+	if len(m.segments) > m.count {
+		return m.segments[len(m.segments)-m.count:]
+	}
+	return m.segments
+}
+
+func seconds(d uint64) float64 {
+	return float64(d) / mp4.Timescale
+}
+
+// playlist, uri query is appended to uris
+func (m *Muxer) playlist(query string) []byte {
+	segments := m.listed()
+
+	target := 1.0
+	for _, s := range segments {
+		target = max(target, math.Ceil(seconds(s.duration)))
+	}
+
+	part := seconds(m.partTarget)
+
+	b := strings.Builder{}
+	b.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&b, "#EXT-X-VERSION:%d\n", hlsVersion)
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(target))
+	fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", part*3)
+	fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", part)
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", segments[0].msn)
+	fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"init%d.mp4%s\"\n", m.initVersion, query)
+
+	writeParts := func(s *hlsSegment) {
+		for i, p := range s.parts {
+			fmt.Fprintf(&b, "#EXT-X-PART:DURATION=%.3f,URI=\"part%d.%d.m4s%s\"", seconds(p.duration), s.msn, i, query)
+			if p.independent {
+				b.WriteString(",INDEPENDENT=YES")
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	for i, s := range segments {
+		if i >= len(segments)-hlsPartSegments {
+			writeParts(s)
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n", seconds(s.duration))
+		fmt.Fprintf(&b, "seg%d.m4s%s\n", s.msn, query)
+	}
+
+	// parts of current segment, then the next part
+	msn := m.nextMsn
+	index := 0
+	if m.current != nil {
+		writeParts(m.current)
+		msn = m.current.msn
+		index = len(m.current.parts)
+	}
+	fmt.Fprintf(&b, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"part%d.%d.m4s%s\"\n", msn, index, query)
+
+	return []byte(b.String())
+}
+
+// playlist, blocks until segment msn has part, part < 0 waits the whole segment
+//
+// msn < 0 does not block, but waits the first segment
+func (m *Muxer) Playlist(ctx context.Context, msn int, part int, query string) ([]byte, error) {
+	err := m.wait(ctx, func() bool {
+		if len(m.segments) == 0 {
+			return false
+		} else if msn < 0 {
+			return true
+		} else if msn < m.segments[len(m.segments)-1].msn+1 {
+			return true
+		}
+
+		return part >= 0 && m.current != nil && (m.current.msn > msn || (m.current.msn == msn && len(m.current.parts) > part))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// reset while waiting
+	if len(m.segments) == 0 {
+		return nil, fmt.Errorf("hls stream reset")
+	}
+
+	return m.playlist(query), nil
+}
+
+// init segment of version
+func (m *Muxer) Init(version int) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.init == nil || version != m.initVersion {
+		return nil, fmt.Errorf("hls init not found %d", version)
+	}
+
+	return m.init, nil
+}
+
+// done segment
+func (m *Muxer) Segment(msn int) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.segments {
+		if s.msn == msn {
+			return s.data(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("hls segment not found %d", msn)
+}
+
+// part of segment, blocks if it is the next part
+func (m *Muxer) Part(ctx context.Context, msn int, index int) ([]byte, error) {
+	var data []byte
+
+	err := m.wait(ctx, func() bool {
+		s := m.useSegment(msn)
+		if s != nil && index < len(s.parts) {
+			data = s.parts[index].data
+			return true
+		}
+
+		// the next part of current segment, or the first part of next segment
+		next := (s != nil && s == m.current && index == len(s.parts)) || (msn == m.nextMsn && index == 0)
+		if !next {
+			data = nil
+			return true
+		}
+
+		return false
+	})
+	if err != nil {
+		return nil, err
+	} else if data == nil {
+		return nil, fmt.Errorf("hls part not found %d.%d", msn, index)
+	}
+
+	return data, nil
+}
+
+func (m *Muxer) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return
+	}
+
+	m.closed = true
+	m.reset()
+	m.notify()
+}
+
+// the query value, or -1 if it is not set
+func useQueryInt(query url.Values, key string) (int, error) {
+	v := query.Get(key)
+	if v == "" {
+		return -1, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("hls invalid %s %s", key, v)
+	}
+
+	return n, nil
+}
+
+// serve `index.m3u8`, `init{version}.mp4`, `seg{msn}.m4s` and `part{msn}.{index}.m4s`
+//
+// the token query of request is kept in playlist uris
+func (m *Muxer) Serve(w http.ResponseWriter, req *http.Request, name string) {
+	query := ""
+	if token := req.URL.Query().Get("token"); token != "" {
+		query = "?" + url.Values{"token": {token}}.Encode()
+	}
+
+	var data []byte
+	var err error
+	contentType := "video/mp4"
+	status := http.StatusNotFound
+
+	switch {
+	case name == "index.m3u8":
+		{
+			msn, err1 := useQueryInt(req.URL.Query(), "_HLS_msn")
+			part, err2 := useQueryInt(req.URL.Query(), "_HLS_part")
+			if err1 != nil || err2 != nil || (msn < 0 && part >= 0) {
+				server.WriteError(w, http.StatusBadRequest, "invalid blocking query")
+				return
+			}
+
+			contentType = "application/vnd.apple.mpegurl"
+			status = http.StatusServiceUnavailable
+			data, err = m.Playlist(req.Context(), msn, part, query)
+		}
+	case strings.HasPrefix(name, "init") && strings.HasSuffix(name, ".mp4"):
+		{
+			version := 0
+			_, err = fmt.Sscanf(name, "init%d.mp4", &version)
+			if err == nil {
+				data, err = m.Init(version)
+			}
+		}
+	case strings.HasPrefix(name, "seg") && strings.HasSuffix(name, ".m4s"):
+		{
+			msn := 0
+			_, err = fmt.Sscanf(name, "seg%d.m4s", &msn)
+			if err == nil {
+				data, err = m.Segment(msn)
+			}
+		}
+	case strings.HasPrefix(name, "part") && strings.HasSuffix(name, ".m4s"):
+		{
+			msn := 0
+			index := 0
+			_, err = fmt.Sscanf(name, "part%d.%d.m4s", &msn, &index)
+			if err == nil {
+				data, err = m.Part(req.Context(), msn, index)
+			}
+		}
+	default:
+		err = fmt.Errorf("hls unknown file %s", name)
+	}
+
+	if err != nil {
+		server.WriteError(w, status, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(data)
+}
@@ -0,0 +1,281 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"device-go/src/libs/frame"
+	"device-go/src/libs/h264"
+)
+
+// 30 fps, gop 10, part target 100ms is 3 frames
+type testStream struct {
+	t       *testing.T
+	encoder h264.Encoder
+	count   uint64
+}
+
+func useTestStream(t *testing.T) *testStream {
+	e, err := h264.NewEncoder(32, 32, 10)
+	if err != nil {
+		t.Fatalf("new encoder error %v", err)
+	}
+
+	return &testStream{t: t, encoder: e}
+}
+
+func (s *testStream) write(m *Muxer, n int) {
+	for range n {
+		f := frame.NewFrame(32, 32)
+		f.FillRect(int(s.count%32), 0, 2, 2, frame.ColorWhite)
+
+		au, err := s.encoder.Encode(f)
+		if err != nil {
+			s.t.Fatalf("encode error %v", err)
+		}
+
+		m.WriteAccessUnit(s.count*1000000/30, au)
+		s.count++
+	}
+}
+
+func useTestMuxer() *Muxer {
+	m := NewMuxer(32, 32, 3, 100*time.Millisecond)
+	return &m
+}
+
+func TestMuxer(t *testing.T) {
+	t.Run("should create playlist with segments and parts", func(t *testing.T) {
+		m := useTestMuxer()
+		useTestStream(t).write(m, 25)
+
+		b, err := m.Playlist(context.Background(), -1, -1, "")
+		if err != nil {
+			t.Fatalf("playlist error %v", err)
+		}
+		p := string(b)
+
+		for _, s := range []string{
+			"#EXT-X-MAP:URI=\"init1.mp4\"",
+			"#EXT-X-MEDIA-SEQUENCE:0",
+			"#EXT-X-PART:DURATION=0.100,URI=\"part0.0.m4s\",INDEPENDENT=YES",
+			"#EXTINF:0.333,\nseg0.m4s",
+			"#EXTINF:0.333,\nseg1.m4s",
+			"URI=\"part2.0.m4s\",INDEPENDENT=YES",
+			"#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"part2.1.m4s\"",
+		} {
+			if !strings.Contains(p, s) {
+				t.Errorf("playlist should contain %s\n%s", s, p)
+			}
+		}
+	})
+
+	t.Run("should remove old segments", func(t *testing.T) {
+		m := useTestMuxer()
+		useTestStream(t).write(m, 61)
+
+		b, _ := m.Playlist(context.Background(), -1, -1, "")
+		if !strings.Contains(string(b), "#EXT-X-MEDIA-SEQUENCE:3\n") || strings.Contains(string(b), "seg2.m4s") {
+			t.Errorf("playlist not match\n%s", b)
+		}
+
+		_, err := m.Segment(0)
+		if err == nil {
+			t.Errorf("segment 0 should be removed")
+		}
+		_, err = m.Segment(2)
+		if err != nil {
+			t.Errorf("segment 2 should be kept %v", err)
+		}
+	})
+
+	t.Run("should create segment of parts", func(t *testing.T) {
+		m := useTestMuxer()
+		useTestStream(t).write(m, 11)
+
+		s, err := m.Segment(0)
+		if err != nil {
+			t.Fatalf("segment error %v", err)
+		}
+
+		data := []byte{}
+		for i := range 4 {
+			p, err := m.Part(context.Background(), 0, i)
+			if err != nil {
+				t.Fatalf("part error %v", err)
+			}
+			if string(p[4:8]) != "moof" {
+				t.Errorf("part should start with moof")
+			}
+			data = append(data, p...)
+		}
+
+		if string(s) != string(data) {
+			t.Errorf("segment should be the parts")
+		}
+
+		init, err := m.Init(1)
+		if err != nil || string(init[4:8]) != "ftyp" {
+			t.Errorf("init not match %v", err)
+		}
+	})
+
+	t.Run("should block until the next part", func(t *testing.T) {
+		m := useTestMuxer()
+		s := useTestStream(t)
+		s.write(m, 12)
+
+		done := make(chan []byte)
+		go func() {
+			b, _ := m.Part(context.Background(), 1, 0)
+			done <- b
+		}()
+
+		select {
+		case <-done:
+			t.Fatalf("part should block")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		s.write(m, 2)
+
+		select {
+		case b := <-done:
+			if b == nil {
+				t.Errorf("part should be found")
+			}
+		case <-time.After(time.Second):
+			t.Errorf("part should be done")
+		}
+
+		_, err := m.Part(context.Background(), 5, 3)
+		if err == nil {
+			t.Errorf("part should not be found")
+		}
+	})
+
+	t.Run("should block playlist until the part", func(t *testing.T) {
+		m := useTestMuxer()
+		s := useTestStream(t)
+		s.write(m, 12)
+
+		done := make(chan string)
+		go func() {
+			b, _ := m.Playlist(context.Background(), 1, 1, "")
+			done <- string(b)
+		}()
+
+		s.write(m, 3)
+		select {
+		case <-done:
+			t.Fatalf("playlist should block")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		s.write(m, 3)
+		select {
+		case p := <-done:
+			if !strings.Contains(p, "part1.1.m4s") {
+				t.Errorf("playlist should contain part\n%s", p)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("playlist should be done")
+		}
+	})
+
+	t.Run("should keep decode time continuous, because timestamps go backwards", func(t *testing.T) {
+		m := useTestMuxer()
+		s := useTestStream(t)
+		// restart of the source, a new rtp base
+		s.count = 1000
+		s.write(m, 10)
+		s.count = 0
+		s.write(m, 11)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if len(m.segments) != 2 {
+			t.Fatalf("segments not match %d", len(m.segments))
+		}
+
+		dts := uint64(0)
+		for _, seg := range m.segments {
+			for _, p := range seg.parts {
+				i := bytes.Index(p.data, []byte("tfdt"))
+				if i < 0 {
+					t.Fatalf("part without tfdt")
+				}
+				if v := binary.BigEndian.Uint64(p.data[i+8 : i+16]); v != dts {
+					t.Errorf("decode time %d, expected %d", v, dts)
+				}
+				dts += p.duration
+			}
+		}
+	})
+
+	t.Run("should stop waiting after close", func(t *testing.T) {
+		m := useTestMuxer()
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			m.Close()
+		}()
+
+		_, err := m.Playlist(context.Background(), -1, -1, "")
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+}
+
+func TestServe(t *testing.T) {
+	m := useTestMuxer()
+	useTestStream(t).write(m, 25)
+
+	useServe := func(target string, name string) (int, string) {
+		req := httptest.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+		m.Serve(w, req, name)
+
+		return w.Code, w.Body.String()
+	}
+
+	t.Run("should keep token in playlist uris", func(t *testing.T) {
+		code, body := useServe("/hls/index.m3u8?token=abc", "index.m3u8")
+		if code != 200 {
+			t.Fatalf("status not match %d 200", code)
+		}
+		if !strings.Contains(body, "seg0.m4s?token=abc") || !strings.Contains(body, "init1.mp4?token=abc") {
+			t.Errorf("playlist should keep token\n%s", body)
+		}
+	})
+
+	t.Run("should serve files", func(t *testing.T) {
+		for _, name := range []string{"init1.mp4", "seg0.m4s", "part1.2.m4s"} {
+			code, _ := useServe("/hls/"+name, name)
+			if code != 200 {
+				t.Errorf("status not match %s %d 200", name, code)
+			}
+		}
+	})
+
+	t.Run("should be error, because not found or invalid", func(t *testing.T) {
+		for _, name := range []string{"init2.mp4", "seg9.m4s", "part0.9.m4s", "index.html"} {
+			code, _ := useServe("/hls/"+name, name)
+			if code != 404 {
+				t.Errorf("status not match %s %d 404", name, code)
+			}
+		}
+
+		code, _ := useServe("/hls/index.m3u8?_HLS_part=1", "index.m3u8")
+		if code != 400 {
+			t.Errorf("status not match %d 400", code)
+		}
+	})
+}
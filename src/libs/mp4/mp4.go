@@ -0,0 +1,295 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"device-go/src/libs/h264"
+)
+
+// fragmented mp4 with a single h264 video track
+//
+// https://www.iso.org/standard/83102.html
+
+const TrackID = 1
+
+// 90kHz, same as rtp
+const Timescale = 90000
+
+const (
+	sampleFlagsKey    = 0x02000000
+	sampleFlagsNonKey = 0x01010000
+)
+
+type Track struct {
+	Width  uint
+	Height uint
+	SPS    []byte
+	PPS    []byte
+}
+
+type Sample struct {
+	// avcc data, every nal unit has a 4 bytes length prefix
+	Data []byte
+	// duration in timescale
+	Duration uint32
+	Key      bool
+}
+
+// create box
+func box(t string, payloads ...[]byte) []byte {
+	size := 8
+	for _, p := range payloads {
+		size += len(p)
+	}
+
+	b := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(b[0:4], uint32(size))
+	copy(b[4:8], t)
+
+	for _, p := range payloads {
+		b = append(b, p...)
+	}
+
+	return b
+}
+
+// create full box, with version and flags
+func fullBox(t string, version byte, flags uint32, payloads ...[]byte) []byte {
+	vf := make([]byte, 4)
+	binary.BigEndian.PutUint32(vf, flags)
+	vf[0] = version
+
+	return box(t, append([][]byte{vf}, payloads...)...)
+}
+
+func u16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
+
+func u32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func u64(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+// unity matrix
+func matrix() []byte {
+	b := []byte{}
+	for _, v := range []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000} {
+		b = append(b, u32(v)...)
+	}
+	return b
+}
+
+func avcC(sps []byte, pps []byte) ([]byte, error) {
+	if len(sps) < 4 {
+		return nil, fmt.Errorf("mp4 sps too short %d", len(sps))
+	} else if len(pps) == 0 {
+		return nil, fmt.Errorf("mp4 empty pps")
+	}
+
+	b := []byte{
+		1,      // configuration version
+		sps[1], // profile
+		sps[2], // profile compatibility
+		sps[3], // level
+		0xff,   // 4 bytes nal unit length
+		0xe1,   // 1 sps
+	}
+	b = append(b, u16(uint16(len(sps)))...)
+	b = append(b, sps...)
+	b = append(b, 1) // 1 pps
+	b = append(b, u16(uint16(len(pps)))...)
+	b = append(b, pps...)
+
+	return box("avcC", b), nil
+}
+
+func avc1(t Track) ([]byte, error) {
+	c, err := avcC(t.SPS, t.PPS)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 78)
+	// reserved 6, data reference index
+	binary.BigEndian.PutUint16(b[6:8], 1)
+	// pre defined 2, reserved 2, pre defined 12
+	binary.BigEndian.PutUint16(b[24:26], uint16(t.Width))
+	binary.BigEndian.PutUint16(b[26:28], uint16(t.Height))
+	// 72 dpi
+	binary.BigEndian.PutUint32(b[28:32], 0x00480000)
+	binary.BigEndian.PutUint32(b[32:36], 0x00480000)
+	// reserved 4, frame count
+	binary.BigEndian.PutUint16(b[40:42], 1)
+	// compressor name 32, depth
+	binary.BigEndian.PutUint16(b[74:76], 0x0018)
+	// pre defined -1
+	binary.BigEndian.PutUint16(b[76:78], 0xffff)
+
+	return box("avc1", b, c), nil
+}
+
+// init segment, ftyp and moov
+func Init(t Track) ([]byte, error) {
+	entry, err := avc1(t)
+	if err != nil {
+		return nil, err
+	}
+
+	ftyp := box("ftyp",
+		[]byte("iso5"), u32(512),
+		[]byte("iso5"), []byte("iso6"), []byte("mp41"), []byte("avc1"),
+	)
+
+	mvhd := fullBox("mvhd", 0, 0,
+		u32(0), u32(0), // creation, modification
+		u32(1000), u32(0), // timescale, duration
+		u32(0x00010000), u16(0x0100), // rate, volume
+		make([]byte, 10), // reserved
+		matrix(),
+		make([]byte, 24), // pre defined
+		u32(TrackID+1),   // next track id
+	)
+
+	tkhd := fullBox("tkhd", 0, 0x000003,
+		u32(0), u32(0), // creation, modification
+		u32(TrackID), u32(0), u32(0), // track id, reserved, duration
+		make([]byte, 8),                // reserved
+		u16(0), u16(0), u16(0), u16(0), // layer, alternate group, volume, reserved
+		matrix(),
+		u32(uint32(t.Width)<<16), u32(uint32(t.Height)<<16),
+	)
+
+	mdhd := fullBox("mdhd", 0, 0,
+		u32(0), u32(0), // creation, modification
+		u32(Timescale), u32(0), // timescale, duration
+		u16(0x55c4), u16(0), // language und, pre defined
+	)
+
+	hdlr := fullBox("hdlr", 0, 0,
+		u32(0), []byte("vide"), make([]byte, 12), []byte("VideoHandler\x00"),
+	)
+
+	vmhd := fullBox("vmhd", 0, 1, make([]byte, 8))
+	dinf := box("dinf", fullBox("dref", 0, 0, u32(1), fullBox("url ", 0, 1)))
+
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, u32(1), entry),
+		fullBox("stts", 0, 0, u32(0)),
+		fullBox("stsc", 0, 0, u32(0)),
+		fullBox("stsz", 0, 0, u32(0), u32(0)),
+		fullBox("stco", 0, 0, u32(0)),
+	)
+
+	trak := box("trak",
+		tkhd,
+		box("mdia", mdhd, hdlr, box("minf", vmhd, dinf, stbl)),
+	)
+
+	mvex := box("mvex", fullBox("trex", 0, 0,
+		u32(TrackID), u32(1), u32(0), u32(0), u32(0),
+	))
+
+	moov := box("moov", mvhd, trak, mvex)
+
+	return append(ftyp, moov...), nil
+}
+
+// media segment, moof and mdat
+//
+// decode time is the decode time of the first sample in timescale
+func Fragment(sequence uint32, decodeTime uint64, samples []Sample) []byte {
+	mdatSize := 0
+	entries := make([]byte, 0, len(samples)*12)
+	for _, s := range samples {
+		flags := uint32(sampleFlagsNonKey)
+		if s.Key {
+			flags = sampleFlagsKey
+		}
+
+		entries = append(entries, u32(s.Duration)...)
+		entries = append(entries, u32(uint32(len(s.Data)))...)
+		entries = append(entries, u32(flags)...)
+
+		mdatSize += len(s.Data)
+	}
+
+	build := func(dataOffset uint32) []byte {
+		return box("moof",
+			fullBox("mfhd", 0, 0, u32(sequence)),
+			box("traf",
+				// default base is moof
+				fullBox("tfhd", 0, 0x020000, u32(TrackID)),
+				fullBox("tfdt", 1, 0, u64(decodeTime)),
+				// data offset, duration, size, flags
+				fullBox("trun", 0, 0x000701, u32(uint32(len(samples))), u32(dataOffset), entries),
+			),
+		)
+	}
+
+	// data offset is from moof start to mdat data
+	moof := build(0)
+	moof = build(uint32(len(moof) + 8))
+
+	b := make([]byte, 0, len(moof)+8+mdatSize)
+	b = append(b, moof...)
+	b = append(b, u32(uint32(8+mdatSize))...)
+	b = append(b, []byte("mdat")...)
+	for _, s := range samples {
+		b = append(b, s.Data...)
+	}
+
+	return b
+}
+
+// convert annex b access unit to avcc sample data, access unit delimiters are dropped
+func AVCC(au []byte) []byte {
+	b := make([]byte, 0, len(au)+16)
+
+	for _, nalu := range h264.Split(au) {
+		if h264.NALUnitType(nalu) == h264.NALUnitTypeAUD {
+			continue
+		}
+
+		b = append(b, u32(uint32(len(nalu)))...)
+		b = append(b, nalu...)
+	}
+
+	return b
+}
+
+type Writer struct {
+	w io.Writer
+
+	sequence uint32
+}
+
+func NewWriter(w io.Writer) Writer {
+	return Writer{w: w}
+}
+
+func (w *Writer) WriteInit(t Track) error {
+	b, err := Init(t)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.w.Write(b)
+	return err
+}
+
+// write a fragment, returns written size
+func (w *Writer) WriteFragment(decodeTime uint64, samples []Sample) (int, error) {
+	if len(samples) == 0 {
+		return 0, nil
+	}
+
+	w.sequence++
+
+	return w.w.Write(Fragment(w.sequence, decodeTime, samples))
+}
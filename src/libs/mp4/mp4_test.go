@@ -0,0 +1,112 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func useTestTrack() Track {
+	return Track{
+		Width:  1920,
+		Height: 1080,
+		SPS:    []byte{0x67, 0x64, 0x00, 0x28, 0xac},
+		PPS:    []byte{0x68, 0xee, 0x3c, 0x80},
+	}
+}
+
+// read top level boxes, returns types
+func useBoxTypes(t *testing.T, b []byte) []string {
+	types := []string{}
+
+	for offset := 0; offset < len(b); {
+		if len(b)-offset < 8 {
+			t.Fatalf("box header not enough at %d", offset)
+		}
+
+		size := int(binary.BigEndian.Uint32(b[offset : offset+4]))
+		if size < 8 || offset+size > len(b) {
+			t.Fatalf("box size invalid %d at %d", size, offset)
+		}
+
+		types = append(types, string(b[offset+4:offset+8]))
+		offset += size
+	}
+
+	return types
+}
+
+func TestInit(t *testing.T) {
+	t.Run("should create ftyp and moov", func(t *testing.T) {
+		b, err := Init(useTestTrack())
+		if err != nil {
+			t.Fatalf("init error %v", err)
+		}
+
+		types := useBoxTypes(t, b)
+		if len(types) != 2 || types[0] != "ftyp" || types[1] != "moov" {
+			t.Errorf("boxes not match %v", types)
+		}
+
+		if !bytes.Contains(b, []byte("avcC")) {
+			t.Errorf("avcC not found")
+		}
+	})
+
+	t.Run("should be error, because sps too short", func(t *testing.T) {
+		track := useTestTrack()
+		track.SPS = []byte{0x67}
+
+		_, err := Init(track)
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+}
+
+func TestFragment(t *testing.T) {
+	t.Run("should create moof and mdat", func(t *testing.T) {
+		samples := []Sample{
+			{Data: []byte{0, 0, 0, 2, 0x65, 0x88}, Duration: 3000, Key: true},
+			{Data: []byte{0, 0, 0, 3, 0x41, 0x9a, 0x01}, Duration: 3000},
+		}
+
+		b := Fragment(1, 0, samples)
+
+		types := useBoxTypes(t, b)
+		if len(types) != 2 || types[0] != "moof" || types[1] != "mdat" {
+			t.Fatalf("boxes not match %v", types)
+		}
+
+		// data offset points to the first sample
+		moofSize := int(binary.BigEndian.Uint32(b[0:4]))
+		i := bytes.Index(b, []byte("trun"))
+		dataOffset := int(binary.BigEndian.Uint32(b[i+12 : i+16]))
+		if dataOffset != moofSize+8 {
+			t.Errorf("data offset not match %d %d", dataOffset, moofSize+8)
+		}
+		if !bytes.Equal(b[dataOffset:dataOffset+6], samples[0].Data) {
+			t.Errorf("first sample not match %v", b[dataOffset:dataOffset+6])
+		}
+	})
+}
+
+func TestAVCC(t *testing.T) {
+	t.Run("should convert annex b right", func(t *testing.T) {
+		au := []byte{
+			0, 0, 0, 1, 0x09, 0xf0, // aud
+			0, 0, 0, 1, 0x67, 0x64, // sps
+			0, 0, 1, 0x65, 0x88, 0x84, // idr
+		}
+
+		expected := []byte{
+			0, 0, 0, 2, 0x67, 0x64,
+			0, 0, 0, 3, 0x65, 0x88, 0x84,
+		}
+
+		b := AVCC(au)
+		if !bytes.Equal(b, expected) {
+			t.Errorf("avcc not match %v %v", b, expected)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// json rpc 2.0 error codes, and codes of application
+const (
+	ErrorCodeParse          = -32700
+	ErrorCodeInvalidRequest = -32600
+	ErrorCodeMethodNotFound = -32601
+	ErrorCodeInvalidParams  = -32602
+	ErrorCodeInternal       = -32603
+
+	// the feature is not configured or not running
+	ErrorCodeUnavailable = -32000
+)
+
+const version = "2.0"
+
+// request of client, it is a notification without id, there is no response then
+type Request struct {
+	JsonRpc string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type Response struct {
+	JsonRpc string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// notification pushed by server
+type Notification struct {
+	JsonRpc string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// typed error of response, other errors of handlers are internal errors
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func NewError(code int, format string, a ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d %s", e.Code, e.Message)
+}
+
+// handler of a method, params could be empty
+type Handler func(params json.RawMessage) (any, error)
+
+// methods are registered before serving
+type Server struct {
+	handlers map[string]Handler
+}
+
+func NewServer() Server {
+	return Server{
+		handlers: map[string]Handler{},
+	}
+}
+
+func (s *Server) Handle(method string, handler Handler) {
+	s.handlers[method] = handler
+}
+
+// handle a request, response is nil of a notification
+func (s *Server) Serve(b []byte) []byte {
+	req := Request{}
+	err := json.Unmarshal(b, &req)
+	if err != nil {
+		return marshalResponse(Response{ID: json.RawMessage("null"), Error: NewError(ErrorCodeParse, "%v", err)})
+	}
+
+	res := Response{ID: req.ID}
+	if res.ID == nil {
+		res.ID = json.RawMessage("null")
+	}
+
+	if req.JsonRpc != version || req.Method == "" {
+		res.Error = NewError(ErrorCodeInvalidRequest, "invalid request")
+		return marshalResponse(res)
+	}
+
+	handler, ok := s.handlers[req.Method]
+
+	if !ok {
+		res.Error = NewError(ErrorCodeMethodNotFound, "method %s not found", req.Method)
+	} else {
+		res.Result, err = handler(req.Params)
+		if e, ok := err.(*Error); ok {
+			res.Error = e
+		} else if err != nil {
+			res.Error = NewError(ErrorCodeInternal, "%v", err)
+		} else if res.Result == nil {
+			res.Result = struct{}{}
+		}
+	}
+
+	if req.ID == nil {
+		return nil
+	}
+
+	return marshalResponse(res)
+}
+
+func marshalResponse(res Response) []byte {
+	res.JsonRpc = version
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		log.Println("rpc marshal response error", err)
+		b, _ = json.Marshal(Response{JsonRpc: version, ID: res.ID, Error: NewError(ErrorCodeInternal, "%v", err)})
+	}
+
+	return b
+}
+
+func MarshalNotification(method string, params any) ([]byte, error) {
+	return json.Marshal(Notification{JsonRpc: version, Method: method, Params: params})
+}
+
+// unmarshal params, the error is an invalid params error
+func UnmarshalParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return NewError(ErrorCodeInvalidParams, "params required")
+	}
+
+	err := json.Unmarshal(params, v)
+	if err != nil {
+		return NewError(ErrorCodeInvalidParams, "%v", err)
+	}
+
+	return nil
+}
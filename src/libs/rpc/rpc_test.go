@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func useTestServer() Server {
+	s := NewServer()
+	s.Handle("sum", func(params json.RawMessage) (any, error) {
+		p := []int{}
+		err := UnmarshalParams(params, &p)
+		if err != nil {
+			return nil, err
+		}
+
+		sum := 0
+		for _, v := range p {
+			sum += v
+		}
+		return sum, nil
+	})
+	s.Handle("fail", func(params json.RawMessage) (any, error) {
+		return nil, fmt.Errorf("failed")
+	})
+	s.Handle("ping", func(params json.RawMessage) (any, error) {
+		return nil, nil
+	})
+
+	return s
+}
+
+func TestServer(t *testing.T) {
+	cases := []struct {
+		name     string
+		request  string
+		response string
+	}{
+		{
+			"should respond result",
+			`{"jsonrpc":"2.0","id":1,"method":"sum","params":[1,2]}`,
+			`{"jsonrpc":"2.0","id":1,"result":3}`,
+		},
+		{
+			"should respond empty result",
+			`{"jsonrpc":"2.0","id":"a","method":"ping"}`,
+			`{"jsonrpc":"2.0","id":"a","result":{}}`,
+		},
+		{
+			"should respond parse error",
+			`{"jsonrpc":`,
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"unexpected end of JSON input"}}`,
+		},
+		{
+			"should respond invalid request, because version is missing",
+			`{"id":1,"method":"sum"}`,
+			`{"jsonrpc":"2.0","id":1,"error":{"code":-32600,"message":"invalid request"}}`,
+		},
+		{
+			"should respond method not found",
+			`{"jsonrpc":"2.0","id":1,"method":"none"}`,
+			`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method none not found"}}`,
+		},
+		{
+			"should respond invalid params",
+			`{"jsonrpc":"2.0","id":1,"method":"sum"}`,
+			`{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"params required"}}`,
+		},
+		{
+			"should respond internal error",
+			`{"jsonrpc":"2.0","id":1,"method":"fail"}`,
+			`{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"failed"}}`,
+		},
+	}
+
+	s := useTestServer()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := s.Serve([]byte(c.request))
+			if string(res) != c.response {
+				t.Errorf("response not match %s %s", res, c.response)
+			}
+		})
+	}
+
+	t.Run("should not respond, because request is notification", func(t *testing.T) {
+		res := s.Serve([]byte(`{"jsonrpc":"2.0","method":"sum","params":[1]}`))
+		if res != nil {
+			t.Errorf("response not match %s", res)
+		}
+	})
+}
+
+func TestNotification(t *testing.T) {
+	t.Run("should marshal notification", func(t *testing.T) {
+		b, err := MarshalNotification("event", map[string]int{"a": 1})
+		if err != nil {
+			t.Fatalf("marshal error %v", err)
+		}
+		if string(b) != `{"jsonrpc":"2.0","method":"event","params":{"a":1}}` {
+			t.Errorf("notification not match %s", b)
+		}
+	})
+}
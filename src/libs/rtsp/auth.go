@@ -0,0 +1,96 @@
+package rtsp
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// digest access authentication with md5
+//
+// https://www.rfc-editor.org/rfc/rfc2617
+type digestAuth struct {
+	realm    string
+	username string
+	password string
+}
+
+func md5Hex(s string) string {
+	h := md5.Sum([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// parse `Digest k=v, k="v"`
+func parseDigest(header string) (map[string]string, bool) {
+	scheme, rest, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Digest") {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		k, v, found := strings.Cut(rest, "=")
+		if !found {
+			break
+		}
+		k = strings.TrimSpace(k)
+
+		if strings.HasPrefix(v, "\"") {
+			end := strings.Index(v[1:], "\"")
+			if end < 0 {
+				return nil, false
+			}
+			params[k] = v[1 : end+1]
+			rest = v[end+2:]
+		} else {
+			end := strings.Index(v, ",")
+			if end < 0 {
+				end = len(v)
+			}
+			params[k] = strings.TrimSpace(v[:end])
+			rest = v[end:]
+		}
+	}
+
+	return params, true
+}
+
+func (a *digestAuth) challenge(nonce string) string {
+	return fmt.Sprintf("Digest realm=\"%s\", nonce=\"%s\"", a.realm, nonce)
+}
+
+func (a *digestAuth) response(method string, uri string, nonce string, params map[string]string) string {
+	ha1 := md5Hex(a.username + ":" + a.realm + ":" + a.password)
+	ha2 := md5Hex(method + ":" + uri)
+
+	if params["qop"] == "auth" {
+		return md5Hex(ha1 + ":" + nonce + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+	}
+	return md5Hex(ha1 + ":" + nonce + ":" + ha2)
+}
+
+// valid authorization header with the nonce issued to the connection, for the request uri
+func (a *digestAuth) valid(method string, uri string, header string, nonce string) bool {
+	params, ok := parseDigest(header)
+	if !ok {
+		return false
+	}
+
+	if params["username"] != a.username || params["realm"] != a.realm || params["nonce"] != nonce || params["uri"] != uri {
+		return false
+	}
+
+	expected := a.response(method, uri, nonce, params)
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(params["response"])) == 1
+}
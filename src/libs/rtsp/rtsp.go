@@ -0,0 +1,236 @@
+package rtsp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// minimal rtsp 1.0 server with a single h264 stream
+//
+// https://www.rfc-editor.org/rfc/rfc2326
+
+const rtspVersion = "RTSP/1.0"
+
+// request body limit, clients do not send large bodies
+const rtspMaxBodySize = 64 * 1024
+
+type Request struct {
+	Method string
+	URL    string
+	Header textproto.MIMEHeader
+	Body   []byte
+}
+
+type Response struct {
+	Status int
+	Header textproto.MIMEHeader
+	Body   []byte
+}
+
+func NewResponse(status int) Response {
+	return Response{
+		Status: status,
+		Header: textproto.MIMEHeader{},
+	}
+}
+
+// set header as is, some clients are case sensitive
+func (res *Response) Set(key string, value string) {
+	res.Header[key] = []string{value}
+}
+
+func statusText(status int) string {
+	switch status {
+	case 200:
+		return "OK"
+	case 400:
+		return "Bad Request"
+	case 401:
+		return "Unauthorized"
+	case 404:
+		return "Not Found"
+	case 454:
+		return "Session Not Found"
+	case 455:
+		return "Method Not Valid in This State"
+	case 461:
+		return "Unsupported Transport"
+	case 500:
+		return "Internal Server Error"
+	case 501:
+		return "Not Implemented"
+	case 503:
+		return "Service Unavailable"
+	default:
+		return "Unknown"
+	}
+}
+
+// read an interleaved frame from client, it is rtcp receiver report, and it is dropped
+func readInterleaved(br *bufio.Reader) error {
+	h := make([]byte, 4)
+	_, err := io.ReadFull(br, h)
+	if err != nil {
+		return err
+	}
+
+	_, err = br.Discard(int(h[2])<<8 | int(h[3]))
+	return err
+}
+
+func ReadRequest(br *bufio.Reader) (Request, error) {
+	tr := textproto.NewReader(br)
+
+	line, err := tr.ReadLine()
+	if err != nil {
+		return Request{}, err
+	}
+
+	parts := strings.Fields(line)
+	if len(parts) != 3 || parts[2] != rtspVersion {
+		return Request{}, fmt.Errorf("rtsp invalid request line %s", line)
+	}
+
+	header, err := tr.ReadMIMEHeader()
+	if err != nil {
+		return Request{}, err
+	}
+
+	req := Request{
+		Method: parts[0],
+		URL:    parts[1],
+		Header: header,
+	}
+
+	if v := header.Get("Content-Length"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > rtspMaxBodySize {
+			return Request{}, fmt.Errorf("rtsp invalid content length %s", v)
+		}
+
+		req.Body = make([]byte, n)
+		_, err = io.ReadFull(br, req.Body)
+		if err != nil {
+			return Request{}, err
+		}
+	}
+
+	return req, nil
+}
+
+func (res *Response) Write(w io.Writer, cseq string) error {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "%s %d %s\r\n", rtspVersion, res.Status, statusText(res.Status))
+	fmt.Fprintf(&b, "CSeq: %s\r\n", cseq)
+
+	keys := make([]string, 0, len(res.Header))
+	for k := range res.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range res.Header[k] {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+		}
+	}
+
+	if len(res.Body) > 0 {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n", len(res.Body))
+	}
+	b.WriteString("\r\n")
+	b.Write(res.Body)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// interleaved frame of rtp or rtcp over tcp
+func interleaved(channel byte, packet []byte) []byte {
+	b := make([]byte, 4, 4+len(packet))
+	b[0] = '$'
+	b[1] = channel
+	b[2] = byte(len(packet) >> 8)
+	b[3] = byte(len(packet))
+
+	return append(b, packet...)
+}
+
+type transport struct {
+	tcp bool
+	// rtp and rtcp channel of tcp
+	channels [2]int
+	// rtp and rtcp port of udp client
+	ports [2]int
+}
+
+func parsePair(v string) ([2]int, error) {
+	p := [2]int{}
+
+	a, b, found := strings.Cut(v, "-")
+	n, err := strconv.Atoi(a)
+	if err != nil {
+		return p, err
+	}
+	p[0] = n
+	p[1] = n + 1
+
+	if found {
+		n, err = strconv.Atoi(b)
+		if err != nil {
+			return p, err
+		}
+		p[1] = n
+	}
+
+	return p, nil
+}
+
+// parse transport header, the first supported one is used
+func parseTransport(header string) (transport, error) {
+	for _, spec := range strings.Split(header, ",") {
+		params := strings.Split(strings.TrimSpace(spec), ";")
+
+		t := transport{}
+		switch params[0] {
+		case "RTP/AVP/TCP":
+			t.tcp = true
+			t.channels = [2]int{0, 1}
+		case "RTP/AVP", "RTP/AVP/UDP":
+		default:
+			continue
+		}
+
+		multicast := false
+		valid := true
+		for _, p := range params[1:] {
+			k, v, _ := strings.Cut(p, "=")
+
+			var err error
+			switch k {
+			case "multicast":
+				multicast = true
+			case "interleaved":
+				t.channels, err = parsePair(v)
+			case "client_port":
+				t.ports, err = parsePair(v)
+			}
+			if err != nil {
+				valid = false
+			}
+		}
+
+		if !valid || multicast || (!t.tcp && t.ports[0] == 0) {
+			continue
+		}
+
+		return t, nil
+	}
+
+	return transport{}, fmt.Errorf("rtsp unsupported transport %s", header)
+}
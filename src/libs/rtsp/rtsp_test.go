@@ -0,0 +1,418 @@
+package rtsp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+type testResponse struct {
+	status int
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+	cseq int
+	auth string
+}
+
+func useTestClient(t *testing.T, s *Server) *testClient {
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial error %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	return &testClient{t: t, conn: conn, br: bufio.NewReader(conn)}
+}
+
+func (c *testClient) request(method string, headers ...string) testResponse {
+	c.cseq++
+
+	b := fmt.Sprintf("%s rtsp://localhost/live RTSP/1.0\r\nCSeq: %d\r\n", method, c.cseq)
+	if c.auth != "" {
+		b += "Authorization: " + c.auth + "\r\n"
+	}
+	for _, h := range headers {
+		b += h + "\r\n"
+	}
+	b += "\r\n"
+
+	_, err := c.conn.Write([]byte(b))
+	if err != nil {
+		c.t.Fatalf("write request error %v", err)
+	}
+
+	return c.response()
+}
+
+func (c *testClient) response() testResponse {
+	tr := textproto.NewReader(c.br)
+
+	line, err := tr.ReadLine()
+	if err != nil {
+		c.t.Fatalf("read response error %v", err)
+	}
+	parts := strings.SplitN(line, " ", 3)
+	status, _ := strconv.Atoi(parts[1])
+
+	header, err := tr.ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("read header error %v", err)
+	}
+
+	if header.Get("CSeq") != strconv.Itoa(c.cseq) {
+		c.t.Errorf("cseq not match %s %d", header.Get("CSeq"), c.cseq)
+	}
+
+	res := testResponse{status: status, header: header}
+	if v := header.Get("Content-Length"); v != "" {
+		n, _ := strconv.Atoi(v)
+		res.body = make([]byte, n)
+		io.ReadFull(c.br, res.body)
+	}
+
+	return res
+}
+
+// read interleaved rtp packet
+func (c *testClient) packet() rtp.Packet {
+	for {
+		h := make([]byte, 4)
+		_, err := io.ReadFull(c.br, h)
+		if err != nil {
+			c.t.Fatalf("read interleaved error %v", err)
+		} else if h[0] != '$' {
+			c.t.Fatalf("interleaved magic not match %v", h)
+		}
+
+		b := make([]byte, int(h[2])<<8|int(h[3]))
+		io.ReadFull(c.br, b)
+
+		// skip rtcp
+		if h[1] != 0 {
+			continue
+		}
+
+		p := rtp.Packet{}
+		err = p.Unmarshal(b)
+		if err != nil {
+			c.t.Fatalf("unmarshal rtp error %v", err)
+		}
+		return p
+	}
+}
+
+func useTestServer(t *testing.T, username string, maxClients int) (*Server, *int) {
+	s := NewServer("127.0.0.1:0", "kvvm", username, "secret", maxClients)
+
+	playing := 0
+	s.OnStart = func() error {
+		playing++
+		return nil
+	}
+	s.OnStop = func() {
+		playing--
+	}
+
+	err := s.Open()
+	if err != nil {
+		t.Fatalf("open error %v", err)
+	}
+	t.Cleanup(s.Close)
+
+	return &s, &playing
+}
+
+var testSPS = []byte{0x67, 0x42, 0xc0, 0x1f, 0xda}
+var testPPS = []byte{0x68, 0xce, 0x3c, 0x80}
+
+func useTestAccessUnit(key bool) []byte {
+	b := []byte{}
+	if key {
+		b = append(b, 0, 0, 0, 1)
+		b = append(b, testSPS...)
+		b = append(b, 0, 0, 0, 1)
+		b = append(b, testPPS...)
+		b = append(b, 0, 0, 0, 1, 0x65, 0x88, 0x80)
+		return b
+	}
+
+	return append(b, 0, 0, 0, 1, 0x41, 0x9a, 0x01)
+}
+
+// wait until written access unit is received by players
+func waitPlayers(s *Server, n int) {
+	for range 100 {
+		s.playersMu.RLock()
+		l := len(s.players)
+		s.playersMu.RUnlock()
+		if l == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestParseTransport(t *testing.T) {
+	t.Run("should parse tcp", func(t *testing.T) {
+		tr, err := parseTransport("RTP/AVP/TCP;unicast;interleaved=2-3")
+		if err != nil {
+			t.Fatalf("parse error %v", err)
+		}
+		if !tr.tcp || tr.channels != [2]int{2, 3} {
+			t.Errorf("transport not match %v", tr)
+		}
+	})
+
+	t.Run("should parse udp and skip multicast", func(t *testing.T) {
+		tr, err := parseTransport("RTP/AVP;multicast;port=5000-5001,RTP/AVP;unicast;client_port=6000-6001")
+		if err != nil {
+			t.Fatalf("parse error %v", err)
+		}
+		if tr.tcp || tr.ports != [2]int{6000, 6001} {
+			t.Errorf("transport not match %v", tr)
+		}
+	})
+
+	t.Run("should be error, because unsupported", func(t *testing.T) {
+		_, err := parseTransport("RTP/SAVP;unicast;client_port=6000-6001")
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+}
+
+func TestDigestAuth(t *testing.T) {
+	a := digestAuth{realm: "kvvm", username: "admin", password: "secret"}
+	nonce := "abc"
+
+	t.Run("should be valid", func(t *testing.T) {
+		params := map[string]string{}
+		r := a.response("DESCRIBE", "rtsp://localhost/live", nonce, params)
+		h := fmt.Sprintf(`Digest username="admin", realm="kvvm", nonce="abc", uri="rtsp://localhost/live", response="%s"`, r)
+
+		if !a.valid("DESCRIBE", "rtsp://localhost/live", h, nonce) {
+			t.Errorf("should be valid")
+		}
+	})
+
+	t.Run("should be valid with qop", func(t *testing.T) {
+		params := map[string]string{"qop": "auth", "nc": "00000001", "cnonce": "xyz"}
+		r := a.response("DESCRIBE", "rtsp://localhost/live", nonce, params)
+		h := fmt.Sprintf(`Digest username="admin", realm="kvvm", nonce="abc", uri="rtsp://localhost/live", qop=auth, nc=00000001, cnonce="xyz", response="%s"`, r)
+
+		if !a.valid("DESCRIBE", "rtsp://localhost/live", h, nonce) {
+			t.Errorf("should be valid")
+		}
+	})
+
+	t.Run("should be invalid, because wrong password or nonce", func(t *testing.T) {
+		b := digestAuth{realm: "kvvm", username: "admin", password: "wrong"}
+		r := b.response("DESCRIBE", "rtsp://localhost/live", nonce, map[string]string{})
+		h := fmt.Sprintf(`Digest username="admin", realm="kvvm", nonce="abc", uri="rtsp://localhost/live", response="%s"`, r)
+
+		if a.valid("DESCRIBE", "rtsp://localhost/live", h, nonce) {
+			t.Errorf("should be invalid, because wrong password")
+		}
+
+		r = a.response("DESCRIBE", "rtsp://localhost/live", nonce, map[string]string{})
+		h = fmt.Sprintf(`Digest username="admin", realm="kvvm", nonce="abc", uri="rtsp://localhost/live", response="%s"`, r)
+		if a.valid("DESCRIBE", "rtsp://localhost/live", h, "other") {
+			t.Errorf("should be invalid, because wrong nonce")
+		}
+	})
+
+	t.Run("should be invalid, because uri is not the request uri", func(t *testing.T) {
+		r := a.response("DESCRIBE", "rtsp://localhost/other", nonce, map[string]string{})
+		h := fmt.Sprintf(`Digest username="admin", realm="kvvm", nonce="abc", uri="rtsp://localhost/other", response="%s"`, r)
+
+		if a.valid("DESCRIBE", "rtsp://localhost/live", h, nonce) {
+			t.Errorf("should be invalid")
+		}
+	})
+}
+
+func TestServer(t *testing.T) {
+	t.Run("should play with digest auth over tcp", func(t *testing.T) {
+		s, playing := useTestServer(t, "admin", 0)
+		s.WriteAccessUnit(0, useTestAccessUnit(true))
+
+		c := useTestClient(t, s)
+		defer c.conn.Close()
+
+		res := c.request("OPTIONS")
+		if res.status != 200 || !strings.Contains(res.header.Get("Public"), "DESCRIBE") {
+			t.Fatalf("options not match %v", res)
+		}
+
+		res = c.request("DESCRIBE")
+		if res.status != 401 {
+			t.Fatalf("status not match %d 401", res.status)
+		}
+		params, ok := parseDigest(res.header.Get("WWW-Authenticate"))
+		if !ok {
+			t.Fatalf("challenge invalid %s", res.header.Get("WWW-Authenticate"))
+		}
+
+		a := digestAuth{realm: "kvvm", username: "admin", password: "secret"}
+		response := func(method string) string {
+			r := a.response(method, "rtsp://localhost/live", params["nonce"], map[string]string{})
+			return fmt.Sprintf(`Digest username="admin", realm="kvvm", nonce="%s", uri="rtsp://localhost/live", response="%s"`, params["nonce"], r)
+		}
+
+		c.auth = response("DESCRIBE")
+		res = c.request("DESCRIBE")
+		if res.status != 200 {
+			t.Fatalf("status not match %d 200", res.status)
+		}
+		if !strings.Contains(string(res.body), "sprop-parameter-sets=Z0LAH9o=,aM48gA==") {
+			t.Errorf("sdp not match %s", res.body)
+		}
+
+		c.auth = response("SETUP")
+		res = c.request("SETUP", "Transport: RTP/AVP/TCP;unicast;interleaved=0-1")
+		if res.status != 200 || res.header.Get("Session") == "" {
+			t.Fatalf("setup not match %v", res)
+		}
+		session := res.header.Get("Session")
+
+		c.auth = response("PLAY")
+		res = c.request("PLAY", "Session: "+session)
+		if res.status != 200 {
+			t.Fatalf("status not match %d 200", res.status)
+		}
+		if *playing != 1 {
+			t.Errorf("on start not called")
+		}
+
+		// first packet is key frame
+		waitPlayers(s, 1)
+		s.WriteAccessUnit(1000, useTestAccessUnit(false))
+		s.WriteAccessUnit(2000, useTestAccessUnit(true))
+
+		p := c.packet()
+		if p.Timestamp != 180 || p.PayloadType != rtspPayloadType {
+			t.Errorf("packet not match %v", p.Header)
+		}
+
+		c.auth = response("TEARDOWN")
+		res = c.request("TEARDOWN", "Session: "+session)
+		if res.status != 200 {
+			t.Fatalf("status not match %d 200", res.status)
+		}
+
+		waitPlayers(s, 0)
+		if *playing != 0 {
+			t.Errorf("on stop not called")
+		}
+	})
+
+	t.Run("should play over udp", func(t *testing.T) {
+		s, _ := useTestServer(t, "", 0)
+
+		u, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("listen udp error %v", err)
+		}
+		defer u.Close()
+		port := u.LocalAddr().(*net.UDPAddr).Port
+
+		c := useTestClient(t, s)
+		defer c.conn.Close()
+
+		res := c.request("SETUP", fmt.Sprintf("Transport: RTP/AVP;unicast;client_port=%d-%d", port, port+1))
+		if res.status != 200 || !strings.Contains(res.header.Get("Transport"), "server_port=") {
+			t.Fatalf("setup not match %v", res)
+		}
+
+		res = c.request("PLAY", "Session: "+res.header.Get("Session"))
+		if res.status != 200 {
+			t.Fatalf("status not match %d 200", res.status)
+		}
+
+		waitPlayers(s, 1)
+		s.WriteAccessUnit(0, useTestAccessUnit(true))
+
+		b := make([]byte, 1500)
+		u.SetReadDeadline(time.Now().Add(3 * time.Second))
+		n, err := u.Read(b)
+		if err != nil {
+			t.Fatalf("read udp error %v", err)
+		}
+
+		p := rtp.Packet{}
+		err = p.Unmarshal(b[:n])
+		if err != nil || p.PayloadType != rtspPayloadType {
+			t.Errorf("packet not match %v %v", p.Header, err)
+		}
+	})
+
+	t.Run("should reject, because too many clients", func(t *testing.T) {
+		s, _ := useTestServer(t, "", 1)
+		transport := "Transport: RTP/AVP/TCP;unicast;interleaved=0-1"
+
+		// connections without session are not counted
+		c0 := useTestClient(t, s)
+		defer c0.conn.Close()
+		if res := c0.request("OPTIONS"); res.status != 200 {
+			t.Fatalf("status not match %d 200", res.status)
+		}
+
+		c1 := useTestClient(t, s)
+		defer c1.conn.Close()
+		if res := c1.request("SETUP", transport); res.status != 200 {
+			t.Fatalf("status not match %d 200", res.status)
+		}
+
+		c2 := useTestClient(t, s)
+		defer c2.conn.Close()
+		if res := c2.request("SETUP", transport); res.status != 503 {
+			t.Errorf("status not match %d 503", res.status)
+		}
+	})
+
+	t.Run("should not count, because the client is not authenticated", func(t *testing.T) {
+		s, _ := useTestServer(t, "admin", 1)
+
+		c1 := useTestClient(t, s)
+		defer c1.conn.Close()
+		if res := c1.request("SETUP", "Transport: RTP/AVP/TCP;unicast;interleaved=0-1"); res.status != 401 {
+			t.Fatalf("status not match %d 401", res.status)
+		}
+
+		s.connsMu.Lock()
+		for c := range s.conns {
+			if c.joined || c.authed {
+				t.Errorf("client should not be counted")
+			}
+			if time.Until(c.authDeadline) > rtspAuthTimeout {
+				t.Errorf("deadline not match %v", c.authDeadline)
+			}
+		}
+		s.connsMu.Unlock()
+	})
+
+	t.Run("should be error, because play without session", func(t *testing.T) {
+		s, _ := useTestServer(t, "", 0)
+
+		c := useTestClient(t, s)
+		defer c.conn.Close()
+
+		if res := c.request("PLAY"); res.status != 454 {
+			t.Errorf("status not match %d 454", res.status)
+		}
+	})
+}
@@ -0,0 +1,691 @@
+package rtsp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+
+	"device-go/src/libs/h264"
+)
+
+// udp clients should send keep alive requests in session timeout
+const rtspSessionTimeout = 60 * time.Second
+
+const rtspWriteTimeout = 5 * time.Second
+
+// connections are closed if they do not authenticate in time
+const rtspAuthTimeout = 10 * time.Second
+
+// access unit queue size of a client, about 2 seconds of 60 fps
+const rtspQueueSize = 120
+
+const rtspMtu = 1200
+const rtspPayloadType = 96
+const rtspClockRate = 90000
+
+const rtspSenderReportInterval = 5 * time.Second
+
+type ServerOnStart func() error
+type ServerOnStop func()
+
+// access unit packetized to rtp packets
+type serverFrame struct {
+	key       bool
+	timestamp uint32
+	time      time.Time
+	packets   [][]byte
+	size      int
+}
+
+type Server struct {
+	addr       string
+	auth       *digestAuth
+	maxClients int
+
+	listener   net.Listener
+	listenerMu sync.Mutex
+	wg         sync.WaitGroup
+
+	// clients are counted from setup, see `join`
+	conns   map[*serverConn]struct{}
+	connsMu sync.Mutex
+
+	players   map[*serverConn]struct{}
+	playersMu sync.RWMutex
+
+	// start and stop with players
+	playing int
+	playMu  sync.Mutex
+
+	stream    sync.Mutex
+	sps       []byte
+	pps       []byte
+	ssrc      uint32
+	sequence  uint16
+	payloader codecs.H264Payloader
+
+	// called when the first client plays
+	OnStart ServerOnStart
+	// called when the last client stops
+	OnStop ServerOnStop
+}
+
+// create server, empty username means no auth, max clients 0 means unlimited
+func NewServer(addr string, realm string, username string, password string, maxClients int) Server {
+	var auth *digestAuth
+	if username != "" {
+		auth = &digestAuth{
+			realm:    realm,
+			username: username,
+			password: password,
+		}
+	}
+
+	return Server{
+		addr:       addr,
+		auth:       auth,
+		maxClients: maxClients,
+	}
+}
+
+func (s *Server) Open() error {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+
+	if s.listener != nil {
+		return fmt.Errorf("rtsp listener exists")
+	}
+
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.listener = l
+
+	s.conns = map[*serverConn]struct{}{}
+	s.players = map[*serverConn]struct{}{}
+
+	b := make([]byte, 4)
+	rand.Read(b)
+	s.ssrc = binary.BigEndian.Uint32(b)
+
+	s.wg.Add(1)
+	go s.accept(l)
+
+	return nil
+}
+
+func (s *Server) Close() {
+	s.listenerMu.Lock()
+	if s.listener != nil {
+		s.listener.Close()
+		s.listener = nil
+	}
+	s.listenerMu.Unlock()
+
+	s.connsMu.Lock()
+	for c := range s.conns {
+		c.conn.Close()
+	}
+	s.connsMu.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *Server) accept(l net.Listener) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			log.Println("rtsp accept error", err)
+			continue
+		}
+
+		c := &serverConn{
+			s:            s,
+			conn:         conn,
+			br:           bufio.NewReader(conn),
+			nonce:        newNonce(),
+			authed:       s.auth == nil,
+			authDeadline: time.Now().Add(rtspAuthTimeout),
+		}
+
+		s.connsMu.Lock()
+		s.conns[c] = struct{}{}
+		s.connsMu.Unlock()
+
+		s.wg.Add(1)
+		go c.handle()
+	}
+}
+
+// count the session of the connection, false if there are too many clients
+func (s *Server) join(c *serverConn) bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	if c.joined {
+		return true
+	}
+
+	n := 0
+	for v := range s.conns {
+		if v.joined {
+			n++
+		}
+	}
+	if s.maxClients > 0 && n >= s.maxClients {
+		return false
+	}
+	c.joined = true
+
+	return true
+}
+
+func (s *Server) startPlay() error {
+	s.playMu.Lock()
+	defer s.playMu.Unlock()
+
+	if s.playing == 0 && s.OnStart != nil {
+		err := s.OnStart()
+		if err != nil {
+			return err
+		}
+	}
+	s.playing++
+
+	return nil
+}
+
+func (s *Server) stopPlay() {
+	s.playMu.Lock()
+	defer s.playMu.Unlock()
+
+	s.playing--
+	if s.playing == 0 && s.OnStop != nil {
+		s.OnStop()
+	}
+}
+
+// sdp of the stream, parameter sets are added when they are known
+func (s *Server) useSDP() []byte {
+	s.stream.Lock()
+	fmtp := "packetization-mode=1"
+	if len(s.sps) >= 4 && len(s.pps) > 0 {
+		fmtp += fmt.Sprintf(";profile-level-id=%s;sprop-parameter-sets=%s,%s",
+			hex.EncodeToString(s.sps[1:4]),
+			base64.StdEncoding.EncodeToString(s.sps),
+			base64.StdEncoding.EncodeToString(s.pps),
+		)
+	}
+	s.stream.Unlock()
+
+	lines := []string{
+		"v=0",
+		"o=- 0 0 IN IP4 0.0.0.0",
+		"s=kvvm",
+		"c=IN IP4 0.0.0.0",
+		"t=0 0",
+		"a=control:*",
+		fmt.Sprintf("m=video 0 RTP/AVP %d", rtspPayloadType),
+		fmt.Sprintf("a=rtpmap:%d H264/%d", rtspPayloadType, rtspClockRate),
+		fmt.Sprintf("a=fmtp:%d %s", rtspPayloadType, fmtp),
+		"a=control:trackID=0",
+	}
+
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// write h264 annex b access unit, timestamp is in microseconds
+func (s *Server) WriteAccessUnit(timestamp uint64, au []byte) {
+	key := false
+
+	s.stream.Lock()
+	for _, nalu := range h264.Split(au) {
+		switch h264.NALUnitType(nalu) {
+		case h264.NALUnitTypeSPS:
+			s.sps = nalu
+		case h264.NALUnitTypePPS:
+			s.pps = nalu
+		case h264.NALUnitTypeIDR:
+			key = true
+		}
+	}
+	s.stream.Unlock()
+
+	s.playersMu.RLock()
+	defer s.playersMu.RUnlock()
+
+	if len(s.players) == 0 {
+		return
+	}
+
+	f := serverFrame{
+		key: key,
+		// 90kHz, timestamp * 90000 / 1000000 could overflow
+		timestamp: uint32(timestamp * 9 / 100),
+		time:      time.Now(),
+	}
+
+	s.stream.Lock()
+	payloads := s.payloader.Payload(rtspMtu, au)
+	for i, payload := range payloads {
+		p := rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         i == len(payloads)-1,
+				PayloadType:    rtspPayloadType,
+				SequenceNumber: s.sequence,
+				Timestamp:      f.timestamp,
+				SSRC:           s.ssrc,
+			},
+			Payload: payload,
+		}
+		s.sequence++
+
+		b, err := p.Marshal()
+		if err != nil {
+			continue
+		}
+		f.packets = append(f.packets, b)
+		f.size += len(payload)
+	}
+	s.stream.Unlock()
+
+	for c := range s.players {
+		c.push(f)
+	}
+}
+
+type serverConn struct {
+	s    *Server
+	conn net.Conn
+	br   *bufio.Reader
+
+	writeMu sync.Mutex
+
+	nonce string
+	// not authenticated connections are closed at the deadline
+	authed       bool
+	authDeadline time.Time
+	// joined is counted by max clients, with conns lock held
+	joined   bool
+	rejected bool
+
+	session   string
+	transport *transport
+	rtpConn   *net.UDPConn
+	rtcpConn  *net.UDPConn
+	rtpAddr   *net.UDPAddr
+	rtcpAddr  *net.UDPAddr
+
+	playing bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	queue   chan serverFrame
+	// used by push only
+	waitKey bool
+}
+
+func (c *serverConn) handle() {
+	defer func() {
+		c.stop()
+		c.closeUdp()
+		c.conn.Close()
+
+		c.s.connsMu.Lock()
+		delete(c.s.conns, c)
+		c.s.connsMu.Unlock()
+
+		c.s.wg.Done()
+	}()
+
+	for {
+		// tcp client is alive while data is written
+		if !c.authed {
+			c.conn.SetReadDeadline(c.authDeadline)
+		} else if c.playing && c.transport.tcp {
+			c.conn.SetReadDeadline(time.Time{})
+		} else {
+			c.conn.SetReadDeadline(time.Now().Add(rtspSessionTimeout))
+		}
+
+		b, err := c.br.Peek(1)
+		if err == nil && b[0] == '$' {
+			err = readInterleaved(c.br)
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		req, err := ReadRequest(c.br)
+		if err == io.EOF || errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			log.Println("rtsp read request error", c.conn.RemoteAddr(), err)
+			return
+		}
+
+		res := c.handleRequest(req)
+		if c.session != "" {
+			res.Set("Session", fmt.Sprintf("%s;timeout=%d", c.session, int(rtspSessionTimeout.Seconds())))
+		}
+
+		c.writeMu.Lock()
+		c.conn.SetWriteDeadline(time.Now().Add(rtspWriteTimeout))
+		err = res.Write(c.conn, req.Header.Get("CSeq"))
+		c.writeMu.Unlock()
+		if err != nil {
+			log.Println("rtsp write response error", c.conn.RemoteAddr(), err)
+			return
+		}
+
+		if c.rejected || req.Method == "TEARDOWN" {
+			return
+		}
+	}
+}
+
+func (c *serverConn) handleRequest(req Request) Response {
+	if c.rejected {
+		return NewResponse(503)
+	}
+
+	if c.s.auth != nil && req.Method != "OPTIONS" {
+		if !c.s.auth.valid(req.Method, req.URL, req.Header.Get("Authorization"), c.nonce) {
+			res := NewResponse(401)
+			res.Set("WWW-Authenticate", c.s.auth.challenge(c.nonce))
+			return res
+		}
+		c.authed = true
+	}
+
+	// session is required after setup
+	session, _, _ := strings.Cut(req.Header.Get("Session"), ";")
+	switch req.Method {
+	case "PLAY", "PAUSE", "TEARDOWN":
+		if c.session == "" || strings.TrimSpace(session) != c.session {
+			return NewResponse(454)
+		}
+	}
+
+	switch req.Method {
+	case "OPTIONS":
+		res := NewResponse(200)
+		res.Set("Public", "OPTIONS, DESCRIBE, SETUP, PLAY, PAUSE, TEARDOWN, GET_PARAMETER")
+		return res
+	case "DESCRIBE":
+		res := NewResponse(200)
+		res.Set("Content-Type", "application/sdp")
+		res.Set("Content-Base", strings.TrimSuffix(req.URL, "/")+"/")
+		res.Body = c.s.useSDP()
+		return res
+	case "SETUP":
+		return c.setup(req)
+	case "PLAY":
+		if c.playing {
+			return NewResponse(200)
+		}
+
+		err := c.play()
+		if err != nil {
+			log.Println("rtsp play error", c.conn.RemoteAddr(), err)
+			return NewResponse(503)
+		}
+
+		c.s.stream.Lock()
+		sequence := c.s.sequence
+		c.s.stream.Unlock()
+
+		res := NewResponse(200)
+		res.Set("Range", "npt=0.000-")
+		res.Set("RTP-Info", fmt.Sprintf("url=%s;seq=%d", req.URL, sequence))
+		return res
+	case "PAUSE", "TEARDOWN":
+		c.stop()
+		return NewResponse(200)
+	case "GET_PARAMETER", "SET_PARAMETER":
+		return NewResponse(200)
+	default:
+		return NewResponse(501)
+	}
+}
+
+func (c *serverConn) setup(req Request) Response {
+	if c.playing {
+		return NewResponse(455)
+	} else if c.transport != nil {
+		// single track
+		return NewResponse(455)
+	}
+
+	t, err := parseTransport(req.Header.Get("Transport"))
+	if err != nil {
+		return NewResponse(461)
+	}
+
+	if !c.s.join(c) {
+		log.Println("rtsp reject client, too many clients", c.conn.RemoteAddr())
+		c.rejected = true
+		return NewResponse(503)
+	}
+
+	res := NewResponse(200)
+
+	if t.tcp {
+		res.Set("Transport", fmt.Sprintf("RTP/AVP/TCP;unicast;interleaved=%d-%d", t.channels[0], t.channels[1]))
+	} else {
+		err = c.openUdp(t)
+		if err != nil {
+			log.Println("rtsp open udp error", err)
+			return NewResponse(500)
+		}
+
+		res.Set("Transport", fmt.Sprintf("RTP/AVP;unicast;client_port=%d-%d;server_port=%d-%d",
+			t.ports[0], t.ports[1],
+			c.rtpConn.LocalAddr().(*net.UDPAddr).Port,
+			c.rtcpConn.LocalAddr().(*net.UDPAddr).Port,
+		))
+	}
+
+	c.transport = &t
+	c.session = newNonce()[:16]
+
+	return res
+}
+
+func (c *serverConn) openUdp(t transport) error {
+	ip := c.conn.RemoteAddr().(*net.TCPAddr).IP
+
+	rtpConn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return err
+	}
+
+	rtcpConn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		rtpConn.Close()
+		return err
+	}
+
+	c.rtpConn = rtpConn
+	c.rtcpConn = rtcpConn
+	c.rtpAddr = &net.UDPAddr{IP: ip, Port: t.ports[0]}
+	c.rtcpAddr = &net.UDPAddr{IP: ip, Port: t.ports[1]}
+
+	return nil
+}
+
+func (c *serverConn) closeUdp() {
+	if c.rtpConn != nil {
+		c.rtpConn.Close()
+		c.rtpConn = nil
+	}
+	if c.rtcpConn != nil {
+		c.rtcpConn.Close()
+		c.rtcpConn = nil
+	}
+}
+
+func (c *serverConn) play() error {
+	if c.transport == nil {
+		return fmt.Errorf("rtsp play before setup")
+	}
+
+	err := c.s.startPlay()
+	if err != nil {
+		return err
+	}
+
+	c.queue = make(chan serverFrame, rtspQueueSize)
+	c.waitKey = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	c.wg.Add(1)
+	go c.write(ctx, c.queue)
+
+	c.s.playersMu.Lock()
+	c.s.players[c] = struct{}{}
+	c.s.playersMu.Unlock()
+
+	c.playing = true
+	log.Println("rtsp play", c.conn.RemoteAddr(), c.transport.tcp)
+
+	return nil
+}
+
+func (c *serverConn) stop() {
+	if !c.playing {
+		return
+	}
+
+	c.s.playersMu.Lock()
+	delete(c.s.players, c)
+	c.s.playersMu.Unlock()
+
+	c.cancel()
+	c.cancel = nil
+	c.wg.Wait()
+
+	c.playing = false
+	c.s.stopPlay()
+	log.Println("rtsp stop", c.conn.RemoteAddr())
+}
+
+// push frame to queue, it is called by the stream writer only
+func (c *serverConn) push(f serverFrame) {
+	// start at key frame, or after drop
+	if c.waitKey {
+		if !f.key {
+			return
+		}
+		c.waitKey = false
+	}
+
+	select {
+	case c.queue <- f:
+	default:
+		log.Println("rtsp client queue full, drop access unit", c.conn.RemoteAddr())
+		c.waitKey = true
+	}
+}
+
+// write rtp packet at channel 0, or rtcp packet at channel 1
+func (c *serverConn) writePacket(channel int, b []byte) error {
+	if c.transport.tcp {
+		c.writeMu.Lock()
+		defer c.writeMu.Unlock()
+
+		c.conn.SetWriteDeadline(time.Now().Add(rtspWriteTimeout))
+		_, err := c.conn.Write(interleaved(byte(c.transport.channels[channel]), b))
+		return err
+	}
+
+	if channel == 0 {
+		_, err := c.rtpConn.WriteToUDP(b, c.rtpAddr)
+		return err
+	}
+	_, err := c.rtcpConn.WriteToUDP(b, c.rtcpAddr)
+	return err
+}
+
+// ntp timestamp, seconds since 1900 in 32.32 fixed point
+func ntpTime(t time.Time) uint64 {
+	s := uint64(t.Unix()) + 2208988800
+	f := uint64(t.Nanosecond()) << 32 / 1000000000
+
+	return s<<32 | f
+}
+
+func (c *serverConn) write(ctx context.Context, queue chan serverFrame) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(rtspSenderReportInterval)
+	defer ticker.Stop()
+
+	packets := uint32(0)
+	octets := uint32(0)
+	last := serverFrame{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case f := <-queue:
+			for _, p := range f.packets {
+				err := c.writePacket(0, p)
+				if err != nil {
+					log.Println("rtsp write packet error", c.conn.RemoteAddr(), err)
+					// reader will return
+					c.conn.Close()
+					return
+				}
+			}
+
+			packets += uint32(len(f.packets))
+			octets += uint32(f.size)
+			last = f
+		case now := <-ticker.C:
+			if packets == 0 {
+				continue
+			}
+
+			sr := rtcp.SenderReport{
+				SSRC:        c.s.ssrc,
+				NTPTime:     ntpTime(now),
+				RTPTime:     last.timestamp + uint32(now.Sub(last.time).Seconds()*rtspClockRate),
+				PacketCount: packets,
+				OctetCount:  octets,
+			}
+
+			b, err := sr.Marshal()
+			if err != nil {
+				continue
+			}
+
+			// rtcp is best effort
+			c.writePacket(1, b)
+		}
+	}
+}
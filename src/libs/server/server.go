@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Server struct {
+	addr string
+
+	mux *http.ServeMux
+
+	server   *http.Server
+	serverMu sync.Mutex
+}
+
+func NewServer(addr string) Server {
+	return Server{
+		addr: addr,
+		mux:  http.NewServeMux(),
+	}
+}
+
+// handle pattern, see `http.ServeMux`
+func (s *Server) Handle(pattern string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+func (s *Server) Open() error {
+	s.serverMu.Lock()
+	defer s.serverMu.Unlock()
+
+	if s.server != nil {
+		return fmt.Errorf("server exists")
+	}
+
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.server = server
+
+	go func() {
+		err := server.Serve(l)
+		if err != nil && err != http.ErrServerClosed {
+			log.Println("server serve error", s.addr, err)
+		}
+	}()
+
+	return nil
+}
+
+func (s *Server) Close() {
+	s.serverMu.Lock()
+	defer s.serverMu.Unlock()
+
+	if s.server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		log.Println("server shutdown error", s.addr, err)
+	}
+	s.server = nil
+}
+
+// read bearer token from authorization header
+func UseBearerToken(req *http.Request) string {
+	h := req.Header.Get("Authorization")
+
+	t, ok := strings.CutPrefix(h, "Bearer ")
+	if !ok {
+		return ""
+	}
+
+	return t
+}
+
+// use bearer token auth, empty token denies all requests
+func WithBearerToken(token string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		t := UseBearerToken(req)
+
+		if token == "" || subtle.ConstantTimeCompare([]byte(t), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			WriteError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		handler(w, req)
+	}
+}
+
+// use bearer token or `token` query auth, for clients which can not set headers, eg. img and video elements
+func WithQueryToken(token string, handler http.HandlerFunc) http.HandlerFunc {
+	bearer := WithBearerToken(token, handler)
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		t := req.URL.Query().Get("token")
+		if t == "" {
+			bearer(w, req)
+			return
+		}
+
+		if token == "" || subtle.ConstantTimeCompare([]byte(t), []byte(token)) != 1 {
+			WriteError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		handler(w, req)
+	}
+}
+
+type ServerError struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// write error as json
+func WriteError(w http.ResponseWriter, status int, msg string) {
+	WriteJSON(w, status, ServerError{Code: status, Msg: msg})
+}
+
+// write data as json
+func WriteJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Println("server write json error", err)
+	}
+}
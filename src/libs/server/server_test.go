@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithBearerToken(t *testing.T) {
+	h := WithBearerToken("test-token", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	useStatus := func(auth string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		w := httptest.NewRecorder()
+		h(w, req)
+
+		return w.Code
+	}
+
+	t.Run("should pass with right token", func(t *testing.T) {
+		s := useStatus("Bearer test-token")
+		if s != http.StatusOK {
+			t.Errorf("status not match %d %d", s, http.StatusOK)
+		}
+	})
+
+	t.Run("should deny with wrong token", func(t *testing.T) {
+		s := useStatus("Bearer wrong-token")
+		if s != http.StatusUnauthorized {
+			t.Errorf("status not match %d %d", s, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("should deny without token", func(t *testing.T) {
+		s := useStatus("")
+		if s != http.StatusUnauthorized {
+			t.Errorf("status not match %d %d", s, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("should deny all with empty token", func(t *testing.T) {
+		eh := WithBearerToken("", func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer ")
+		w := httptest.NewRecorder()
+		eh(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("status not match %d %d", w.Code, http.StatusUnauthorized)
+		}
+	})
+}
+
+func TestWithQueryToken(t *testing.T) {
+	h := WithQueryToken("test-token", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	useStatus := func(target string, auth string) int {
+		req := httptest.NewRequest("GET", target, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		w := httptest.NewRecorder()
+		h(w, req)
+
+		return w.Code
+	}
+
+	t.Run("should pass with right query or bearer token", func(t *testing.T) {
+		s := useStatus("/?token=test-token", "")
+		if s != http.StatusOK {
+			t.Errorf("status not match %d %d", s, http.StatusOK)
+		}
+
+		s = useStatus("/", "Bearer test-token")
+		if s != http.StatusOK {
+			t.Errorf("status not match %d %d", s, http.StatusOK)
+		}
+	})
+
+	t.Run("should deny with wrong query token", func(t *testing.T) {
+		s := useStatus("/?token=wrong-token", "Bearer test-token")
+		if s != http.StatusUnauthorized {
+			t.Errorf("status not match %d %d", s, http.StatusUnauthorized)
+		}
+	})
+}
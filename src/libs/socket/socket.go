@@ -14,6 +14,9 @@ import (
 
 type SocketOnData func(header SocketHeader, body []byte)
 
+// connection is closed by peer or error, not by `Close`
+type SocketOnClose func(err error)
+
 type Socket struct {
 	path string
 
@@ -23,10 +26,12 @@ type Socket struct {
 	wg     sync.WaitGroup
 
 	listener     net.Listener
+	listenerMu   sync.Mutex
 	connection   net.Conn
 	connectionMu sync.RWMutex
 
-	OnData SocketOnData
+	OnData  SocketOnData
+	OnClose SocketOnClose
 }
 
 func NewSocket(path string) Socket {
@@ -34,6 +39,9 @@ func NewSocket(path string) Socket {
 }
 
 func (s *Socket) openListener() error {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+
 	if s.listener != nil {
 		return fmt.Errorf("socket listener exists")
 	}
@@ -52,6 +60,9 @@ func (s *Socket) openListener() error {
 }
 
 func (s *Socket) closeListener() error {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+
 	// avoid null listener
 	if s.listener == nil {
 		return fmt.Errorf("socket null listener")
@@ -69,21 +80,26 @@ func (s *Socket) openConnection(ctx context.Context) error {
 	s.connectionMu.Lock()
 	defer s.connectionMu.Unlock()
 
+	s.listenerMu.Lock()
+	l := s.listener
+	s.listenerMu.Unlock()
+
 	// avoid null listener
-	if s.listener == nil {
+	if l == nil {
 		return fmt.Errorf("socket null listener")
 	} else if s.connection != nil {
 		return fmt.Errorf("socket connection exists")
 	}
 
 	// accept
-	c, err := s.listener.Accept()
+	c, err := l.Accept()
 	if err != nil {
 		s.closeListener()
 		return err
 	}
 	s.connection = c
 
+	s.wg.Add(1)
 	go s.handle(ctx)
 
 	return nil
@@ -106,10 +122,14 @@ func (s *Socket) closeConnection() error {
 }
 
 func (s *Socket) handle(ctx context.Context) {
-	s.wg.Add(1)
+	var err error
 	defer func() {
 		s.closeConnection()
 		s.closeListener()
+
+		if ctx.Err() == nil && s.OnClose != nil {
+			s.OnClose(err)
+		}
 		s.wg.Done()
 	}()
 
@@ -123,7 +143,7 @@ func (s *Socket) handle(ctx context.Context) {
 		default:
 			{
 				// read header
-				err := s.read(ctx, hb)
+				err = s.read(ctx, hb)
 				if err != nil {
 					log.Println("socket read header error", s.path, err)
 					return
@@ -157,11 +177,11 @@ func (s *Socket) handle(ctx context.Context) {
 	}
 }
 
+// read is not locked, so `Close` could close the connection to stop it
 func (s *Socket) read(ctx context.Context, buffer []byte) error {
 	s.connectionMu.RLock()
-	defer s.connectionMu.RUnlock()
-
 	conn := s.connection
+	s.connectionMu.RUnlock()
 
 	// avoid null connection
 	if conn == nil {
@@ -176,22 +196,17 @@ func (s *Socket) read(ctx context.Context, buffer []byte) error {
 		default:
 			{
 				n, err := conn.Read(buffer[total:])
-				if err == io.EOF {
-					break
-				} else if err != nil {
+				total += n
+				if err == io.EOF && total > 0 && total < len(buffer) {
+					// not enough length
+					return fmt.Errorf("socket incomplete read: expected %d, got %d", len(buffer), total)
+				} else if err != nil && total < len(buffer) {
 					return err
 				}
-
-				total += n
 			}
 		}
 	}
 
-	if total != len(buffer) {
-		// not enough length
-		return fmt.Errorf("socket incomplete read: expected %d, got %d", len(buffer), total)
-	}
-
 	return nil
 }
 
@@ -264,6 +279,11 @@ func (s *Socket) Close() {
 		s.cancel = nil
 	}
 
+	// if no connection yet, this stops accept
+	s.closeListener()
+	// stop read
+	s.closeConnection()
+
 	s.wg.Wait()
 }
 
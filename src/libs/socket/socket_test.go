@@ -127,3 +127,71 @@ func TestSocket(t *testing.T) {
 		}
 	})
 }
+
+func TestSocketClose(t *testing.T) {
+	t.Run("should call on close, because peer closed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.sock")
+		s := NewSocket(path)
+
+		closed := make(chan error, 1)
+		s.OnClose = func(err error) {
+			closed <- err
+		}
+
+		err := s.Open()
+		if err != nil {
+			t.Fatalf("socket open error %v", err)
+		}
+		defer s.Close()
+
+		client, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatalf("connect error %v", err)
+		}
+		// half header
+		client.Write(useTestHeader(0)[:10])
+		client.Close()
+
+		select {
+		case err := <-closed:
+			if err == nil {
+				t.Errorf("should be error")
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("on close timeout")
+		}
+	})
+
+	t.Run("should stop read by close", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.sock")
+		s := NewSocket(path)
+
+		s.OnClose = func(err error) {
+			t.Errorf("should not call on close %v", err)
+		}
+
+		err := s.Open()
+		if err != nil {
+			t.Fatalf("socket open error %v", err)
+		}
+
+		client, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatalf("connect error %v", err)
+		}
+		defer client.Close()
+		time.Sleep(50 * time.Millisecond)
+
+		done := make(chan struct{})
+		go func() {
+			s.Close()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("close timeout")
+		}
+	})
+}
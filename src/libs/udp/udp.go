@@ -2,6 +2,7 @@ package udp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -52,14 +53,15 @@ func (u *UDP) openConnection(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	u.connection = c
 
 	err = c.SetReadBuffer(udpBufferSize)
 	if err != nil {
-		u.closeConnection()
+		c.Close()
 		return err
 	}
+	u.connection = c
 
+	u.wg.Add(1)
 	go u.handle(ctx)
 
 	return nil
@@ -82,7 +84,6 @@ func (u *UDP) closeConnection() error {
 const udpFrameBufferSize = 1600 // udp mtu
 
 func (u *UDP) handle(ctx context.Context) {
-	u.wg.Add(1)
 	defer func() {
 		u.closeConnection()
 		u.wg.Done()
@@ -98,10 +99,11 @@ func (u *UDP) handle(ctx context.Context) {
 			{
 				// read frame
 				n, err := u.read(buffer)
-				if err == io.EOF {
+				if err == io.EOF || errors.Is(err, net.ErrClosed) {
 					return
 				} else if err != nil {
 					log.Println("udp read error", u.ip, err)
+					continue
 				}
 
 				if u.OnData != nil {
@@ -113,10 +115,10 @@ func (u *UDP) handle(ctx context.Context) {
 }
 
 func (u *UDP) read(b []byte) (int, error) {
+	// do not hold the lock while reading, close could unblock it
 	u.connectionMu.RLock()
-	defer u.connectionMu.RUnlock()
-
 	conn := u.connection
+	u.connectionMu.RUnlock()
 
 	// avoid null connection
 	if conn == nil {
@@ -129,15 +131,18 @@ func (u *UDP) read(b []byte) (int, error) {
 }
 
 func (u *UDP) Open() error {
-	err := u.Open()
-	if err != nil {
-		return err
+	if u.cancel != nil {
+		return fmt.Errorf("udp exists")
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
-	u.cancel = cancel
 
-	go u.openConnection(ctx)
+	err := u.openConnection(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	u.cancel = cancel
 
 	return nil
 }
@@ -146,6 +151,9 @@ func (u *UDP) Close() {
 	if u.cancel != nil {
 		u.cancel()
 		u.cancel = nil
+
+		// unblock read
+		u.closeConnection()
 	}
 
 	u.wg.Wait()
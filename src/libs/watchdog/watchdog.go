@@ -0,0 +1,132 @@
+package watchdog
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	WatchdogReasonStall = "stall"
+	WatchdogReasonEOF   = "eof"
+)
+
+// restart with reason, count of consecutive restarts
+type WatchdogRestart func(reason string, count uint)
+
+// watchdog of a stream, it restarts the stream when no data is fed in timeout or it is triggered
+//
+// restarts back off exponentially, the backoff resets after the stream is healthy for max backoff
+type Watchdog struct {
+	timeout    time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	restart    WatchdogRestart
+
+	// unix nano of the last feed
+	last    atomic.Int64
+	trigger chan string
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewWatchdog(timeout time.Duration, minBackoff time.Duration, maxBackoff time.Duration, restart WatchdogRestart) Watchdog {
+	return Watchdog{
+		timeout:    timeout,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		restart:    restart,
+		trigger:    make(chan string, 1),
+	}
+}
+
+// data arrives
+func (w *Watchdog) Feed() {
+	w.last.Store(time.Now().UnixNano())
+}
+
+// restart now, eg. connection closed, it does not block
+func (w *Watchdog) Trigger(reason string) {
+	select {
+	case w.trigger <- reason:
+	default:
+	}
+}
+
+func (w *Watchdog) handle(ctx context.Context) {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.timeout / 4)
+	defer ticker.Stop()
+
+	backoff := w.minBackoff
+	count := uint(0)
+	restarted := time.Time{}
+
+	for {
+		reason := ""
+		select {
+		case <-ctx.Done():
+			return
+		case reason = <-w.trigger:
+		case <-ticker.C:
+			if time.Since(time.Unix(0, w.last.Load())) > w.timeout {
+				reason = WatchdogReasonStall
+			}
+		}
+
+		// healthy
+		if count > 0 && time.Since(restarted) > w.maxBackoff && time.Unix(0, w.last.Load()).After(restarted) {
+			backoff = w.minBackoff
+			count = 0
+		}
+
+		if reason == "" {
+			continue
+		}
+
+		count++
+		w.restart(reason, count)
+		restarted = time.Now()
+		// timeout starts after restart
+		w.Feed()
+
+		// drop triggers of the old stream
+		select {
+		case <-w.trigger:
+		default:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, w.maxBackoff)
+	}
+}
+
+func (w *Watchdog) Open() {
+	if w.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+
+	w.Feed()
+
+	w.wg.Add(1)
+	go w.handle(ctx)
+}
+
+func (w *Watchdog) Close() {
+	if w.cancel != nil {
+		w.cancel()
+		w.cancel = nil
+	}
+
+	w.wg.Wait()
+}
@@ -0,0 +1,103 @@
+package watchdog
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type testRestarts struct {
+	mu      sync.Mutex
+	reasons []string
+	counts  []uint
+	times   []time.Time
+}
+
+func (r *testRestarts) restart(reason string, count uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reasons = append(r.reasons, reason)
+	r.counts = append(r.counts, count)
+	r.times = append(r.times, time.Now())
+}
+
+func (r *testRestarts) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.reasons)
+}
+
+func TestWatchdog(t *testing.T) {
+	t.Run("should not restart, because data is fed", func(t *testing.T) {
+		r := testRestarts{}
+		w := NewWatchdog(40*time.Millisecond, 10*time.Millisecond, 100*time.Millisecond, r.restart)
+		w.Open()
+		defer w.Close()
+
+		for range 20 {
+			w.Feed()
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if r.len() != 0 {
+			t.Errorf("restarts not match %v", r.reasons)
+		}
+	})
+
+	t.Run("should restart with backoff, because stalled", func(t *testing.T) {
+		r := testRestarts{}
+		w := NewWatchdog(20*time.Millisecond, 20*time.Millisecond, 80*time.Millisecond, r.restart)
+		w.Open()
+
+		time.Sleep(300 * time.Millisecond)
+		w.Close()
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if len(r.reasons) < 3 || r.reasons[0] != WatchdogReasonStall || r.counts[2] != 3 {
+			t.Fatalf("restarts not match %v %v", r.reasons, r.counts)
+		}
+		// second backoff is double
+		if d := r.times[2].Sub(r.times[1]); d < 38*time.Millisecond {
+			t.Errorf("backoff not match %v", d)
+		}
+	})
+
+	t.Run("should restart at once, because triggered", func(t *testing.T) {
+		r := testRestarts{}
+		w := NewWatchdog(time.Second, 10*time.Millisecond, 100*time.Millisecond, r.restart)
+		w.Open()
+		defer w.Close()
+
+		w.Trigger(WatchdogReasonEOF)
+		time.Sleep(50 * time.Millisecond)
+
+		if r.len() != 1 || r.reasons[0] != WatchdogReasonEOF {
+			t.Errorf("restarts not match %v", r.reasons)
+		}
+	})
+
+	t.Run("should reset count, because healthy", func(t *testing.T) {
+		r := testRestarts{}
+		w := NewWatchdog(40*time.Millisecond, 10*time.Millisecond, 20*time.Millisecond, r.restart)
+		w.Open()
+		defer w.Close()
+
+		w.Trigger(WatchdogReasonEOF)
+		for range 10 {
+			w.Feed()
+			time.Sleep(10 * time.Millisecond)
+		}
+		w.Trigger(WatchdogReasonEOF)
+		time.Sleep(20 * time.Millisecond)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if len(r.counts) != 2 || r.counts[1] != 1 {
+			t.Errorf("counts not match %v", r.counts)
+		}
+	})
+}
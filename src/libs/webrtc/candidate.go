@@ -0,0 +1,85 @@
+package webrtc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// local candidates gathered in this duration are sent together
+const candidateDebounce = 50 * time.Millisecond
+
+// candidates of a batch, done is end of candidates, candidates could be empty then
+type CandidateBatchOnFlush func(candidates []webrtc.ICECandidateInit, done bool)
+
+// batch of local candidates, it flushes after the debounce, or at once at end of candidates
+//
+// flushes are in order, the flush is called under lock
+type CandidateBatch struct {
+	debounce time.Duration
+	onFlush  CandidateBatchOnFlush
+
+	candidates []webrtc.ICECandidateInit
+	timer      *time.Timer
+	mu         sync.Mutex
+}
+
+func NewCandidateBatch(debounce time.Duration, onFlush CandidateBatchOnFlush) CandidateBatch {
+	return CandidateBatch{
+		debounce: debounce,
+		onFlush:  onFlush,
+	}
+}
+
+// add local candidate, nil is end of candidates
+func (b *CandidateBatch) Add(candidate *webrtc.ICECandidateInit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if candidate == nil {
+		b.flush(true)
+		return
+	}
+
+	b.candidates = append(b.candidates, *candidate)
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.debounce, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			b.flush(false)
+		})
+	}
+}
+
+// flush under lock
+func (b *CandidateBatch) flush(done bool) {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	if len(b.candidates) == 0 && !done {
+		return
+	}
+
+	candidates := b.candidates
+	b.candidates = nil
+
+	if b.onFlush != nil {
+		b.onFlush(candidates, done)
+	}
+}
+
+// drop pending candidates
+func (b *CandidateBatch) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.candidates = nil
+}
@@ -0,0 +1,94 @@
+package webrtc
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+type testFlushes struct {
+	mu      sync.Mutex
+	batches [][]webrtc.ICECandidateInit
+	dones   []bool
+}
+
+func (f *testFlushes) flush(candidates []webrtc.ICECandidateInit, done bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.batches = append(f.batches, candidates)
+	f.dones = append(f.dones, done)
+}
+
+func (f *testFlushes) len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.batches)
+}
+
+func useTestCandidate(s string) *webrtc.ICECandidateInit {
+	return &webrtc.ICECandidateInit{Candidate: s}
+}
+
+func TestCandidateBatch(t *testing.T) {
+	t.Run("should send candidates together, because debounced", func(t *testing.T) {
+		f := testFlushes{}
+		b := NewCandidateBatch(20*time.Millisecond, f.flush)
+
+		b.Add(useTestCandidate("a"))
+		b.Add(useTestCandidate("b"))
+		b.Add(useTestCandidate("c"))
+		time.Sleep(60 * time.Millisecond)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if len(f.batches) != 1 || len(f.batches[0]) != 3 || f.dones[0] {
+			t.Errorf("batches not match %v %v", f.batches, f.dones)
+		}
+	})
+
+	t.Run("should flush at once, because end of candidates", func(t *testing.T) {
+		f := testFlushes{}
+		b := NewCandidateBatch(time.Second, f.flush)
+
+		b.Add(useTestCandidate("a"))
+		b.Add(nil)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if len(f.batches) != 1 || len(f.batches[0]) != 1 || !f.dones[0] {
+			t.Errorf("batches not match %v %v", f.batches, f.dones)
+		}
+	})
+
+	t.Run("should send end of candidates, because no candidate is pending", func(t *testing.T) {
+		f := testFlushes{}
+		b := NewCandidateBatch(10*time.Millisecond, f.flush)
+
+		b.Add(useTestCandidate("a"))
+		time.Sleep(40 * time.Millisecond)
+		b.Add(nil)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if len(f.batches) != 2 || len(f.batches[1]) != 0 || !f.dones[1] {
+			t.Errorf("batches not match %v %v", f.batches, f.dones)
+		}
+	})
+
+	t.Run("should drop candidates, because closed", func(t *testing.T) {
+		f := testFlushes{}
+		b := NewCandidateBatch(10*time.Millisecond, f.flush)
+
+		b.Add(useTestCandidate("a"))
+		b.Close()
+		time.Sleep(30 * time.Millisecond)
+
+		if f.len() != 0 {
+			t.Errorf("batches not match %d", f.len())
+		}
+	})
+}
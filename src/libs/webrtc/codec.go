@@ -0,0 +1,195 @@
+package webrtc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	VideoCodecH264 string = "h264"
+	VideoCodecH265 string = "h265"
+	VideoCodecVP8  string = "vp8"
+	VideoCodecVP9  string = "vp9"
+)
+
+// audio codec, only opus is supported
+const AudioCodecOpus string = "opus"
+
+// video codec name to mime type
+var videoCodecMimeTypes = map[string]string{
+	VideoCodecH264: webrtc.MimeTypeH264,
+	VideoCodecH265: webrtc.MimeTypeH265,
+	VideoCodecVP8:  webrtc.MimeTypeVP8,
+	VideoCodecVP9:  webrtc.MimeTypeVP9,
+}
+
+// parse video codecs from a comma separated list, eg. `h265,h264`
+//
+// the order is the preference of device
+func ParseVideoCodecs(s string) ([]string, error) {
+	codecs := []string{}
+
+	for _, v := range strings.Split(s, ",") {
+		c := strings.ToLower(strings.TrimSpace(v))
+		if c == "" {
+			continue
+		} else if _, ok := videoCodecMimeTypes[c]; !ok {
+			return nil, fmt.Errorf("unknown video codec %s", v)
+		}
+
+		codecs = append(codecs, c)
+	}
+
+	if len(codecs) == 0 {
+		return nil, fmt.Errorf("empty video codecs")
+	}
+
+	return codecs, nil
+}
+
+// use rtp codec capability of video codec
+func VideoCodecCapability(codec string) webrtc.RTPCodecCapability {
+	mt, ok := videoCodecMimeTypes[codec]
+	if !ok {
+		mt = webrtc.MimeTypeH264
+	}
+
+	return webrtc.RTPCodecCapability{MimeType: mt}
+}
+
+// use rtp codec capability of opus, same as the default codec of pion
+func AudioCodecCapability() webrtc.RTPCodecCapability {
+	return webrtc.RTPCodecCapability{
+		MimeType:    webrtc.MimeTypeOpus,
+		ClockRate:   48000,
+		Channels:    2,
+		SDPFmtpLine: "minptime=10;useinbandfec=1",
+	}
+}
+
+// offer wants audio from device, it has an opus audio section which could receive
+func OfferAudio(offer *webrtc.SessionDescription) bool {
+	if offer == nil {
+		return false
+	}
+
+	sd, err := offer.Unmarshal()
+	if err != nil {
+		return false
+	}
+
+	for _, md := range sd.MediaDescriptions {
+		if md.MediaName.Media != "audio" {
+			continue
+		}
+
+		opus := false
+		receive := true
+		for _, attr := range md.Attributes {
+			switch attr.Key {
+			case "rtpmap":
+				fs := strings.Fields(attr.Value)
+				if len(fs) >= 2 && strings.HasPrefix(strings.ToLower(fs[1]), "opus/") {
+					opus = true
+				}
+			case "sendonly", "inactive":
+				receive = false
+			}
+		}
+
+		if opus && receive {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lowercase names of video codecs in the offer
+func offeredVideoCodecs(offer *webrtc.SessionDescription) map[string]bool {
+	offered := map[string]bool{}
+	if offer == nil {
+		return offered
+	}
+
+	sd, err := offer.Unmarshal()
+	if err != nil {
+		return offered
+	}
+
+	for _, md := range sd.MediaDescriptions {
+		if md.MediaName.Media != "video" {
+			continue
+		}
+
+		for _, attr := range md.Attributes {
+			if attr.Key != "rtpmap" {
+				continue
+			}
+
+			// rtpmap value is like `96 H264/90000`
+			fs := strings.Fields(attr.Value)
+			if len(fs) < 2 {
+				continue
+			}
+			name := strings.SplitN(fs[1], "/", 2)[0]
+			offered[strings.ToLower(name)] = true
+		}
+	}
+
+	return offered
+}
+
+// whether the offer supports the video codec
+func OffersVideoCodec(offer *webrtc.SessionDescription, codec string) bool {
+	return offeredVideoCodecs(offer)[codec]
+}
+
+// codecs a session could negotiate, running media keeps its codec, a recorded session is h264 only
+func SessionVideoCodecs(codecs []string, running string, record bool) []string {
+	if running != "" {
+		return []string{running}
+	} else if record {
+		return []string{VideoCodecH264}
+	}
+
+	return codecs
+}
+
+// negotiate video codec from the offer
+//
+// use the first codec in `codecs` which the offer supports,
+// if none of them is supported, fallback to h264
+func NegotiateVideoCodec(offer *webrtc.SessionDescription, codecs []string) string {
+	offered := offeredVideoCodecs(offer)
+
+	for _, c := range codecs {
+		if offered[c] {
+			return c
+		}
+	}
+
+	return VideoCodecH264
+}
+
+// register codecs, pion does not register h265 by default
+func registerCodecs(m *webrtc.MediaEngine) error {
+	err := m.RegisterDefaultCodecs()
+	if err != nil {
+		return err
+	}
+
+	return m.RegisterCodec(
+		webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:     webrtc.MimeTypeH265,
+				ClockRate:    90000,
+				RTCPFeedback: []webrtc.RTCPFeedback{{Type: "goog-remb"}, {Type: "ccm", Parameter: "fir"}, {Type: "nack"}, {Type: "nack", Parameter: "pli"}},
+			},
+			PayloadType: 116,
+		},
+		webrtc.RTPCodecTypeVideo,
+	)
+}
@@ -0,0 +1,166 @@
+package webrtc
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func useTestOffer(rtpmaps ...string) *webrtc.SessionDescription {
+	s := "v=0\r\n" +
+		"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+		"s=-\r\n" +
+		"t=0 0\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96 98 100\r\n" +
+		"c=IN IP4 0.0.0.0\r\n"
+	for _, v := range rtpmaps {
+		s += "a=rtpmap:" + v + "\r\n"
+	}
+
+	return &webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: s}
+}
+
+func TestParseVideoCodecs(t *testing.T) {
+	t.Run("should parse right", func(t *testing.T) {
+		codecs, err := ParseVideoCodecs(" H265, h264 ,,vp8")
+		if err != nil {
+			t.Fatalf("parse error %v", err)
+		}
+
+		expected := []string{VideoCodecH265, VideoCodecH264, VideoCodecVP8}
+		if len(codecs) != len(expected) {
+			t.Fatalf("length not match %d %d", len(codecs), len(expected))
+		}
+		for i, v := range expected {
+			if codecs[i] != v {
+				t.Errorf("codec at %d not match %s %s", i, codecs[i], v)
+			}
+		}
+	})
+
+	t.Run("should be error, because unknown codec", func(t *testing.T) {
+		_, err := ParseVideoCodecs("h264,av2")
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+
+	t.Run("should be error, because empty", func(t *testing.T) {
+		_, err := ParseVideoCodecs(" , ")
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+}
+
+func TestNegotiateVideoCodec(t *testing.T) {
+	t.Run("should use device preference", func(t *testing.T) {
+		offer := useTestOffer("96 VP8/90000", "98 H264/90000", "100 H265/90000")
+
+		c := NegotiateVideoCodec(offer, []string{VideoCodecH265, VideoCodecH264})
+		if c != VideoCodecH265 {
+			t.Errorf("codec not match %s %s", c, VideoCodecH265)
+		}
+	})
+
+	t.Run("should skip codec not offered", func(t *testing.T) {
+		offer := useTestOffer("96 VP8/90000", "98 H264/90000")
+
+		c := NegotiateVideoCodec(offer, []string{VideoCodecH265, VideoCodecVP8})
+		if c != VideoCodecVP8 {
+			t.Errorf("codec not match %s %s", c, VideoCodecVP8)
+		}
+	})
+
+	t.Run("should fallback to h264", func(t *testing.T) {
+		offer := useTestOffer("96 VP8/90000")
+
+		c := NegotiateVideoCodec(offer, []string{VideoCodecH265})
+		if c != VideoCodecH264 {
+			t.Errorf("codec not match %s %s", c, VideoCodecH264)
+		}
+
+		c = NegotiateVideoCodec(nil, []string{VideoCodecH265})
+		if c != VideoCodecH264 {
+			t.Errorf("codec not match %s %s", c, VideoCodecH264)
+		}
+	})
+}
+
+func TestSessionVideoCodecs(t *testing.T) {
+	codecs := []string{VideoCodecVP8, VideoCodecH264}
+
+	t.Run("should use h264 only, because the session is recorded", func(t *testing.T) {
+		c := NegotiateVideoCodec(useTestOffer("96 VP8/90000", "98 H264/90000"), SessionVideoCodecs(codecs, "", true))
+		if c != VideoCodecH264 {
+			t.Errorf("codec not match %s %s", c, VideoCodecH264)
+		}
+	})
+
+	t.Run("should keep codec of running media", func(t *testing.T) {
+		c := SessionVideoCodecs(codecs, VideoCodecVP9, true)
+		if len(c) != 1 || c[0] != VideoCodecVP9 {
+			t.Errorf("codecs not match %v", c)
+		}
+	})
+
+	t.Run("should use device preference, because the session is not recorded", func(t *testing.T) {
+		c := NegotiateVideoCodec(useTestOffer("96 VP8/90000", "98 H264/90000"), SessionVideoCodecs(codecs, "", false))
+		if c != VideoCodecVP8 {
+			t.Errorf("codec not match %s %s", c, VideoCodecVP8)
+		}
+	})
+}
+
+func TestOffersVideoCodec(t *testing.T) {
+	t.Run("should find offered codec", func(t *testing.T) {
+		offer := useTestOffer("96 VP8/90000", "98 H264/90000")
+
+		if !OffersVideoCodec(offer, VideoCodecH264) {
+			t.Errorf("h264 should be offered")
+		}
+		if OffersVideoCodec(offer, VideoCodecH265) {
+			t.Errorf("h265 should not be offered")
+		}
+		if OffersVideoCodec(nil, VideoCodecH264) {
+			t.Errorf("nil offer should not offer")
+		}
+	})
+}
+
+func TestOfferAudio(t *testing.T) {
+	useAudioOffer := func(attrs ...string) *webrtc.SessionDescription {
+		offer := useTestOffer("96 H264/90000")
+		offer.SDP += "m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+			"c=IN IP4 0.0.0.0\r\n"
+		for _, v := range attrs {
+			offer.SDP += "a=" + v + "\r\n"
+		}
+
+		return offer
+	}
+
+	t.Run("should receive audio", func(t *testing.T) {
+		if !OfferAudio(useAudioOffer("rtpmap:111 opus/48000/2", "recvonly")) {
+			t.Errorf("should receive audio")
+		}
+		if !OfferAudio(useAudioOffer("rtpmap:111 opus/48000/2", "sendrecv")) {
+			t.Errorf("should receive audio")
+		}
+	})
+
+	t.Run("should not receive audio", func(t *testing.T) {
+		if OfferAudio(useTestOffer("96 H264/90000")) {
+			t.Errorf("should not receive audio, because no audio section")
+		}
+		if OfferAudio(useAudioOffer("rtpmap:111 opus/48000/2", "sendonly")) {
+			t.Errorf("should not receive audio, because send only")
+		}
+		if OfferAudio(useAudioOffer("rtpmap:0 PCMU/8000")) {
+			t.Errorf("should not receive audio, because no opus")
+		}
+		if OfferAudio(nil) {
+			t.Errorf("should not receive audio, because null offer")
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package webrtc
+
+import (
+	"time"
+
+	"github.com/pion/interceptor/pkg/stats"
+	"github.com/pion/webrtc/v4"
+)
+
+// stats are reported at this interval, if `OnStats` is set
+const defaultStatsInterval = 5 * time.Second
+
+type WebRTCOnStats func(report StatsReport)
+
+// connection quality of the session
+//
+// rtt and jitter are in seconds, rtp streams are of the video track, candidates are of the selected pair,
+// bytes are of the ice transport, with audio and data channels
+type StatsReport struct {
+	Rtt          float64 `json:"rtt"`
+	Jitter       float64 `json:"jitter"`
+	PacketsSent  uint64  `json:"packetsSent"`
+	PacketsLost  int64   `json:"packetsLost"`
+	FractionLost float64 `json:"fractionLost"`
+	Nacks        uint32  `json:"nacks"`
+	Plis         uint32  `json:"plis"`
+	Firs         uint32  `json:"firs"`
+
+	// sent bits per second in the recent interval
+	Bitrate   float64 `json:"bitrate"`
+	BytesSent uint64  `json:"bytesSent"`
+
+	// host, srflx, prflx or relay
+	LocalCandidateType  string `json:"localCandidateType,omitempty"`
+	RemoteCandidateType string `json:"remoteCandidateType,omitempty"`
+	Protocol            string `json:"protocol,omitempty"`
+}
+
+// report of pion stats, pion does not report rtp streams, they are of the stats interceptor
+func newStatsReport(report webrtc.StatsReport, video *stats.Stats) StatsReport {
+	r := StatsReport{}
+
+	// bytes of the pair are not counted by pion
+	if transport, ok := report["iceTransport"].(webrtc.TransportStats); ok {
+		r.BytesSent = transport.BytesSent
+	}
+
+	for _, s := range report {
+		pair, ok := s.(webrtc.ICECandidatePairStats)
+		if !ok || !pair.Nominated || pair.State != webrtc.StatsICECandidatePairStateSucceeded {
+			continue
+		}
+
+		r.Rtt = pair.CurrentRoundTripTime
+
+		if local, ok := report[pair.LocalCandidateID].(webrtc.ICECandidateStats); ok {
+			r.LocalCandidateType = local.CandidateType.String()
+			r.Protocol = local.Protocol
+		}
+		if remote, ok := report[pair.RemoteCandidateID].(webrtc.ICECandidateStats); ok {
+			r.RemoteCandidateType = remote.CandidateType.String()
+		}
+		break
+	}
+
+	if video == nil {
+		return r
+	}
+
+	r.PacketsSent = video.OutboundRTPStreamStats.PacketsSent
+	r.Nacks = video.OutboundRTPStreamStats.NACKCount
+	r.Plis = video.OutboundRTPStreamStats.PLICount
+	r.Firs = video.OutboundRTPStreamStats.FIRCount
+
+	// receiver reports of the client
+	r.PacketsLost = video.RemoteInboundRTPStreamStats.PacketsLost
+	r.FractionLost = video.RemoteInboundRTPStreamStats.FractionLost
+	r.Jitter = video.RemoteInboundRTPStreamStats.Jitter
+	if rtt := video.RemoteInboundRTPStreamStats.RoundTripTime; rtt > 0 {
+		r.Rtt = rtt.Seconds()
+	}
+
+	return r
+}
+
+// collect stats of the session
+func (wrtc *WebRTC) Stats() StatsReport {
+	if wrtc.pc == nil {
+		return StatsReport{}
+	}
+
+	wrtc.statsMu.Lock()
+	getter := wrtc.statsGetter
+	wrtc.statsMu.Unlock()
+
+	wrtc.vtMu.Lock()
+	sender := wrtc.vtSender
+	wrtc.vtMu.Unlock()
+
+	var video *stats.Stats
+	if getter != nil && sender != nil {
+		for _, e := range sender.GetParameters().Encodings {
+			video = getter.Get(uint32(e.SSRC))
+			break
+		}
+	}
+
+	r := newStatsReport(wrtc.pc.GetStats(), video)
+
+	wrtc.statsMu.Lock()
+	defer wrtc.statsMu.Unlock()
+
+	now := time.Now()
+	if span := now.Sub(wrtc.statsTime).Seconds(); !wrtc.statsTime.IsZero() && span > 0 && r.BytesSent >= wrtc.statsBytes {
+		r.Bitrate = float64(r.BytesSent-wrtc.statsBytes) * 8 / span
+	}
+	wrtc.statsTime = now
+	wrtc.statsBytes = r.BytesSent
+
+	return r
+}
+
+// report stats of a connected peer until close
+func (wrtc *WebRTC) handleStats() {
+	interval := wrtc.StatsInterval
+	if interval == 0 {
+		interval = defaultStatsInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-wrtc.statsDone:
+			return
+		case <-ticker.C:
+			if wrtc.pc.ConnectionState() != webrtc.PeerConnectionStateConnected {
+				continue
+			}
+
+			wrtc.OnStats(wrtc.Stats())
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package webrtc
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/interceptor/pkg/stats"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+func useTestStatsReport(nominated bool) webrtc.StatsReport {
+	return webrtc.StatsReport{
+		"pair": webrtc.ICECandidatePairStats{
+			LocalCandidateID:     "local",
+			RemoteCandidateID:    "remote",
+			State:                webrtc.StatsICECandidatePairStateSucceeded,
+			Nominated:            nominated,
+			CurrentRoundTripTime: 0.02,
+		},
+		"iceTransport": webrtc.TransportStats{
+			BytesSent: 1000,
+		},
+		"local": webrtc.ICECandidateStats{
+			CandidateType: webrtc.ICECandidateTypeRelay,
+			Protocol:      "udp",
+		},
+		"remote": webrtc.ICECandidateStats{
+			CandidateType: webrtc.ICECandidateTypeSrflx,
+		},
+	}
+}
+
+func TestStatsReport(t *testing.T) {
+	t.Run("should use selected pair", func(t *testing.T) {
+		r := newStatsReport(useTestStatsReport(true), nil)
+
+		if r.Rtt != 0.02 || r.BytesSent != 1000 || r.LocalCandidateType != "relay" || r.RemoteCandidateType != "srflx" || r.Protocol != "udp" {
+			t.Errorf("report not match %+v", r)
+		}
+	})
+
+	t.Run("should not use pair, because it is not nominated", func(t *testing.T) {
+		r := newStatsReport(useTestStatsReport(false), nil)
+
+		if r.Rtt != 0 || r.LocalCandidateType != "" || r.BytesSent != 1000 {
+			t.Errorf("report not match %+v", r)
+		}
+	})
+
+	t.Run("should use rtp stream of video", func(t *testing.T) {
+		video := stats.Stats{}
+		video.OutboundRTPStreamStats.PacketsSent = 100
+		video.OutboundRTPStreamStats.NACKCount = 3
+		video.OutboundRTPStreamStats.PLICount = 2
+		video.RemoteInboundRTPStreamStats.PacketsLost = 5
+		video.RemoteInboundRTPStreamStats.FractionLost = 0.05
+		video.RemoteInboundRTPStreamStats.Jitter = 0.004
+		video.RemoteInboundRTPStreamStats.RoundTripTime = 30 * time.Millisecond
+
+		r := newStatsReport(useTestStatsReport(true), &video)
+
+		if r.PacketsSent != 100 || r.Nacks != 3 || r.Plis != 2 || r.PacketsLost != 5 || r.FractionLost != 0.05 || r.Jitter != 0.004 {
+			t.Errorf("report not match %+v", r)
+		}
+		// rtt of receiver reports is preferred
+		if r.Rtt != 0.03 {
+			t.Errorf("rtt not match %v", r.Rtt)
+		}
+	})
+}
+
+func TestWebRTCStats(t *testing.T) {
+	t.Run("should report selected pair, because the session is connected", func(t *testing.T) {
+		client := useTestClient(t)
+		reports := make(chan StatsReport, 16)
+		wrtc := WebRTC{StatsInterval: 50 * time.Millisecond, OnStats: func(r StatsReport) { reports <- r }}
+		useTestOpen(t, &wrtc)
+
+		// descriptions have all candidates
+		gathered := webrtc.GatheringCompletePromise(client)
+		offer, err := client.CreateOffer(nil)
+		if err != nil {
+			t.Fatalf("client offer error %v", err)
+		}
+		err = client.SetLocalDescription(offer)
+		if err != nil {
+			t.Fatalf("client set offer error %v", err)
+		}
+		<-gathered
+
+		answer, err := wrtc.UseOfferGathered(client.LocalDescription(), 5*time.Second)
+		if err != nil {
+			t.Fatalf("use offer error %v", err)
+		}
+		err = client.SetRemoteDescription(*answer)
+		if err != nil {
+			t.Fatalf("client set answer error %v", err)
+		}
+
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case r := <-reports:
+				if r.LocalCandidateType != "" && r.BytesSent > 0 {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("no report")
+			}
+		}
+	})
+}
+
+func TestWebRTCStatsNack(t *testing.T) {
+	t.Run("should count nacks and retransmit, because default interceptors are registered", func(t *testing.T) {
+		// srtp replay protection drops a retransmission of the same sequence number
+		se := webrtc.SettingEngine{}
+		se.DisableSRTPReplayProtection(true)
+		client, err := webrtc.NewAPI(webrtc.WithSettingEngine(se)).NewPeerConnection(webrtc.Configuration{})
+		if err != nil {
+			t.Fatalf("client error %v", err)
+		}
+		t.Cleanup(func() { client.Close() })
+		_, err = client.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+		if err != nil {
+			t.Fatalf("client transceiver error %v", err)
+		}
+
+		tracks := make(chan *webrtc.TrackRemote, 1)
+		client.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) { tracks <- track })
+
+		wrtc := WebRTC{}
+		useTestOpen(t, &wrtc)
+		err = wrtc.AddVideoTrackRtp(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000})
+		if err != nil {
+			t.Fatalf("add video track error %v", err)
+		}
+
+		gathered := webrtc.GatheringCompletePromise(client)
+		offer, err := client.CreateOffer(nil)
+		if err != nil {
+			t.Fatalf("client offer error %v", err)
+		}
+		err = client.SetLocalDescription(offer)
+		if err != nil {
+			t.Fatalf("client set offer error %v", err)
+		}
+		<-gathered
+
+		answer, err := wrtc.UseOfferGathered(client.LocalDescription(), 5*time.Second)
+		if err != nil {
+			t.Fatalf("use offer error %v", err)
+		}
+		err = client.SetRemoteDescription(*answer)
+		if err != nil {
+			t.Fatalf("client set answer error %v", err)
+		}
+
+		done := make(chan struct{})
+		wg := sync.WaitGroup{}
+		defer wg.Wait()
+		defer close(done)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(10 * time.Millisecond)
+			defer ticker.Stop()
+			for seq := uint16(1); ; seq++ {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					p := rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 3000}, Payload: []byte{0x65, 0x00}}
+					b, _ := p.Marshal()
+					wrtc.WriteVideoTrackRtp(b)
+				}
+			}
+		}()
+
+		var track *webrtc.TrackRemote
+		select {
+		case track = <-tracks:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no track")
+		}
+
+		// nack an already received packet
+		p, _, err := track.ReadRTP()
+		if err != nil {
+			t.Fatalf("read error %v", err)
+		}
+		nacked := p.SequenceNumber
+		err = client.WriteRTCP([]rtcp.Packet{&rtcp.TransportLayerNack{
+			MediaSSRC: uint32(track.SSRC()),
+			Nacks:     []rtcp.NackPair{{PacketID: nacked}},
+		}})
+		if err != nil {
+			t.Fatalf("write nack error %v", err)
+		}
+
+		retransmitted := false
+		timeout := time.After(5 * time.Second)
+		for !retransmitted {
+			select {
+			case <-timeout:
+				t.Fatalf("no retransmission of %d", nacked)
+			default:
+			}
+
+			p, _, err := track.ReadRTP()
+			if err != nil {
+				t.Fatalf("read error %v", err)
+			}
+			retransmitted = p.SequenceNumber == nacked
+		}
+
+		for {
+			if r := wrtc.Stats(); r.Nacks == 1 {
+				return
+			}
+			select {
+			case <-timeout:
+				t.Fatalf("nacks not match %+v", wrtc.Stats())
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package webrtc
+
+import "time"
+
+// normalize source timestamps into sample durations
+//
+// source timestamps are in microseconds, they could start at any value,
+// have gaps, go backwards after clock jumps, or wrap around
+type TimestampNormalizer struct {
+	// used for the first frame and discontinuities
+	defaultDuration time.Duration
+	// a larger gap is treated as a discontinuity
+	maxGap time.Duration
+	// wrap of source timestamp, 0 means no wrap
+	wrap uint64
+
+	last  uint64
+	time  uint64
+	valid bool
+}
+
+func NewTimestampNormalizer(defaultDuration time.Duration, maxGap time.Duration, wrap uint64) TimestampNormalizer {
+	return TimestampNormalizer{
+		defaultDuration: defaultDuration,
+		maxGap:          maxGap,
+		wrap:            wrap,
+	}
+}
+
+// source timestamp delta from the last one, false if it goes backwards
+func (tn *TimestampNormalizer) delta(timestamp uint64) (uint64, bool) {
+	if timestamp >= tn.last {
+		return timestamp - tn.last, true
+	}
+
+	// wrap around, the last one is near the end
+	if tn.wrap > 0 && tn.last-timestamp > tn.wrap/2 {
+		return timestamp + tn.wrap - tn.last, true
+	}
+
+	return 0, false
+}
+
+// returns the normalized timestamp of this frame in microseconds,
+// which is monotonic and starts at 0, and the duration since the last frame
+func (tn *TimestampNormalizer) Next(timestamp uint64) (uint64, time.Duration) {
+	if !tn.valid {
+		tn.valid = true
+		tn.last = timestamp
+		tn.time = 0
+		return tn.time, tn.defaultDuration
+	}
+
+	d := tn.defaultDuration
+
+	delta, ok := tn.delta(timestamp)
+	if ok && time.Duration(delta)*time.Microsecond <= tn.maxGap {
+		d = time.Duration(delta) * time.Microsecond
+	}
+
+	tn.last = timestamp
+	tn.time += uint64(d / time.Microsecond)
+
+	return tn.time, d
+}
+
+func (tn *TimestampNormalizer) Reset() {
+	tn.valid = false
+	tn.last = 0
+	tn.time = 0
+}
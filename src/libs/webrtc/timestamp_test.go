@@ -0,0 +1,81 @@
+package webrtc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimestampNormalizer(t *testing.T) {
+	const frame = time.Second / 30
+
+	type step struct {
+		timestamp uint64
+		time      uint64
+		duration  time.Duration
+	}
+
+	check := func(t *testing.T, tn *TimestampNormalizer, steps []step) {
+		for i, s := range steps {
+			ts, d := tn.Next(s.timestamp)
+			if ts != s.time || d != s.duration {
+				t.Errorf("step %d not match %d %v, %d %v", i, ts, d, s.time, s.duration)
+			}
+		}
+	}
+
+	t.Run("should use default duration for first frame", func(t *testing.T) {
+		tn := NewTimestampNormalizer(frame, time.Second, 0)
+		check(t, &tn, []step{
+			{1_000_000_000, 0, frame},
+			{1_000_020_000, 20_000, 20 * time.Millisecond},
+			{1_000_060_000, 60_000, 40 * time.Millisecond},
+		})
+	})
+
+	t.Run("should use default duration for gap", func(t *testing.T) {
+		tn := NewTimestampNormalizer(frame, time.Second, 0)
+		check(t, &tn, []step{
+			{0, 0, frame},
+			{5_000_000, 33_333, frame},
+			{5_010_000, 43_333, 10 * time.Millisecond},
+		})
+	})
+
+	t.Run("should use default duration for non monotonic", func(t *testing.T) {
+		tn := NewTimestampNormalizer(frame, time.Second, 0)
+		check(t, &tn, []step{
+			{100_000, 0, frame},
+			{50_000, 33_333, frame},
+			{60_000, 43_333, 10 * time.Millisecond},
+		})
+	})
+
+	t.Run("should keep duplicate timestamp", func(t *testing.T) {
+		tn := NewTimestampNormalizer(frame, time.Second, 0)
+		check(t, &tn, []step{
+			{100_000, 0, frame},
+			{100_000, 0, 0},
+		})
+	})
+
+	t.Run("should handle wrap around", func(t *testing.T) {
+		tn := NewTimestampNormalizer(frame, time.Second, 1<<32)
+		check(t, &tn, []step{
+			{1<<32 - 10_000, 0, frame},
+			{10_000, 20_000, 20 * time.Millisecond},
+		})
+	})
+
+	t.Run("should start at 0 after reset", func(t *testing.T) {
+		tn := NewTimestampNormalizer(frame, time.Second, 0)
+		check(t, &tn, []step{
+			{0, 0, frame},
+			{10_000, 10_000, 10 * time.Millisecond},
+		})
+
+		tn.Reset()
+		check(t, &tn, []step{
+			{500_000, 0, frame},
+		})
+	})
+}
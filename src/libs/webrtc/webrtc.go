@@ -2,27 +2,90 @@ package webrtc
 
 import (
 	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/stats"
 	"github.com/pion/webrtc/v4"
 	"github.com/pion/webrtc/v4/pkg/media"
 )
 
-type WebRTCOnIceCandidate func(candidate *webrtc.ICECandidateInit)
+// used for the first frame and discontinuities, 30 fps
+const videoDefaultFrameDuration = time.Second / 30
+
+// a larger gap between frames is treated as a discontinuity
+const videoMaxFrameGap = time.Second
+
+// opus frame duration of audio helper
+const audioDefaultFrameDuration = 20 * time.Millisecond
+
+const audioMaxFrameGap = time.Second
+
+// tracks of the same stream are synchronized by browser
+const trackStreamID = "kvvm"
+
+// grace of a disconnected or failed peer, before the session is closed
+const defaultDisconnectTimeout = 30 * time.Second
+
+// ice of a disconnected peer fails after this, then the device restarts ice
+const iceDisconnectedTimeout = 5 * time.Second
+const iceFailedTimeout = 10 * time.Second
+const iceKeepAliveInterval = 2 * time.Second
+
+// batch of local candidates, done is end of candidates
+type WebRTCOnIceCandidates func(candidates []webrtc.ICECandidateInit, done bool)
+type WebRTCOnIceRestart func(offer *webrtc.SessionDescription)
 type WebRTCOnDataChannel func(dataChannel *webrtc.DataChannel) bool
+type WebRTCOnTrack func(track *webrtc.TrackRemote)
 
 type WebRTC struct {
 	pc *webrtc.PeerConnection
 
-	// video track
-	lastFrameTime time.Time
-	vtSample      *webrtc.TrackLocalStaticSample
-	vtRtp         *webrtc.TrackLocalStaticRTP
+	// video track, writers are locked against add, remove and close
+	vtMu        sync.Mutex
+	vtTimestamp TimestampNormalizer
+	vtSender    *webrtc.RTPSender
+	vtSample    *webrtc.TrackLocalStaticSample
+	vtRtp       *webrtc.TrackLocalStaticRTP
+
+	// audio track
+	atMu        sync.Mutex
+	atTimestamp TimestampNormalizer
+	atSender    *webrtc.RTPSender
+	atSample    *webrtc.TrackLocalStaticSample
+	atRtp       *webrtc.TrackLocalStaticRTP
+
+	// closed after this if the peer does not reconnect, default 30s
+	DisconnectTimeout time.Duration
+	disconnectTimer   *time.Timer
+	disconnectMu      sync.Mutex
+	closed            atomic.Bool
+
+	// local candidates are batched, remote ones before the remote description are pending
+	candidates        CandidateBatch
+	remoteCandidates  []webrtc.ICECandidateInit
+	remoteCandidateMu sync.Mutex
+
+	// stats of rtp streams, the report interval is default 5s
+	StatsInterval time.Duration
+	statsGetter   stats.Getter
+	statsDone     chan struct{}
+	statsBytes    uint64
+	statsTime     time.Time
+	statsMu       sync.Mutex
 
 	// callback
-	OnIceCandidate WebRTCOnIceCandidate
-	OnDataChannel  WebRTCOnDataChannel
-	OnClose        func()
+	OnIceCandidates WebRTCOnIceCandidates
+	OnDataChannel   WebRTCOnDataChannel
+	OnTrack         WebRTCOnTrack
+	// ice restart offer of device, the client answers it
+	OnIceRestart WebRTCOnIceRestart
+	// connection quality, reported periodically while connected
+	OnStats WebRTCOnStats
+	OnClose func()
 }
 
 func (wrtc *WebRTC) Open(iceServers []webrtc.ICEServer) error {
@@ -34,35 +97,74 @@ func (wrtc *WebRTC) Open(iceServers []webrtc.ICEServer) error {
 		ICEServers: iceServers,
 	}
 
+	// use codecs
+	m := webrtc.MediaEngine{}
+	err := registerCodecs(&m)
+	if err != nil {
+		return err
+	}
+
+	// nack retransmissions, twcc and sender reports, browser uses sender reports for lip sync
+	ir := interceptor.Registry{}
+	err = webrtc.RegisterDefaultInterceptors(&m, &ir)
+	if err != nil {
+		return err
+	}
+
+	// stats of rtp streams, the getter is set on new peer connection
+	sf, err := stats.NewInterceptor()
+	if err != nil {
+		return err
+	}
+	sf.OnNewPeerConnection(func(_ string, g stats.Getter) {
+		wrtc.statsMu.Lock()
+		defer wrtc.statsMu.Unlock()
+		wrtc.statsGetter = g
+	})
+	ir.Add(sf)
+
+	se := webrtc.SettingEngine{}
+	se.SetICETimeouts(iceDisconnectedTimeout, iceFailedTimeout, iceKeepAliveInterval)
+
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(&m), webrtc.WithInterceptorRegistry(&ir), webrtc.WithSettingEngine(se))
+
 	// create peer connection
-	pc, err := webrtc.NewPeerConnection(config)
+	pc, err := api.NewPeerConnection(config)
 	if err != nil {
 		return err
 	}
 
-	// close by peer
+	// a transient network change disconnects the peer, it is closed only after the grace
 	pc.OnConnectionStateChange(func(pcs webrtc.PeerConnectionState) {
+		log.Println("wrtc connection state", pcs)
+
 		switch pcs {
-		case webrtc.PeerConnectionStateClosed, webrtc.PeerConnectionStateFailed:
-			{
-				wrtc.Close()
-				break
-			}
+		case webrtc.PeerConnectionStateConnected:
+			wrtc.stopDisconnectTimer()
+		case webrtc.PeerConnectionStateDisconnected:
+			wrtc.startDisconnectTimer()
+		case webrtc.PeerConnectionStateFailed:
+			wrtc.startDisconnectTimer()
+			wrtc.restartIce()
+		case webrtc.PeerConnectionStateClosed:
+			wrtc.Close()
 		}
 	})
 
-	// ice candidate
+	// ice candidate, null candidate is end of candidates
+	wrtc.candidates = NewCandidateBatch(candidateDebounce, func(candidates []webrtc.ICECandidateInit, done bool) {
+		if wrtc.OnIceCandidates != nil {
+			wrtc.OnIceCandidates(candidates, done)
+		}
+	})
 	pc.OnICECandidate(func(i *webrtc.ICECandidate) {
-		// ice candidtae cloud be null candidate
-		//  this is legal, just ignore it
 		if i == nil {
-			return
-		} else if wrtc.OnIceCandidate == nil {
+			wrtc.candidates.Add(nil)
 			return
 		}
 
 		cj := i.ToJSON()
-		wrtc.OnIceCandidate(&cj)
+		wrtc.candidates.Add(&cj)
 	})
 
 	// data channel
@@ -78,22 +180,93 @@ func (wrtc *WebRTC) Open(iceServers []webrtc.ICEServer) error {
 		}
 	})
 
+	// remote track, eg. browser microphone
+	pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		if wrtc.OnTrack == nil {
+			return
+		}
+
+		wrtc.OnTrack(track)
+	})
+
 	wrtc.pc = pc
 
+	if wrtc.OnStats != nil {
+		wrtc.statsDone = make(chan struct{})
+		go wrtc.handleStats()
+	}
+
 	return nil
 }
 
+func (wrtc *WebRTC) startDisconnectTimer() {
+	wrtc.disconnectMu.Lock()
+	defer wrtc.disconnectMu.Unlock()
+
+	if wrtc.disconnectTimer != nil {
+		return
+	}
+
+	timeout := wrtc.DisconnectTimeout
+	if timeout == 0 {
+		timeout = defaultDisconnectTimeout
+	}
+
+	wrtc.disconnectTimer = time.AfterFunc(timeout, func() {
+		log.Println("wrtc disconnect timeout", timeout)
+		wrtc.Close()
+	})
+}
+
+func (wrtc *WebRTC) stopDisconnectTimer() {
+	wrtc.disconnectMu.Lock()
+	defer wrtc.disconnectMu.Unlock()
+
+	if wrtc.disconnectTimer != nil {
+		wrtc.disconnectTimer.Stop()
+		wrtc.disconnectTimer = nil
+	}
+}
+
+// ice restart of failed peer, the offer is sent by `OnIceRestart`
+func (wrtc *WebRTC) restartIce() {
+	if wrtc.OnIceRestart == nil {
+		return
+	}
+
+	offer, err := wrtc.RestartIce()
+	if err != nil {
+		log.Println("wrtc ice restart error", err)
+		return
+	}
+
+	wrtc.OnIceRestart(offer)
+}
+
+// close once, by peer, disconnect timeout or device
 func (wrtc *WebRTC) Close() error {
+	if !wrtc.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	wrtc.stopDisconnectTimer()
+	wrtc.candidates.Close()
+	if wrtc.statsDone != nil {
+		close(wrtc.statsDone)
+	}
+
 	if wrtc.OnClose != nil {
 		wrtc.OnClose()
 	}
 
-	if wrtc.vtSample != nil {
-		wrtc.vtSample = nil
-	}
-	if wrtc.vtRtp != nil {
-		wrtc.vtRtp = nil
-	}
+	wrtc.vtMu.Lock()
+	wrtc.vtSample = nil
+	wrtc.vtRtp = nil
+	wrtc.vtMu.Unlock()
+
+	wrtc.atMu.Lock()
+	wrtc.atSample = nil
+	wrtc.atRtp = nil
+	wrtc.atMu.Unlock()
 
 	if wrtc.pc != nil {
 		err := wrtc.pc.Close()
@@ -105,11 +278,19 @@ func (wrtc *WebRTC) Close() error {
 	return nil
 }
 
+// use offer of client, the first one or an ice restart of client
 func (wrtc *WebRTC) UseOffer(offer *webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	// both sides restart ice, pion could not roll back a local offer,
+	// so offer of device wins, the client rolls back and answers it
+	if wrtc.pc.SignalingState() == webrtc.SignalingStateHaveLocalOffer {
+		return nil, fmt.Errorf("wrtc ice restart of device is pending")
+	}
+
 	err := wrtc.pc.SetRemoteDescription(*offer)
 	if err != nil {
 		return nil, err
 	}
+	wrtc.addPendingIceCandidates()
 
 	answer, err := wrtc.pc.CreateAnswer(nil)
 	if err != nil {
@@ -124,8 +305,108 @@ func (wrtc *WebRTC) UseOffer(offer *webrtc.SessionDescription) (*webrtc.SessionD
 	return &answer, nil
 }
 
-func (wrtc *WebRTC) AddIceCandidate(candidate *webrtc.ICECandidateInit) error {
-	return wrtc.pc.AddICECandidate(*candidate)
+// use offer and wait for local candidates, the answer has all of them, for clients without trickle ice, eg. whep
+func (wrtc *WebRTC) UseOfferGathered(offer *webrtc.SessionDescription, timeout time.Duration) (*webrtc.SessionDescription, error) {
+	gathered := webrtc.GatheringCompletePromise(wrtc.pc)
+
+	_, err := wrtc.UseOffer(offer)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-gathered:
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("wrtc gathering timeout")
+	}
+
+	return wrtc.pc.LocalDescription(), nil
+}
+
+// ice restart by device, the offer is sent to the client, and its answer is used by `UseAnswer`
+func (wrtc *WebRTC) RestartIce() (*webrtc.SessionDescription, error) {
+	if wrtc.pc == nil {
+		return nil, fmt.Errorf("wrtc null pc")
+	} else if s := wrtc.pc.SignalingState(); s != webrtc.SignalingStateStable {
+		return nil, fmt.Errorf("wrtc signaling state %s not stable", s)
+	}
+
+	offer, err := wrtc.pc.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	if err != nil {
+		return nil, err
+	}
+
+	err = wrtc.pc.SetLocalDescription(offer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &offer, nil
+}
+
+// use answer of client to the ice restart of device
+func (wrtc *WebRTC) UseAnswer(answer *webrtc.SessionDescription) error {
+	if wrtc.pc == nil {
+		return fmt.Errorf("wrtc null pc")
+	}
+
+	err := wrtc.pc.SetRemoteDescription(*answer)
+	if err != nil {
+		return err
+	}
+	wrtc.addPendingIceCandidates()
+
+	return nil
+}
+
+// add remote candidates, empty candidate is end of candidates
+//
+// candidates could arrive before the offer, they are pending until the remote description is set
+func (wrtc *WebRTC) AddIceCandidates(candidates []webrtc.ICECandidateInit) error {
+	if wrtc.pc == nil {
+		return fmt.Errorf("wrtc null pc")
+	}
+
+	wrtc.remoteCandidateMu.Lock()
+	defer wrtc.remoteCandidateMu.Unlock()
+
+	if wrtc.pc.RemoteDescription() == nil {
+		wrtc.remoteCandidates = append(wrtc.remoteCandidates, candidates...)
+		return nil
+	}
+
+	// one invalid candidate does not drop the others
+	var err error
+	for _, c := range candidates {
+		cerr := wrtc.pc.AddICECandidate(c)
+		if cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+func (wrtc *WebRTC) addPendingIceCandidates() {
+	wrtc.remoteCandidateMu.Lock()
+	defer wrtc.remoteCandidateMu.Unlock()
+
+	for _, c := range wrtc.remoteCandidates {
+		err := wrtc.pc.AddICECandidate(c)
+		if err != nil {
+			log.Println("wrtc add pending ice candidate error", err)
+		}
+	}
+	wrtc.remoteCandidates = nil
+}
+
+// rtcp of the client reaches the interceptors only when it is read, nacks are resent and counted by them
+func readRtcp(sender *webrtc.RTPSender) {
+	for {
+		if _, _, err := sender.ReadRTCP(); err != nil {
+			return
+		}
+	}
 }
 
 func (wrtc *WebRTC) AddVideoTrackSample(capability webrtc.RTPCodecCapability) error {
@@ -133,34 +414,40 @@ func (wrtc *WebRTC) AddVideoTrackSample(capability webrtc.RTPCodecCapability) er
 	vt, err := webrtc.NewTrackLocalStaticSample(
 		capability,
 		"video",
-		"kvvm",
+		trackStreamID,
 	)
 	if err != nil {
 		return err
 	}
 
-	_, err = wrtc.pc.AddTrack(vt)
+	sender, err := wrtc.pc.AddTrack(vt)
 	if err != nil {
 		return err
 	}
+	go readRtcp(sender)
 
+	wrtc.vtMu.Lock()
+	defer wrtc.vtMu.Unlock()
+
+	wrtc.vtSender = sender
 	wrtc.vtSample = vt
-	wrtc.lastFrameTime = time.Now()
+	wrtc.vtTimestamp = NewTimestampNormalizer(videoDefaultFrameDuration, videoMaxFrameGap, 0)
 
 	return nil
 }
 
 func (wrtc *WebRTC) WriteVideoTrackSample(b []byte, timestamp uint64) error {
+	wrtc.vtMu.Lock()
+	defer wrtc.vtMu.Unlock()
+
 	if wrtc.vtSample == nil {
 		return nil
 	}
 
-	t := time.UnixMicro(int64(timestamp))
 	// log.Println("write video track", timestamp)
-	err := wrtc.vtSample.WriteSample(media.Sample{Data: b, Duration: t.Sub(wrtc.lastFrameTime)})
-	wrtc.lastFrameTime = t
+	_, d := wrtc.vtTimestamp.Next(timestamp)
 
-	return err
+	return wrtc.vtSample.WriteSample(media.Sample{Data: b, Duration: d})
 }
 
 func (wrtc *WebRTC) AddVideoTrackRtp(capability webrtc.RTPCodecCapability) error {
@@ -168,23 +455,31 @@ func (wrtc *WebRTC) AddVideoTrackRtp(capability webrtc.RTPCodecCapability) error
 	vt, err := webrtc.NewTrackLocalStaticRTP(
 		capability,
 		"video",
-		"kvvm",
+		trackStreamID,
 	)
 	if err != nil {
 		return err
 	}
 
-	_, err = wrtc.pc.AddTrack(vt)
+	sender, err := wrtc.pc.AddTrack(vt)
 	if err != nil {
 		return err
 	}
+	go readRtcp(sender)
 
+	wrtc.vtMu.Lock()
+	defer wrtc.vtMu.Unlock()
+
+	wrtc.vtSender = sender
 	wrtc.vtRtp = vt
 
 	return nil
 }
 
 func (wrtc *WebRTC) WriteVideoTrackRtp(b []byte) error {
+	wrtc.vtMu.Lock()
+	defer wrtc.vtMu.Unlock()
+
 	if wrtc.vtRtp == nil {
 		return nil
 	}
@@ -194,6 +489,118 @@ func (wrtc *WebRTC) WriteVideoTrackRtp(b []byte) error {
 	return err
 }
 
+func (wrtc *WebRTC) RemoveVideoTrack() error {
+	wrtc.vtMu.Lock()
+	wrtc.vtSample = nil
+	wrtc.vtRtp = nil
+	sender := wrtc.vtSender
+	wrtc.vtSender = nil
+	wrtc.vtMu.Unlock()
+
+	if sender == nil {
+		return nil
+	}
+
+	err := wrtc.pc.RemoveTrack(sender)
+
+	return err
+}
+
+func (wrtc *WebRTC) AddAudioTrackSample(capability webrtc.RTPCodecCapability) error {
+	at, err := webrtc.NewTrackLocalStaticSample(
+		capability,
+		"audio",
+		trackStreamID,
+	)
+	if err != nil {
+		return err
+	}
+
+	sender, err := wrtc.pc.AddTrack(at)
+	if err != nil {
+		return err
+	}
+	go readRtcp(sender)
+
+	wrtc.atMu.Lock()
+	defer wrtc.atMu.Unlock()
+
+	wrtc.atSender = sender
+	wrtc.atSample = at
+	wrtc.atTimestamp = NewTimestampNormalizer(audioDefaultFrameDuration, audioMaxFrameGap, 0)
+
+	return nil
+}
+
+// write opus packet, timestamp is the capture time in microseconds
+func (wrtc *WebRTC) WriteAudioTrackSample(b []byte, timestamp uint64) error {
+	wrtc.atMu.Lock()
+	defer wrtc.atMu.Unlock()
+
+	if wrtc.atSample == nil {
+		return nil
+	}
+
+	_, d := wrtc.atTimestamp.Next(timestamp)
+
+	return wrtc.atSample.WriteSample(media.Sample{Data: b, Duration: d})
+}
+
+func (wrtc *WebRTC) AddAudioTrackRtp(capability webrtc.RTPCodecCapability) error {
+	at, err := webrtc.NewTrackLocalStaticRTP(
+		capability,
+		"audio",
+		trackStreamID,
+	)
+	if err != nil {
+		return err
+	}
+
+	sender, err := wrtc.pc.AddTrack(at)
+	if err != nil {
+		return err
+	}
+	go readRtcp(sender)
+
+	wrtc.atMu.Lock()
+	defer wrtc.atMu.Unlock()
+
+	wrtc.atSender = sender
+	wrtc.atRtp = at
+
+	return nil
+}
+
+func (wrtc *WebRTC) WriteAudioTrackRtp(b []byte) error {
+	wrtc.atMu.Lock()
+	defer wrtc.atMu.Unlock()
+
+	if wrtc.atRtp == nil {
+		return nil
+	}
+
+	_, err := wrtc.atRtp.Write(b)
+
+	return err
+}
+
+func (wrtc *WebRTC) RemoveAudioTrack() error {
+	wrtc.atMu.Lock()
+	wrtc.atSample = nil
+	wrtc.atRtp = nil
+	sender := wrtc.atSender
+	wrtc.atSender = nil
+	wrtc.atMu.Unlock()
+
+	if sender == nil {
+		return nil
+	}
+
+	err := wrtc.pc.RemoveTrack(sender)
+
+	return err
+}
+
 func (wrtc *WebRTC) CreateDataChannel(label string) (*webrtc.DataChannel, error) {
 	return wrtc.pc.CreateDataChannel(label, nil)
 }
@@ -0,0 +1,274 @@
+package webrtc
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// client peer with a data channel, it offers first
+func useTestClient(t *testing.T) *webrtc.PeerConnection {
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("client error %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	_, err = pc.CreateDataChannel("hid", nil)
+	if err != nil {
+		t.Fatalf("client data channel error %v", err)
+	}
+
+	return pc
+}
+
+func useTestOpen(t *testing.T, wrtc *WebRTC) {
+	err := wrtc.Open(nil)
+	if err != nil {
+		t.Fatalf("open error %v", err)
+	}
+	t.Cleanup(func() { wrtc.Close() })
+}
+
+// client offers, device answers, candidates are gathered before the next ice restart
+func negotiateTest(t *testing.T, client *webrtc.PeerConnection, wrtc *WebRTC, options *webrtc.OfferOptions) {
+	gathered := webrtc.GatheringCompletePromise(client)
+	offer, err := client.CreateOffer(options)
+	if err != nil {
+		t.Fatalf("client offer error %v", err)
+	}
+	err = client.SetLocalDescription(offer)
+	if err != nil {
+		t.Fatalf("client set offer error %v", err)
+	}
+
+	wgathered := webrtc.GatheringCompletePromise(wrtc.pc)
+	answer, err := wrtc.UseOffer(&offer)
+	if err != nil {
+		t.Fatalf("use offer error %v", err)
+	}
+	<-gathered
+	<-wgathered
+
+	err = client.SetRemoteDescription(*answer)
+	if err != nil {
+		t.Fatalf("client set answer error %v", err)
+	}
+}
+
+func TestWebRTCDisconnect(t *testing.T) {
+	t.Run("should close once, because disconnect timeout", func(t *testing.T) {
+		closed := atomic.Int32{}
+		wrtc := WebRTC{DisconnectTimeout: 20 * time.Millisecond, OnClose: func() { closed.Add(1) }}
+		useTestOpen(t, &wrtc)
+
+		wrtc.startDisconnectTimer()
+		time.Sleep(60 * time.Millisecond)
+		wrtc.Close()
+
+		if closed.Load() != 1 {
+			t.Errorf("close count not match %d", closed.Load())
+		}
+	})
+
+	t.Run("should not close, because reconnected", func(t *testing.T) {
+		closed := atomic.Int32{}
+		wrtc := WebRTC{DisconnectTimeout: 20 * time.Millisecond, OnClose: func() { closed.Add(1) }}
+		useTestOpen(t, &wrtc)
+
+		wrtc.startDisconnectTimer()
+		wrtc.stopDisconnectTimer()
+		time.Sleep(60 * time.Millisecond)
+
+		if closed.Load() != 0 {
+			t.Errorf("close count not match %d", closed.Load())
+		}
+	})
+}
+
+func TestWebRTCIceRestart(t *testing.T) {
+	t.Run("should restart ice by either side", func(t *testing.T) {
+		client := useTestClient(t)
+		wrtc := WebRTC{}
+		useTestOpen(t, &wrtc)
+		negotiateTest(t, client, &wrtc, nil)
+
+		offer, err := wrtc.RestartIce()
+		if err != nil {
+			t.Fatalf("restart ice error %v", err)
+		}
+
+		err = client.SetRemoteDescription(*offer)
+		if err != nil {
+			t.Fatalf("client set offer error %v", err)
+		}
+		gathered := webrtc.GatheringCompletePromise(client)
+		answer, err := client.CreateAnswer(nil)
+		if err != nil {
+			t.Fatalf("client answer error %v", err)
+		}
+		err = client.SetLocalDescription(answer)
+		if err != nil {
+			t.Fatalf("client set answer error %v", err)
+		}
+		<-gathered
+
+		err = wrtc.UseAnswer(&answer)
+		if err != nil {
+			t.Fatalf("use answer error %v", err)
+		}
+		if s := wrtc.pc.SignalingState(); s != webrtc.SignalingStateStable {
+			t.Errorf("signaling state not match %s", s)
+		}
+
+		// client restarts with a new offer
+		negotiateTest(t, client, &wrtc, &webrtc.OfferOptions{ICERestart: true})
+	})
+
+	t.Run("should be error, because ice restart of device is pending", func(t *testing.T) {
+		client := useTestClient(t)
+		wrtc := WebRTC{}
+		useTestOpen(t, &wrtc)
+		negotiateTest(t, client, &wrtc, nil)
+
+		_, err := wrtc.RestartIce()
+		if err != nil {
+			t.Fatalf("restart ice error %v", err)
+		}
+
+		offer, err := client.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+		if err != nil {
+			t.Fatalf("client offer error %v", err)
+		}
+
+		_, err = wrtc.UseOffer(&offer)
+		if err == nil {
+			t.Errorf("should be error")
+		}
+		if s := wrtc.pc.SignalingState(); s != webrtc.SignalingStateHaveLocalOffer {
+			t.Errorf("signaling state not match %s", s)
+		}
+	})
+}
+
+func TestWebRTCUseOfferGathered(t *testing.T) {
+	t.Run("should answer with candidates", func(t *testing.T) {
+		client := useTestClient(t)
+		wrtc := WebRTC{}
+		useTestOpen(t, &wrtc)
+
+		offer, err := client.CreateOffer(nil)
+		if err != nil {
+			t.Fatalf("client offer error %v", err)
+		}
+
+		answer, err := wrtc.UseOfferGathered(&offer, 5*time.Second)
+		if err != nil {
+			t.Fatalf("use offer error %v", err)
+		}
+		if answer.Type != webrtc.SDPTypeAnswer || !strings.Contains(answer.SDP, "a=candidate:") {
+			t.Errorf("answer not match %s", answer.SDP)
+		}
+	})
+}
+
+func TestWebRTCIceCandidates(t *testing.T) {
+	t.Run("should keep candidates, because they arrive before offer", func(t *testing.T) {
+		client := useTestClient(t)
+		wrtc := WebRTC{}
+		useTestOpen(t, &wrtc)
+
+		err := wrtc.AddIceCandidates([]webrtc.ICECandidateInit{
+			{Candidate: "candidate:1 1 udp 2130706431 127.0.0.1 50000 typ host"},
+			{},
+		})
+		if err != nil {
+			t.Fatalf("add candidates error %v", err)
+		}
+		if len(wrtc.remoteCandidates) != 2 {
+			t.Fatalf("pending candidates not match %d", len(wrtc.remoteCandidates))
+		}
+
+		negotiateTest(t, client, &wrtc, nil)
+
+		if len(wrtc.remoteCandidates) != 0 {
+			t.Errorf("pending candidates not match %d", len(wrtc.remoteCandidates))
+		}
+	})
+
+	t.Run("should connect, because candidates trickle out of order", func(t *testing.T) {
+		client := useTestClient(t)
+		connected := make(chan struct{})
+		wrtc := WebRTC{}
+		useTestOpen(t, &wrtc)
+
+		// candidates of client are sent before its offer, in reverse order, with end of candidates first
+		gathered := webrtc.GatheringCompletePromise(client)
+		candidates := []webrtc.ICECandidateInit{{}}
+		client.OnICECandidate(func(c *webrtc.ICECandidate) {
+			if c != nil {
+				candidates = append(candidates, c.ToJSON())
+			}
+		})
+		client.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
+			if s == webrtc.PeerConnectionStateConnected {
+				close(connected)
+			}
+		})
+
+		offer, err := client.CreateOffer(nil)
+		if err != nil {
+			t.Fatalf("client offer error %v", err)
+		}
+		err = client.SetLocalDescription(offer)
+		if err != nil {
+			t.Fatalf("client set offer error %v", err)
+		}
+		<-gathered
+
+		for i := len(candidates) - 1; i >= 0; i-- {
+			err = wrtc.AddIceCandidates(candidates[i : i+1])
+			if err != nil {
+				t.Fatalf("add candidates error %v", err)
+			}
+		}
+
+		// batches of device are sent after the answer
+		batches := make(chan []webrtc.ICECandidateInit, 16)
+		wrtc.OnIceCandidates = func(candidates []webrtc.ICECandidateInit, done bool) {
+			if done {
+				candidates = append(candidates, webrtc.ICECandidateInit{})
+			}
+			batches <- candidates
+		}
+
+		answer, err := wrtc.UseOffer(&offer)
+		if err != nil {
+			t.Fatalf("use offer error %v", err)
+		}
+		err = client.SetRemoteDescription(*answer)
+		if err != nil {
+			t.Fatalf("client set answer error %v", err)
+		}
+
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case b := <-batches:
+				for _, c := range b {
+					err = client.AddICECandidate(c)
+					if err != nil {
+						t.Fatalf("client add candidate error %v", err)
+					}
+				}
+			case <-connected:
+				return
+			case <-timeout:
+				t.Fatalf("not connected")
+			}
+		}
+	})
+}
@@ -22,24 +22,52 @@ const (
 
 type WebSocketOnMessage func(messageType int, message []byte)
 
+// connection is lost or closed by peer, not by `Close`
+type WebSocketOnDisconnect func(err error)
+
 type WebSocket struct {
 	url         string
 	accessToken string
+	// accepted by a server, it is not dialed
+	accepted bool
 
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
 
 	connection   *websocket.Conn
 	connectionMu sync.RWMutex
+	// one writer at a time
+	writeMu sync.Mutex
 
-	OnMessage WebSocketOnMessage
-	OnClose   func()
+	OnMessage    WebSocketOnMessage
+	OnDisconnect WebSocketOnDisconnect
+	OnClose      func()
 }
 
 func NewWebSocket(url string, accessToken string) WebSocket {
 	return WebSocket{url: url, accessToken: accessToken}
 }
 
+// token is checked by the handler, clients on lan may be served from other origins
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(req *http.Request) bool { return true },
+}
+
+// accept websocket of a http request, set callbacks then `Open` it
+func Accept(w http.ResponseWriter, req *http.Request) (*WebSocket, error) {
+	c, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &WebSocket{url: req.RemoteAddr, accepted: true, connection: c}
+	c.SetCloseHandler(func(code int, text string) error {
+		return nil
+	})
+
+	return ws, nil
+}
+
 func (ws *WebSocket) buildHeader() http.Header {
 	h := http.Header{}
 
@@ -109,6 +137,9 @@ func (ws *WebSocket) handle(ctx context.Context) {
 					}
 
 					log.Println("websocket read error", ws.url, err)
+					if ws.OnDisconnect != nil {
+						ws.OnDisconnect(err)
+					}
 					return
 				}
 			}
@@ -133,7 +164,9 @@ func (ws *WebSocket) read() error {
 		}
 		break
 	case PingMessage:
+		ws.writeMu.Lock()
 		ws.connection.WriteMessage(PongMessage, msg)
+		ws.writeMu.Unlock()
 		break
 	}
 
@@ -141,9 +174,11 @@ func (ws *WebSocket) read() error {
 }
 
 func (ws *WebSocket) Open() error {
-	err := ws.openConnection()
-	if err != nil {
-		return err
+	if !ws.accepted {
+		err := ws.openConnection()
+		if err != nil {
+			return err
+		}
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -179,6 +214,9 @@ func (ws *WebSocket) Send(message any) error {
 		return fmt.Errorf("websocket connection is null")
 	}
 
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
 	return ws.connection.WriteJSON(message)
 }
 
@@ -192,5 +230,8 @@ func (ws *WebSocket) SendBinary(b []byte) error {
 		return fmt.Errorf("websocket connection is null")
 	}
 
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
 	return ws.connection.WriteMessage(websocket.BinaryMessage, b)
 }
@@ -63,6 +63,14 @@ func (ts *testServer) handleWebSocket(w http.ResponseWriter, req *http.Request)
 	}
 }
 
+// counts of connections and messages, the handler writes them
+func (ts *testServer) counts() (int, int) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	return len(ts.connections), len(ts.messages)
+}
+
 func newTestServer(t *testing.T) *testServer {
 	ts := testServer{
 		upgrader: websocket.Upgrader{
@@ -89,8 +97,8 @@ func TestWebSocket(t *testing.T) {
 	)
 	defer ws.Close()
 
-	if len(ts.connections) > 0 {
-		t.Errorf("test server has connections %d", len(ts.connections))
+	if connections, _ := ts.counts(); connections > 0 {
+		t.Errorf("test server has connections %d", connections)
 		return
 	}
 
@@ -103,13 +111,13 @@ func TestWebSocket(t *testing.T) {
 		// wait connect
 		time.Sleep(100 * time.Millisecond)
 
-		if len(ts.connections) == 0 {
+		if connections, _ := ts.counts(); connections == 0 {
 			t.Errorf("test server has no connection")
 		}
 	})
 
-	if len(ts.messages) > 0 {
-		t.Errorf("test server has messages %d", len(ts.messages))
+	if _, messages := ts.counts(); messages > 0 {
+		t.Errorf("test server has messages %d", messages)
 		return
 	}
 
@@ -122,8 +130,78 @@ func TestWebSocket(t *testing.T) {
 		// wait send
 		time.Sleep(100 * time.Millisecond)
 
-		if len(ts.messages) == 0 {
+		if _, messages := ts.counts(); messages == 0 {
 			t.Errorf("test server has no message")
 		}
 	})
 }
+
+func TestAccept(t *testing.T) {
+	disconnected := make(chan error, 1)
+	accepted := make(chan *WebSocket, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, req *http.Request) {
+		ws, err := Accept(w, req)
+		if err != nil {
+			t.Errorf("accept error %v", err)
+			return
+		}
+
+		// echo
+		ws.OnMessage = func(messageType int, message []byte) {
+			ws.SendBinary(message)
+		}
+		ws.OnDisconnect = func(err error) {
+			disconnected <- err
+		}
+
+		err = ws.Open()
+		if err != nil {
+			t.Errorf("open error %v", err)
+		}
+		accepted <- ws
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	ws := NewWebSocket(fmt.Sprintf("ws://%s/ws", ts.Listener.Addr().String()), "")
+	received := make(chan []byte, 1)
+	ws.OnMessage = func(messageType int, message []byte) {
+		received <- message
+	}
+
+	t.Run("should echo, because accepted", func(t *testing.T) {
+		err := ws.Open()
+		if err != nil {
+			t.Fatalf("open error %v", err)
+		}
+
+		err = ws.SendBinary([]byte("hello"))
+		if err != nil {
+			t.Fatalf("send error %v", err)
+		}
+
+		select {
+		case b := <-received:
+			if string(b) != "hello" {
+				t.Errorf("message not match %s", b)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("no message")
+		}
+	})
+
+	t.Run("should disconnect, because client closed", func(t *testing.T) {
+		sws := <-accepted
+		defer sws.Close()
+
+		ws.Close()
+
+		select {
+		case <-disconnected:
+		case <-time.After(time.Second):
+			t.Errorf("not disconnected")
+		}
+	})
+}
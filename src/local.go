@@ -0,0 +1,200 @@
+package src
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"device-go/src/libs/server"
+	"device-go/src/packages/snapshot"
+)
+
+// mjpeg stream defaults, full size jpeg is expensive to encode
+const mjpegDefaultWidth uint = 1280
+const mjpegDefaultFps uint = 5
+const mjpegMaxFps uint = 15
+const mjpegBoundary = "frame"
+
+// create a random local api token
+func newLocalApiToken() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// open local http api, all apis use bearer token in config
+func (d *Device) openLocalApi() error {
+	if d.localApiAddr == "" {
+		return nil
+	}
+
+	// create token at first open
+	if d.cf.Config.LocalApiToken == "" {
+		token, err := newLocalApiToken()
+		if err != nil {
+			return err
+		}
+
+		d.cf.Config.LocalApiToken = token
+		err = d.cf.Save()
+		if err != nil {
+			log.Println("device config save error", err)
+		}
+		log.Println("device local api token created, saved to", d.cf.path)
+	}
+
+	token := d.cf.Config.LocalApiToken
+
+	d.local.Handle("GET /api/snapshot", server.WithBearerToken(token, d.handleLocalSnapshot))
+	d.local.Handle("GET /metrics", server.WithBearerToken(token, d.handleLocalMetrics))
+	d.local.Handle("GET /api/screen/events", server.WithBearerToken(token, d.handleLocalScreenEvents))
+
+	// standard webrtc viewers, trickle ice is not supported, so patch responds 405
+	if d.whepMaxSessions > 0 {
+		d.local.Handle("POST /api/whep", server.WithBearerToken(token, d.handleLocalWhep))
+		d.local.Handle("DELETE /api/whep/{id}", server.WithBearerToken(token, d.handleLocalWhepStop))
+	}
+
+	// signaling without cloud, browsers could not set headers of websocket
+	if d.localSignal != LocalSignalOff {
+		d.local.Handle("GET /api/signal", server.WithQueryToken(token, d.handleLocalSignal))
+	}
+
+	// fallback viewing for networks without webrtc, players may not set headers
+	d.local.Handle("GET /hls/{name}", server.WithQueryToken(token, d.handleLocalHls))
+	d.local.Handle("GET /api/mjpeg", server.WithQueryToken(token, d.handleLocalMjpeg))
+
+	return d.local.Open()
+}
+
+func (d *Device) closeLocalApi() {
+	d.local.Close()
+}
+
+func useQueryUint(req *http.Request, key string) (uint, error) {
+	v := req.URL.Query().Get(key)
+	if v == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseUint(v, 10, 32)
+	return uint(n), err
+}
+
+// GET /api/snapshot?width=&height=&format=jpeg|png
+func (d *Device) handleLocalSnapshot(w http.ResponseWriter, req *http.Request) {
+	width, err := useQueryUint(req, "width")
+	if err != nil {
+		server.WriteError(w, http.StatusBadRequest, "invalid width")
+		return
+	}
+	height, err := useQueryUint(req, "height")
+	if err != nil {
+		server.WriteError(w, http.StatusBadRequest, "invalid height")
+		return
+	}
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = snapshot.SnapshotFormatJpeg
+	} else if format != snapshot.SnapshotFormatJpeg && format != snapshot.SnapshotFormatPng {
+		server.WriteError(w, http.StatusBadRequest, "invalid format")
+		return
+	}
+
+	data, err := d.snapshot.Capture(width, height, format)
+	if err != nil {
+		log.Println("device local snapshot error", err)
+		server.WriteError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/"+format)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
+
+// GET /api/mjpeg?width=&height=&fps=, multipart jpeg stream
+func (d *Device) handleLocalMjpeg(w http.ResponseWriter, req *http.Request) {
+	width, err := useQueryUint(req, "width")
+	if err != nil {
+		server.WriteError(w, http.StatusBadRequest, "invalid width")
+		return
+	}
+	height, err := useQueryUint(req, "height")
+	if err != nil {
+		server.WriteError(w, http.StatusBadRequest, "invalid height")
+		return
+	}
+	fps, err := useQueryUint(req, "fps")
+	if err != nil || fps > mjpegMaxFps {
+		server.WriteError(w, http.StatusBadRequest, "invalid fps")
+		return
+	}
+
+	if width == 0 && height == 0 {
+		width = mjpegDefaultWidth
+	}
+	if fps == 0 {
+		fps = mjpegDefaultFps
+	}
+
+	rc := http.NewResponseController(w)
+
+	started := false
+	err = d.snapshot.Stream(req.Context(), width, height, fps, func(data []byte) error {
+		if !started {
+			w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mjpegBoundary)
+			w.Header().Set("Cache-Control", "no-store")
+			started = true
+		}
+
+		_, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", mjpegBoundary, len(data))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte("\r\n"))
+		if err != nil {
+			return err
+		}
+
+		return rc.Flush()
+	})
+	if err != nil && !started {
+		log.Println("device local mjpeg error", err)
+		server.WriteError(w, http.StatusServiceUnavailable, err.Error())
+	}
+}
+
+func writeMetric(w http.ResponseWriter, name string, t string, help string, value any) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, t, name, value)
+}
+
+// GET /metrics, prometheus text format
+func (d *Device) handleLocalMetrics(w http.ResponseWriter, req *http.Request) {
+	vs := d.videoStats.Report()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	writeMetric(w, "kvvm_video_frames_total", "counter", "Video frames", vs.Frames)
+	writeMetric(w, "kvvm_video_key_frames_total", "counter", "Video key frames", vs.KeyFrames)
+	writeMetric(w, "kvvm_video_bytes_total", "counter", "Video bytes", vs.Bytes)
+	writeMetric(w, "kvvm_video_fps", "gauge", "Video frames per second", vs.FPS)
+	writeMetric(w, "kvvm_video_bitrate_bps", "gauge", "Video bitrate in bits per second", vs.Bitrate)
+	writeMetric(w, "kvvm_video_key_frame_interval_seconds", "gauge", "Video key frame interval", vs.KeyFrameInterval)
+	writeMetric(w, "kvvm_video_width", "gauge", "Video width in sps", vs.Width)
+	writeMetric(w, "kvvm_video_height", "gauge", "Video height in sps", vs.Height)
+
+	d.wrtcStats.writeMetrics(w)
+}
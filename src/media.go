@@ -0,0 +1,424 @@
+package src
+
+import (
+	"fmt"
+	"log"
+
+	WEBRTC "github.com/pion/webrtc/v4"
+
+	"device-go/src/libs/h264"
+	"device-go/src/libs/webrtc"
+	"device-go/src/packages/gstreamer"
+	"device-go/src/packages/synthetic"
+	"device-go/src/packages/video"
+)
+
+// media source is shared by sinks, webrtc session, record, rtsp, hls...
+// it starts with the first sink and stops after the last one
+
+// media sink, callbacks are called in the goroutine of media source
+type mediaSink struct {
+	// h264 access unit, timestamp in microseconds, only when codec is h264
+	OnAccessUnit func(timestamp uint64, au []byte)
+	// encoded frame of video and synthetic source, timestamp in microseconds
+	OnSample func(timestamp uint64, frame []byte)
+	// rtp packet of gstreamer source
+	OnRtp func(b []byte)
+}
+
+const (
+	mediaSinkWebRTC = "webrtc"
+	mediaSinkRecord = "record"
+	mediaSinkRtsp   = "rtsp"
+	mediaSinkHls    = "hls"
+)
+
+func (d *Device) mediaRunning() bool {
+	return d.mv != nil || d.mg != nil || d.ms != nil
+}
+
+func (d *Device) hasMediaSink(name string) bool {
+	d.mediaSinksMu.RLock()
+	defer d.mediaSinksMu.RUnlock()
+
+	_, ok := d.mediaSinks[name]
+	return ok
+}
+
+func (d *Device) eachMediaSink(f func(s mediaSink)) {
+	d.mediaSinksMu.RLock()
+	defer d.mediaSinksMu.RUnlock()
+
+	for _, s := range d.mediaSinks {
+		f(s)
+	}
+}
+
+func (d *Device) writeMediaAccessUnit(timestamp uint64, au []byte) {
+	d.videoStats.Update(timestamp, au)
+
+	if d.snapshotDecode.Load() {
+		d.writeSnapshotKeyFrame(au)
+	}
+
+	d.eachMediaSink(func(s mediaSink) {
+		if s.OnAccessUnit != nil {
+			s.OnAccessUnit(timestamp, au)
+		}
+	})
+}
+
+// write frame of video and synthetic source
+func (d *Device) writeMediaSample(timestamp uint64, frame []byte) {
+	isH264 := d.mediaCodec == webrtc.VideoCodecH264
+	if isH264 {
+		frame = d.videoParams.Prepend(frame)
+	}
+
+	d.eachMediaSink(func(s mediaSink) {
+		if s.OnSample != nil {
+			s.OnSample(timestamp, frame)
+		}
+	})
+
+	if isH264 {
+		d.writeMediaAccessUnit(timestamp, frame)
+	}
+}
+
+// write rtp packet of gstreamer source
+func (d *Device) writeMediaRtp(b []byte) {
+	d.eachMediaSink(func(s mediaSink) {
+		if s.OnRtp != nil {
+			s.OnRtp(b)
+		}
+	})
+
+	if d.mediaCodec != webrtc.VideoCodecH264 {
+		return
+	}
+
+	// rtp timestamp is 90kHz
+	au, pts, ok := d.videoRtp.Write(b)
+	if ok {
+		d.writeMediaAccessUnit(pts*100/9, d.videoParams.Prepend(au))
+	}
+}
+
+// gstreamer source restarted by watchdog, rtp of the new pipeline has another timestamp base
+func (d *Device) restartMediaRtp(reason string, count uint, stderr []string, err error) {
+	d.videoRtp.Reset()
+	d.sendMediaRestart(reason, count, stderr, err)
+}
+
+// media start, snapshots follow the source
+func (d *Device) mediaStart(codec string) error {
+	err := d.mediaStartSource(codec)
+	d.snapshotSync()
+
+	return err
+}
+
+func (d *Device) mediaStartSource(codec string) error {
+	// h264 stream statistics
+	d.mediaCodec = codec
+	d.videoParams = h264.ParameterSets{}
+	d.videoRtp.Reset()
+	d.videoStats.Reset()
+
+	// frame processors need raw frames before encoding
+	if len(d.frameChain) > 0 && (d.mediaSource == DeviceMediaSourceVideo || d.mediaSource == DeviceMediaSourceGst) {
+		return d.mediaStartRaw(codec)
+	}
+
+	q := d.mediaQuality
+
+	switch d.mediaSource {
+	case DeviceMediaSourceVideo:
+		{
+			if d.mv != nil {
+				return fmt.Errorf("device mv exists")
+			}
+			// the helper captures the device
+			d.rawClose()
+
+			mv := video.NewVideo(
+				d.videoPath,
+				d.videoBinPath,
+				d.videoSocketPath,
+				q.Width,
+				q.Height,
+				q.BitRate,
+				q.Gop,
+				codec,
+			)
+			d.mv = &mv
+
+			// set callback
+			d.mv.OnData = func(id uint32, timestamp uint64, frame []byte) {
+				d.writeMediaSample(timestamp, frame)
+			}
+			d.mv.OnRestart = d.sendMediaRestart
+
+			return d.mv.Open()
+		}
+	case DeviceMediaSourceGst:
+		{
+			if d.mg != nil {
+				return fmt.Errorf("device mg exists")
+			}
+			// the pipeline captures the device
+			d.rawClose()
+
+			mg, err := gstreamer.NewGstreamer(
+				d.gstProfile,
+				d.videoPath,
+				"localhost",
+				10000,
+				q.Width,
+				q.Height,
+				q.BitRate,
+				q.Gop,
+				q.Fps,
+				codec,
+			)
+			if err != nil {
+				return err
+			}
+			d.mg = &mg
+
+			d.mg.OnData = d.writeMediaRtp
+			d.mg.OnRestart = d.restartMediaRtp
+
+			return d.mg.Open()
+		}
+	case DeviceMediaSourceSynthetic:
+		{
+			if d.ms != nil {
+				return fmt.Errorf("device ms exists")
+			} else if codec != webrtc.VideoCodecH264 {
+				return fmt.Errorf("synthetic unsupported codec %s", codec)
+			}
+
+			ms := synthetic.NewSynthetic(
+				d.syntheticPath,
+				q.Width,
+				q.Height,
+				q.Fps,
+				q.Gop,
+			)
+			d.ms = &ms
+
+			if len(d.frameChain) > 0 {
+				d.ms.Processor = d.frameChain
+			}
+			d.ms.OnData = func(id uint32, timestamp uint64, frame []byte) {
+				d.writeMediaSample(timestamp, frame)
+			}
+
+			return d.ms.Open()
+		}
+	default:
+		return fmt.Errorf("unknown media source %d", d.mediaSource)
+	}
+}
+
+// media stop
+func (d *Device) mediaStop() {
+	d.rawMu.Lock()
+	d.rawEncoder = nil
+	d.rawChain = nil
+	d.rawMu.Unlock()
+
+	if d.mv != nil {
+		d.mv.Close()
+		d.mv = nil
+	} else if d.mg != nil {
+		d.mg.Close()
+		d.mg = nil
+	} else if d.ms != nil {
+		d.ms.Close()
+		d.ms = nil
+	}
+
+	// the device is free, snapshots capture it again
+	d.rawSync()
+	d.snapshotSync()
+}
+
+// add media sink, media starts with codec if it is not running, fallback to h264
+//
+// when media is running, its codec is used, use sink creates the sink with the codec of media
+func (d *Device) mediaAcquire(name string, codec string, useSink func(codec string) (mediaSink, error)) error {
+	d.mediaMu.Lock()
+	defer d.mediaMu.Unlock()
+
+	started := false
+	if !d.mediaRunning() {
+		err := d.mediaStart(codec)
+		if err != nil && codec != webrtc.VideoCodecH264 {
+			log.Println("device media start error, fallback to h264", codec, err)
+			d.mediaStop()
+			err = d.mediaStart(webrtc.VideoCodecH264)
+		}
+		if err != nil {
+			d.mediaStop()
+			return err
+		}
+
+		log.Println("device media start", d.mediaCodec)
+		started = true
+	}
+
+	sink, err := useSink(d.mediaCodec)
+	if err != nil {
+		if started {
+			d.mediaStop()
+		}
+		return err
+	}
+
+	d.mediaSinksMu.Lock()
+	d.mediaSinks[name] = sink
+	d.mediaSinksMu.Unlock()
+
+	return nil
+}
+
+// remove media sink, media stops after the last sink
+func (d *Device) mediaRelease(name string) {
+	d.mediaMu.Lock()
+	defer d.mediaMu.Unlock()
+
+	d.mediaSinksMu.Lock()
+	delete(d.mediaSinks, name)
+	n := len(d.mediaSinks)
+	d.mediaSinksMu.Unlock()
+
+	if n == 0 && d.mediaRunning() {
+		log.Println("device media stop")
+		d.mediaStop()
+		d.mediaQuality = defaultQuality()
+	}
+}
+
+// remove all media sinks and stop media
+func (d *Device) mediaClose() {
+	d.mediaMu.Lock()
+	defer d.mediaMu.Unlock()
+
+	d.mediaSinksMu.Lock()
+	clear(d.mediaSinks)
+	d.mediaSinksMu.Unlock()
+
+	d.mediaStop()
+	d.mediaQuality = defaultQuality()
+}
+
+// record start, only h264 could be recorded, media started by other sinks may run another codec,
+// called under record lock
+func (d *Device) recordStart() {
+	if d.recordPath == "" || d.recording {
+		return
+	}
+
+	err := d.record.Open()
+	if err != nil {
+		log.Println("device record open error", err)
+		return
+	}
+
+	err = d.mediaAcquire(mediaSinkRecord, webrtc.VideoCodecH264, func(codec string) (mediaSink, error) {
+		if codec != webrtc.VideoCodecH264 {
+			return mediaSink{}, newDeviceError(DeviceErrorCodecUnsupported, "record needs h264, media runs %s", codec)
+		}
+
+		return mediaSink{OnAccessUnit: d.record.WriteAccessUnit}, nil
+	})
+	if err != nil {
+		log.Println("device record skip", err)
+		d.record.Close()
+		// the server knows the session is not recorded
+		d.sendMqttEvent(NewDeviceErrorMessage(err))
+		return
+	}
+
+	d.recording = true
+}
+
+// record stop, called under record lock
+func (d *Device) recordStop() {
+	if !d.recording {
+		return
+	}
+
+	d.mediaRelease(mediaSinkRecord)
+	d.record.Close()
+	d.recording = false
+}
+
+// add video track of codec, it is a sink of media, called in media acquire
+func (d *Device) useVideoTrackSink(wrtc *webrtc.WebRTC, codec string) (mediaSink, error) {
+	capability := webrtc.VideoCodecCapability(codec)
+	// gstreamer source, or the encoder of frame processors
+	if d.mg != nil {
+		err := wrtc.AddVideoTrackRtp(capability)
+		return mediaSink{OnRtp: func(b []byte) { wrtc.WriteVideoTrackRtp(b) }}, err
+	}
+
+	err := wrtc.AddVideoTrackSample(capability)
+	return mediaSink{OnSample: func(timestamp uint64, frame []byte) { wrtc.WriteVideoTrackSample(frame, timestamp) }}, err
+}
+
+// webrtc media start, at the first offer
+//
+// when media is running, its codec is used, so sinks could share it
+func (d *Device) wrtcMediaStart(wrtc *webrtc.WebRTC, offer *WEBRTC.SessionDescription) error {
+	d.recordMu.Lock()
+	defer d.recordMu.Unlock()
+
+	if d.hasMediaSink(mediaSinkWebRTC) {
+		return nil
+	}
+
+	// media of other sinks keeps its codec and quality, recorded sessions use h264
+	running := ""
+	d.mediaMu.Lock()
+	if d.mediaRunning() {
+		running = d.mediaCodec
+	} else {
+		d.mediaQuality = d.wrtcQuality
+	}
+	d.mediaMu.Unlock()
+
+	codecs := webrtc.SessionVideoCodecs(d.videoCodecs, running, d.recordPath != "")
+	codec := webrtc.NegotiateVideoCodec(offer, codecs)
+
+	err := d.mediaAcquire(mediaSinkWebRTC, codec, func(codec string) (mediaSink, error) {
+		log.Println("device use video codec", codec)
+
+		return d.useVideoTrackSink(wrtc, codec)
+	})
+	if err != nil {
+		return err
+	}
+
+	// sessions are recorded
+	d.recordStart()
+
+	d.wrtcAudioStart(offer)
+
+	return nil
+}
+
+// webrtc media stop
+func (d *Device) wrtcMediaStop() {
+	d.micStop()
+	d.audioStop()
+
+	d.recordMu.Lock()
+	defer d.recordMu.Unlock()
+
+	d.recordStop()
+	d.mediaRelease(mediaSinkWebRTC)
+}
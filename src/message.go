@@ -6,6 +6,9 @@ import (
 	"time"
 
 	"github.com/pion/webrtc/v4"
+
+	"device-go/src/libs/edid"
+	"device-go/src/packages/screen"
 )
 
 const (
@@ -16,6 +19,19 @@ const (
 	WebRTCIceCandidate string = "webrtc-ice-candidate"
 	WebRTCOffer        string = "webrtc-offer"
 	WebRTCAnswer       string = "webrtc-answer"
+	WebRTCQuality      string = "webrtc-quality"
+	WebRTCIceRestart   string = "webrtc-ice-restart"
+	SnapshotCapture    string = "snapshot-capture"
+	ScreenEvent        string = "screen-event"
+	MediaRestart       string = "media-restart"
+	WebRTCStats        string = "webrtc-stats"
+	Clipboard          string = "clipboard"
+	SessionWarning     string = "session-warning"
+	SessionEnd         string = "session-end"
+	SessionKick        string = "session-kick"
+	EdidGet            string = "edid-get"
+	EdidSet            string = "edid-set"
+	GrantKeySet        string = "grant-key-set"
 	Error              string = "error"
 )
 
@@ -23,18 +39,53 @@ type DeviceMessage struct {
 	Time int64  `json:"time"`
 	Type string `json:"type"`
 
-	// webrtc start
+	// webrtc start, grant of the session role is signed by the server
 	IceServers []DeviceMessageIceServer `json:"iceServers,omitempty"`
+	Grant      string                   `json:"grant,omitempty"`
+	// send hdmi audio in the session
+	Audio bool `json:"audio,omitempty"`
+	// play browser microphone to the target through usb audio gadget
+	Microphone bool `json:"microphone,omitempty"`
+	// video quality of the session, and webrtc quality
+	Quality *DeviceMessageQuality `json:"quality,omitempty"`
 
-	// webrtc ice candidate
-	IceCandidate  *webrtc.ICECandidateInit  `json:"iceCandidate,omitempty"`
-	IceCandidates []webrtc.ICECandidateInit `json:"iceCandidates,omitempty"`
+	// webrtc ice candidate, a batch of candidates, done is end of candidates
+	IceCandidate      *webrtc.ICECandidateInit  `json:"iceCandidate,omitempty"`
+	IceCandidates     []webrtc.ICECandidateInit `json:"iceCandidates,omitempty"`
+	IceCandidatesDone bool                      `json:"iceCandidatesDone,omitempty"`
 
-	// webrtc offer
+	// webrtc offer, and ice restart offer of device
 	Offer *webrtc.SessionDescription `json:"offer,omitempty"`
 
-	// webrtc answer
+	// webrtc answer, and answer of client to ice restart
 	Answer *webrtc.SessionDescription `json:"answer,omitempty"`
+
+	// snapshot capture
+	Snapshot *DeviceMessageSnapshot `json:"snapshot,omitempty"`
+
+	// screen change or idle
+	ScreenEvent *screen.ScreenEvent `json:"screenEvent,omitempty"`
+
+	// grant key set, hmac key of session grants, it is not sent back
+	GrantKey []byte `json:"grantKey,omitempty"`
+
+	// edid get and set
+	Edid *DeviceMessageEdid `json:"edid,omitempty"`
+
+	// video restarted by watchdog
+	MediaRestart *DeviceMessageMediaRestart `json:"mediaRestart,omitempty"`
+
+	// connection quality, a report of the session, or a summary of the session to mqtt
+	WebRTCStats *DeviceMessageWebRTCStats `json:"webrtcStats,omitempty"`
+
+	// clipboard response
+	Clipboard *DeviceMessageClipboard `json:"clipboard,omitempty"`
+
+	// session warning and end, reason of kick request
+	Session *DeviceMessageSession `json:"session,omitempty"`
+
+	// typed error of error message
+	Error *DeviceMessageError `json:"error,omitempty"`
 }
 
 func NewDeviceMessage(t string) DeviceMessage {
@@ -70,3 +121,96 @@ func (iceServer *DeviceMessageIceServer) ToWebrtcIceServer() webrtc.ICEServer {
 		Credential: iceServer.Credential,
 	}
 }
+
+// snapshot request and response
+//
+// data is the image in response, through data channel,
+// data is empty and the image follows in binary messages of total size
+type DeviceMessageSnapshot struct {
+	Width  uint   `json:"width,omitempty"`
+	Height uint   `json:"height,omitempty"`
+	Format string `json:"format,omitempty"`
+	Size   int    `json:"size,omitempty"`
+	Data   []byte `json:"data,omitempty"`
+}
+
+// edid request and response
+//
+// set uses preset, or data if preset is empty, response has the current edid of capture input
+type DeviceMessageEdid struct {
+	Preset  string     `json:"preset,omitempty"`
+	Data    []byte     `json:"data,omitempty"`
+	Info    *edid.Edid `json:"info,omitempty"`
+	Presets []string   `json:"presets,omitempty"`
+}
+
+// video restart, reason is stall or eof, count of consecutive restarts,
+// stderr is the last lines of the stopped helper, error is of the new start
+type DeviceMessageMediaRestart struct {
+	Reason string   `json:"reason"`
+	Count  uint     `json:"count"`
+	Stderr []string `json:"stderr,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// video quality, preset or explicit values, explicit values override the preset
+//
+// size is the encoded size, bit rate in kbit/s, zero values are of the preset
+type DeviceMessageQuality struct {
+	Preset  string `json:"preset,omitempty"`
+	Width   uint   `json:"width,omitempty"`
+	Height  uint   `json:"height,omitempty"`
+	BitRate uint   `json:"bitRate,omitempty"`
+	Fps     uint   `json:"fps,omitempty"`
+	Gop     uint   `json:"gop,omitempty"`
+}
+
+// connection quality, rtt and jitter in seconds, bit rate in bit/s, counts are of the session
+//
+// summary has the duration in seconds and count of reports, rtt and bit rate are averages then
+type DeviceMessageWebRTCStats struct {
+	Rtt                 float64 `json:"rtt"`
+	Jitter              float64 `json:"jitter"`
+	FractionLost        float64 `json:"fractionLost"`
+	PacketsLost         int64   `json:"packetsLost"`
+	Nacks               uint32  `json:"nacks"`
+	Plis                uint32  `json:"plis"`
+	Firs                uint32  `json:"firs"`
+	BitRate             float64 `json:"bitRate"`
+	LocalCandidateType  string  `json:"localCandidateType,omitempty"`
+	RemoteCandidateType string  `json:"remoteCandidateType,omitempty"`
+	Protocol            string  `json:"protocol,omitempty"`
+
+	Duration        float64 `json:"duration,omitempty"`
+	Reports         uint64  `json:"reports,omitempty"`
+	RttMax          float64 `json:"rttMax,omitempty"`
+	FractionLostMax float64 `json:"fractionLostMax,omitempty"`
+}
+
+// clipboard request and response
+//
+// paste sends text to the target by hid typing or the agent, typed is the count of typed characters,
+// copy responds text of the target by the agent, or ocr of the region in capture pixels, whole screen if empty
+type DeviceMessageClipboard struct {
+	Action string `json:"action"`
+	Via    string `json:"via,omitempty"`
+	Text   string `json:"text,omitempty"`
+	Typed  int    `json:"typed,omitempty"`
+
+	X      int `json:"x,omitempty"`
+	Y      int `json:"y,omitempty"`
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+}
+
+// session limit, reason is idle, max-duration or kick, remaining seconds before end of warning
+type DeviceMessageSession struct {
+	Reason    string `json:"reason,omitempty"`
+	Remaining uint   `json:"remaining,omitempty"`
+}
+
+// typed error, eg. grant-required, grant-invalid, grant-expired or permission-denied
+type DeviceMessageError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,88 @@
+package src
+
+import (
+	"log"
+	"strings"
+
+	WEBRTC "github.com/pion/webrtc/v4"
+
+	"device-go/src/packages/uac"
+)
+
+const DeviceMicSinkNone uint = 0
+const DeviceMicSinkHelper uint = 1
+const DeviceMicSinkGst uint = 2
+
+// rtp port of gstreamer microphone, video uses 10000, audio uses 10002
+const micGstPort = 10004
+
+const micRtpBufferSize = 1500
+
+// use remote track, browser microphone is played to the usb audio gadget
+//
+// it is called in its own goroutine, and returns when the track ends
+func (d *Device) useTrack(track *WEBRTC.TrackRemote) {
+	if track.Kind() != WEBRTC.RTPCodecTypeAudio {
+		log.Println("device remote track skip", track.Kind())
+		return
+	} else if d.micSink == DeviceMicSinkNone || !d.wrtcMicrophone {
+		log.Println("device microphone skip, it is not enabled")
+		return
+	} else if !strings.EqualFold(track.Codec().MimeType, WEBRTC.MimeTypeOpus) {
+		log.Println("device microphone skip, unsupported codec", track.Codec().MimeType)
+		return
+	}
+
+	u, err := d.micStart()
+	if err != nil {
+		log.Println("device microphone start error", err)
+		d.micStop()
+		return
+	}
+	defer d.micStop()
+
+	log.Println("device microphone start")
+
+	b := make([]byte, micRtpBufferSize)
+	for {
+		n, _, err := track.Read(b)
+		if err != nil {
+			log.Println("device microphone end", err)
+			return
+		}
+
+		err = u.WriteRtp(b[:n])
+		if err != nil {
+			log.Println("device microphone write error", err)
+		}
+	}
+}
+
+func (d *Device) micStart() (*uac.Uac, error) {
+	d.micMu.Lock()
+	defer d.micMu.Unlock()
+
+	if d.mic != nil {
+		d.mic.Close()
+	}
+
+	var u uac.Uac
+	if d.micSink == DeviceMicSinkGst {
+		u = uac.NewUacGstreamer(d.micHardware, micGstPort)
+	} else {
+		u = uac.NewUac(d.micHardware, d.micBinPath, d.micSocketPath)
+	}
+	d.mic = &u
+
+	return d.mic, d.mic.Open()
+}
+
+func (d *Device) micStop() {
+	d.micMu.Lock()
+	defer d.micMu.Unlock()
+
+	if d.mic != nil {
+		d.mic.Close()
+		d.mic = nil
+	}
+}
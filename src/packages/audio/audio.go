@@ -0,0 +1,80 @@
+package audio
+
+import (
+	"strconv"
+
+	"device-go/src/libs/exec"
+	"device-go/src/libs/socket"
+)
+
+// opus frame duration in milliseconds
+const audioFrameDuration uint = 20
+
+type AudioOnData func(id uint32, timestamp uint64, packet []byte)
+
+// audio capture, the helper captures alsa and encodes to opus
+//
+// the framing is the same as speech record, every message is an opus packet,
+// timestamp is the capture time in microseconds, same clock as video
+type Audio struct {
+	ex     exec.Exec
+	socket socket.Socket
+
+	OnData AudioOnData
+}
+
+func NewAudio(
+	hardware string,
+	binPath string,
+	socketPath string,
+	sampleRate uint,
+	channel uint,
+	bitRate uint,
+) Audio {
+	return Audio{
+		ex: exec.NewExec(
+			binPath,
+			"-d", hardware,
+			"-s", socketPath,
+			// opus
+			"-e", "opus",
+			"-r", strconv.FormatUint(uint64(sampleRate), 10),
+			"-c", strconv.FormatUint(uint64(channel), 10),
+			"-b", strconv.FormatUint(uint64(bitRate), 10),
+			"-t", strconv.FormatUint(uint64(audioFrameDuration), 10),
+		),
+		socket: socket.NewSocket(socketPath),
+	}
+}
+
+func (a *Audio) Open() error {
+	a.socket.OnData = func(header socket.SocketHeader, body []byte) {
+		if a.OnData == nil {
+			return
+		}
+		a.OnData(header.ID, header.Timestamp, body)
+	}
+
+	err := a.socket.Open()
+	if err != nil {
+		return err
+	}
+
+	err = a.ex.Start()
+	if err != nil {
+		a.socket.Close()
+		return err
+	}
+
+	return nil
+}
+
+func (a *Audio) Close() {
+	a.ex.Stop()
+	a.socket.Close()
+}
+
+// last lines of helper stderr, for diagnostics
+func (a *Audio) Stderr() []string {
+	return a.ex.Stderr()
+}
@@ -0,0 +1,79 @@
+package clipboard
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// agent requests are on the lan
+const agentTimeout = 5 * time.Second
+
+// clipboard text size limit
+const MaxTextSize = 64 * 1024
+
+// http agent on the target, it reads and writes the clipboard of the target
+//
+// `GET <url>/clipboard` responds text, `PUT <url>/clipboard` sets text in body, both are text/plain
+type Agent struct {
+	client http.Client
+	url    string
+	token  string
+}
+
+func NewAgent(url string, token string) Agent {
+	return Agent{
+		client: http.Client{Timeout: agentTimeout},
+		url:    strings.TrimSuffix(url, "/"),
+		token:  token,
+	}
+}
+
+func (a *Agent) do(ctx context.Context, method string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, a.url+"/clipboard", body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, MaxTextSize+1))
+	if err != nil {
+		return nil, err
+	} else if res.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("clipboard agent status %d", res.StatusCode)
+	} else if len(b) > MaxTextSize {
+		return nil, fmt.Errorf("clipboard agent text too large")
+	}
+
+	return b, nil
+}
+
+// read clipboard of the target
+func (a *Agent) Read(ctx context.Context) (string, error) {
+	b, err := a.do(ctx, http.MethodGet, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// write clipboard of the target
+func (a *Agent) Write(ctx context.Context, text string) error {
+	_, err := a.do(ctx, http.MethodPut, strings.NewReader(text))
+
+	return err
+}
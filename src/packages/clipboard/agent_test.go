@@ -0,0 +1,59 @@
+package clipboard
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAgent(t *testing.T) {
+	t.Run("should read and write clipboard of agent", func(t *testing.T) {
+		text := "hello"
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/clipboard" || req.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			switch req.Method {
+			case http.MethodGet:
+				io.WriteString(w, text)
+			case http.MethodPut:
+				b, _ := io.ReadAll(req.Body)
+				text = string(b)
+			}
+		}))
+		defer s.Close()
+
+		a := NewAgent(s.URL+"/", "token")
+
+		err := a.Write(context.Background(), "world")
+		if err != nil {
+			t.Fatalf("write error %v", err)
+		}
+
+		got, err := a.Read(context.Background())
+		if err != nil {
+			t.Fatalf("read error %v", err)
+		}
+		if got != "world" {
+			t.Errorf("text not match %s", got)
+		}
+	})
+
+	t.Run("should be error, because agent rejects", func(t *testing.T) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer s.Close()
+
+		a := NewAgent(s.URL, "")
+
+		_, err := a.Read(context.Background())
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package clipboard
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// recognition of a region is slow on the device
+const ocrTimeout = 15 * time.Second
+
+// text recognition by a tesseract compatible bin, image in stdin, text in stdout
+type Ocr struct {
+	binPath string
+	lang    string
+}
+
+func NewOcr(binPath string, lang string) Ocr {
+	return Ocr{binPath: binPath, lang: lang}
+}
+
+// recognize text of a png or jpeg image
+func (o *Ocr) Recognize(ctx context.Context, image []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, ocrTimeout)
+	defer cancel()
+
+	args := []string{"stdin", "stdout"}
+	if o.lang != "" {
+		args = append(args, "-l", o.lang)
+	}
+
+	stderr := bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, o.binPath, args...)
+	cmd.Stdin = bytes.NewReader(image)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("clipboard ocr error %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
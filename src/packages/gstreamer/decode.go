@@ -0,0 +1,71 @@
+package gstreamer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"device-go/src/libs/frame"
+	"device-go/src/libs/h264"
+)
+
+// decoding a key frame starts a pipeline, it is slow on the device
+const gstreamerDecodeTimeout = 5 * time.Second
+
+// h264 access unit in stdin, nv12 frame in stdout
+var gstreamerDecodeH264Args = []string{
+	"-q", "fdsrc", "fd=0", "!", "h264parse", "!", "avdec_h264", "!",
+	"videoconvert", "!", "video/x-raw,format=NV12", "!", "fdsink", "fd=1",
+}
+
+// size of the key frame by its sps
+func keyFrameSize(au []byte) (uint, uint, error) {
+	if !h264.IsKeyFrame(au) {
+		return 0, 0, fmt.Errorf("gstreamer decode not key frame")
+	}
+
+	for _, nalu := range h264.Split(au) {
+		if h264.NALUnitType(nalu) != h264.NALUnitTypeSPS {
+			continue
+		}
+
+		sps, err := h264.ParseSPS(nalu)
+		if err != nil {
+			return 0, 0, err
+		}
+		return sps.Width, sps.Height, nil
+	}
+
+	return 0, 0, fmt.Errorf("gstreamer decode key frame has no sps")
+}
+
+// decode h264 key frame with parameter sets to nv12 frame, eg. a snapshot of encoded media
+func DecodeH264(ctx context.Context, au []byte) (frame.Frame, error) {
+	width, height, err := keyFrameSize(au)
+	if err != nil {
+		return frame.Frame{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gstreamerDecodeTimeout)
+	defer cancel()
+
+	stderr := bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, "gst-launch-1.0", gstreamerDecodeH264Args...)
+	cmd.Stdin = bytes.NewReader(au)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return frame.Frame{}, fmt.Errorf("gstreamer decode error %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	size := frame.Size(width, height)
+	if len(out) < size {
+		return frame.Frame{}, fmt.Errorf("gstreamer decode frame size %d under %d", len(out), size)
+	}
+
+	return frame.Frame{Width: width, Height: height, Data: out[:size]}, nil
+}
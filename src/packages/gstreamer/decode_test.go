@@ -0,0 +1,43 @@
+package gstreamer
+
+import (
+	"testing"
+
+	"device-go/src/libs/frame"
+	"device-go/src/libs/h264"
+)
+
+func TestKeyFrameSize(t *testing.T) {
+	e, err := h264.NewEncoder(64, 48, 30)
+	if err != nil {
+		t.Fatalf("encoder error %v", err)
+	}
+	key, err := e.Encode(frame.NewFrame(64, 48))
+	if err != nil {
+		t.Fatalf("encode error %v", err)
+	}
+
+	t.Run("should use size of sps", func(t *testing.T) {
+		width, height, err := keyFrameSize(key)
+		if err != nil {
+			t.Fatalf("size error %v", err)
+		}
+		if width != 64 || height != 48 {
+			t.Errorf("size not match %dx%d", width, height)
+		}
+	})
+
+	t.Run("should fail, because it is not key frame", func(t *testing.T) {
+		f := frame.NewFrame(64, 48)
+		f.Data[0] = 0xFF
+		delta, err := e.Encode(f)
+		if err != nil {
+			t.Fatalf("encode error %v", err)
+		}
+
+		_, _, err = keyFrameSize(delta)
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+}
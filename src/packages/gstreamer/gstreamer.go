@@ -2,21 +2,47 @@ package gstreamer
 
 import (
 	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
 
 	"device-go/src/libs/exec"
+	"device-go/src/libs/frame"
 	"device-go/src/libs/udp"
+	"device-go/src/libs/watchdog"
 )
 
+// no rtp packet in this duration is a stall, it includes the pipeline start
+const gstreamerStallTimeout = 5 * time.Second
+
+const gstreamerMinBackoff = time.Second
+const gstreamerMaxBackoff = 30 * time.Second
+
 type GstreamerOnData func(frame []byte)
 
+// pipeline is restarted, stderr is of the stopped pipeline
+type GstreamerOnRestart func(reason string, count uint, stderr []string, err error)
+
 type Gstreamer struct {
 	ex  exec.Exec
 	udp udp.UDP
 
-	OnData GstreamerOnData
+	// raw input, frames are written to stdin, it is replaced at restart
+	raw     bool
+	width   uint
+	height  uint
+	stdin   io.WriteCloser
+	stdinMu sync.Mutex
+
+	watchdog watchdog.Watchdog
+
+	OnData    GstreamerOnData
+	OnRestart GstreamerOnRestart
 }
 
 func NewGstreamer(
+	profile GstreamerProfile,
 	path string,
 	ip string,
 	port int,
@@ -24,24 +50,68 @@ func NewGstreamer(
 	height uint,
 	bitRate uint,
 	gop uint,
-) Gstreamer {
+	fps uint,
+	codec string,
+) (Gstreamer, error) {
+	args, err := profile.useArgs(codec, path, ip, port, width, height, bitRate, gop, fps)
+	if err != nil {
+		return Gstreamer{}, err
+	}
+
 	return Gstreamer{
-		ex: exec.NewExec(
-			"gst-launch-1.0", "-q",
-			// here we use `mmap` mode
-			// `drm` mode will get `core dump`, i do not know why
-			"v4l2src", "device="+path, "io-mode=mmap", "!",
-			fmt.Sprintf("video/x-raw,format=NV12,width=%d,height=%d", width, height), "!",
-			"mpph264enc", fmt.Sprintf("gop=%d", gop), "!",
-			"rtph264pay", "config-interval=-1", "aggregate-mode=zero-latency", "!",
-			"udpsink", "host="+ip, fmt.Sprintf("port=%d", port),
-		),
+		ex:  exec.NewExec("gst-launch-1.0", args...),
 		udp: udp.NewUDP(ip, port),
+	}, nil
+}
+
+// encode nv12 frames written by `WriteFrame`, eg. frames of processors
+func NewGstreamerRaw(
+	profile GstreamerProfile,
+	ip string,
+	port int,
+	width uint,
+	height uint,
+	bitRate uint,
+	gop uint,
+	fps uint,
+	codec string,
+) (Gstreamer, error) {
+	args, err := profile.useRawArgs(codec, ip, port, width, height, bitRate, gop, fps)
+	if err != nil {
+		return Gstreamer{}, err
+	}
+
+	return Gstreamer{
+		ex:     exec.NewExec("gst-launch-1.0", args...),
+		udp:    udp.NewUDP(ip, port),
+		raw:    true,
+		width:  width,
+		height: height,
+	}, nil
+}
+
+func (g *Gstreamer) restart(reason string, count uint) {
+	stderr := g.ex.Stderr()
+	log.Println("gstreamer restart", reason, count)
+
+	g.stop()
+	err := g.start()
+	if err != nil {
+		log.Println("gstreamer restart error", err)
+	}
+
+	if g.OnRestart != nil {
+		g.OnRestart(reason, count, stderr, err)
 	}
 }
 
 func (g *Gstreamer) Open() error {
+	// before udp, it feeds it
+	g.watchdog = watchdog.NewWatchdog(gstreamerStallTimeout, gstreamerMinBackoff, gstreamerMaxBackoff, g.restart)
+
 	g.udp.OnData = func(b []byte) {
+		g.watchdog.Feed()
+
 		if g.OnData == nil {
 			return
 		}
@@ -53,15 +123,73 @@ func (g *Gstreamer) Open() error {
 		return err
 	}
 
-	err = g.ex.Start()
+	err = g.start()
 	if err != nil {
 		g.udp.Close()
 		return err
 	}
+
+	// raw input stalls too if its frames stop, the writer is supervised by itself
+	g.watchdog.Open()
+
 	return nil
 }
 
-func (g *Gstreamer) Close() {
+func (g *Gstreamer) start() error {
+	if !g.raw {
+		return g.ex.Start()
+	}
+
+	stdin, err := g.ex.StartStdin()
+
+	g.stdinMu.Lock()
+	defer g.stdinMu.Unlock()
+	g.stdin = stdin
+
+	return err
+}
+
+// frames are skipped until start, then the pipeline is stopped
+func (g *Gstreamer) stop() {
+	g.stdinMu.Lock()
+	g.stdin = nil
+	g.stdinMu.Unlock()
+
 	g.ex.Stop()
+}
+
+// write nv12 frame of raw input, it is scaled to the pipeline size
+func (g *Gstreamer) WriteFrame(f frame.Frame) error {
+	if !g.raw {
+		return fmt.Errorf("gstreamer not raw input")
+	}
+
+	sf, err := f.Scale(g.width, g.height)
+	if err != nil {
+		return err
+	}
+
+	// not locked while writing, stop unblocks a write to a stalled pipeline
+	g.stdinMu.Lock()
+	stdin := g.stdin
+	g.stdinMu.Unlock()
+
+	// restarting
+	if stdin == nil {
+		return nil
+	}
+
+	_, err = stdin.Write(sf.Data[:frame.Size(sf.Width, sf.Height)])
+	return err
+}
+
+func (g *Gstreamer) Close() {
+	g.watchdog.Close()
+	g.stop()
 	g.udp.Close()
 }
+
+// last lines of gst-launch-1.0 stderr, for diagnostics
+func (g *Gstreamer) Stderr() []string {
+	return g.ex.Stderr()
+}
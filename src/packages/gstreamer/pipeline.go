@@ -0,0 +1,250 @@
+package gstreamer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"device-go/src/libs/webrtc"
+)
+
+// pipeline templates of a profile, video codec or `opus` to gst-launch-1.0 pipeline description
+//
+// placeholders are replaced when starting:
+// {device}, {width}, {height}, {bitrate} in kbit/s, {bitrate_bps} in bit/s, {gop}, {fps}, {host}, {port}
+//
+// {device} of `opus` is the alsa device, {width}, {height}, {gop} and {fps} are 0
+//
+// {fps} is optional, a profile without it encodes at the capture rate
+type GstreamerProfile map[string]string
+
+const (
+	GstreamerProfileRockchipMpp = "rockchip-mpp"
+	GstreamerProfileX264        = "x264"
+	GstreamerProfileRpi         = "rpi"
+)
+
+const gstreamerRtpH264 = "rtph264pay config-interval=-1 aggregate-mode=zero-latency"
+const gstreamerRtpH265 = "rtph265pay config-interval=-1 aggregate-mode=zero-latency"
+const gstreamerUdpSink = "udpsink host={host} port={port}"
+
+// hdmi audio, it is used if a profile has no `opus` template
+const gstreamerOpus = "alsasrc device={device} do-timestamp=true ! audioconvert ! audioresample ! audio/x-raw,rate=48000,channels=2 ! " +
+	"opusenc bitrate={bitrate_bps} frame-size=20 ! rtpopuspay ! " + gstreamerUdpSink
+
+// nv12 frames of frame processors, at the rate of quality
+const gstreamerRawSource = "fdsrc fd=0 do-timestamp=true ! rawvideoparse format=nv12 width={width} height={height} framerate={fps}/1"
+
+var gstreamerProfiles = map[string]GstreamerProfile{
+	// here we use `mmap` mode
+	// `drm` mode will get `core dump`, i do not know why
+	GstreamerProfileRockchipMpp: {
+		webrtc.VideoCodecH264: "v4l2src device={device} io-mode=mmap ! video/x-raw,format=NV12,width={width},height={height} ! " +
+			"mpph264enc gop={gop} bps={bitrate_bps} ! " + gstreamerRtpH264 + " ! " + gstreamerUdpSink,
+		webrtc.VideoCodecH265: "v4l2src device={device} io-mode=mmap ! video/x-raw,format=NV12,width={width},height={height} ! " +
+			"mpph265enc gop={gop} bps={bitrate_bps} ! " + gstreamerRtpH265 + " ! " + gstreamerUdpSink,
+		webrtc.VideoCodecVP8: "v4l2src device={device} io-mode=mmap ! video/x-raw,format=NV12,width={width},height={height} ! " +
+			"mppvp8enc gop={gop} bps={bitrate_bps} ! rtpvp8pay ! " + gstreamerUdpSink,
+		// there is no vp9 hardware encoder on rockchip
+		webrtc.VideoCodecVP9: "v4l2src device={device} io-mode=mmap ! video/x-raw,format=NV12,width={width},height={height} ! " +
+			"videoconvert ! vp9enc deadline=1 keyframe-max-dist={gop} target-bitrate={bitrate_bps} ! rtpvp9pay ! " + gstreamerUdpSink,
+	},
+	// software encoders, works everywhere but costs cpu
+	GstreamerProfileX264: {
+		webrtc.VideoCodecH264: "v4l2src device={device} ! videoconvert ! videoscale ! video/x-raw,format=I420,width={width},height={height} ! " +
+			"x264enc tune=zerolatency speed-preset=ultrafast bitrate={bitrate} key-int-max={gop} ! video/x-h264,profile=constrained-baseline ! " +
+			gstreamerRtpH264 + " ! " + gstreamerUdpSink,
+		webrtc.VideoCodecVP8: "v4l2src device={device} ! videoconvert ! videoscale ! video/x-raw,format=I420,width={width},height={height} ! " +
+			"vp8enc deadline=1 keyframe-max-dist={gop} target-bitrate={bitrate_bps} ! rtpvp8pay ! " + gstreamerUdpSink,
+		webrtc.VideoCodecVP9: "v4l2src device={device} ! videoconvert ! videoscale ! video/x-raw,format=I420,width={width},height={height} ! " +
+			"vp9enc deadline=1 keyframe-max-dist={gop} target-bitrate={bitrate_bps} ! rtpvp9pay ! " + gstreamerUdpSink,
+		webrtc.AudioCodecOpus: gstreamerOpus,
+	},
+	// raspberry pi hardware encoder
+	GstreamerProfileRpi: {
+		webrtc.VideoCodecH264: "v4l2src device={device} ! videoconvert ! video/x-raw,format=I420,width={width},height={height} ! " +
+			"v4l2h264enc extra-controls=\"controls,video_bitrate={bitrate_bps},h264_i_frame_period={gop}\" ! video/x-h264,level=(string)4 ! " +
+			gstreamerRtpH264 + " ! " + gstreamerUdpSink,
+		webrtc.AudioCodecOpus: gstreamerOpus,
+	},
+}
+
+var gstreamerPlaceholders = []string{"device", "width", "height", "bitrate", "bitrate_bps", "gop", "fps", "host", "port"}
+
+var gstreamerPlaceholderRegexp = regexp.MustCompile(`\{([^{}]*)\}`)
+
+func validTemplate(template string) error {
+	if strings.TrimSpace(template) == "" {
+		return fmt.Errorf("empty template")
+	}
+
+	for _, m := range gstreamerPlaceholderRegexp.FindAllStringSubmatch(template, -1) {
+		found := false
+		for _, p := range gstreamerPlaceholders {
+			if m[1] == p {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown placeholder %s", m[0])
+		}
+	}
+
+	// rtp is received on host and port
+	if !strings.Contains(template, "{port}") {
+		return fmt.Errorf("placeholder {port} is required")
+	}
+
+	return nil
+}
+
+func (p GstreamerProfile) Valid() error {
+	if len(p) == 0 {
+		return fmt.Errorf("gstreamer profile empty")
+	}
+
+	for codec, template := range p {
+		if codec != webrtc.AudioCodecOpus {
+			_, err := webrtc.ParseVideoCodecs(codec)
+			if err != nil {
+				return fmt.Errorf("gstreamer profile codec %s invalid, %v", codec, err)
+			}
+		}
+
+		err := validTemplate(template)
+		if err != nil {
+			return fmt.Errorf("gstreamer profile codec %s template invalid, %v", codec, err)
+		}
+	}
+
+	return nil
+}
+
+// every video template has {fps}, so the frame rate could be changed
+func (p GstreamerProfile) SupportsFps() bool {
+	found := false
+	for codec, template := range p {
+		if codec == webrtc.AudioCodecOpus {
+			continue
+		} else if !strings.Contains(template, "{fps}") {
+			return false
+		}
+		found = true
+	}
+
+	return found
+}
+
+// use profile by name, custom profiles override builtin ones
+func UseProfile(name string, custom map[string]GstreamerProfile) (GstreamerProfile, error) {
+	if name == "" {
+		name = GstreamerProfileRockchipMpp
+	}
+
+	p, ok := custom[name]
+	if !ok {
+		p, ok = gstreamerProfiles[name]
+	}
+	if !ok {
+		return nil, fmt.Errorf("gstreamer profile %s not found", name)
+	}
+
+	err := p.Valid()
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p GstreamerProfile) useTemplate(codec string) (string, error) {
+	template, ok := p[codec]
+	if !ok && codec == webrtc.AudioCodecOpus {
+		template, ok = gstreamerOpus, true
+	}
+	if !ok {
+		return "", fmt.Errorf("gstreamer profile unsupported codec %s", codec)
+	}
+
+	return template, nil
+}
+
+// gst-launch-1.0 args of template, gst-launch-1.0 joins args with space, so splitting by space is fine
+func useTemplateArgs(
+	template string,
+	path string,
+	ip string,
+	port int,
+	width uint,
+	height uint,
+	bitRate uint,
+	gop uint,
+	fps uint,
+) []string {
+	r := strings.NewReplacer(
+		"{device}", path,
+		"{width}", strconv.FormatUint(uint64(width), 10),
+		"{height}", strconv.FormatUint(uint64(height), 10),
+		"{bitrate}", strconv.FormatUint(uint64(bitRate), 10),
+		"{bitrate_bps}", strconv.FormatUint(uint64(bitRate)*1000, 10),
+		"{gop}", strconv.FormatUint(uint64(gop), 10),
+		"{fps}", strconv.FormatUint(uint64(fps), 10),
+		"{host}", ip,
+		"{port}", strconv.Itoa(port),
+	)
+
+	args := []string{"-q"}
+	for _, f := range strings.Fields(template) {
+		args = append(args, r.Replace(f))
+	}
+
+	return args
+}
+
+// gst-launch-1.0 args of codec
+func (p GstreamerProfile) useArgs(
+	codec string,
+	path string,
+	ip string,
+	port int,
+	width uint,
+	height uint,
+	bitRate uint,
+	gop uint,
+	fps uint,
+) ([]string, error) {
+	template, err := p.useTemplate(codec)
+	if err != nil {
+		return nil, err
+	}
+
+	return useTemplateArgs(template, path, ip, port, width, height, bitRate, gop, fps), nil
+}
+
+// gst-launch-1.0 args of codec, nv12 frames are read from stdin
+//
+// the first element of template is the capture, it is replaced by the raw source
+func (p GstreamerProfile) useRawArgs(
+	codec string,
+	ip string,
+	port int,
+	width uint,
+	height uint,
+	bitRate uint,
+	gop uint,
+	fps uint,
+) ([]string, error) {
+	template, err := p.useTemplate(codec)
+	if err != nil {
+		return nil, err
+	}
+
+	_, rest, ok := strings.Cut(template, " ! ")
+	if !ok {
+		return nil, fmt.Errorf("gstreamer profile codec %s template has no capture element", codec)
+	}
+
+	return useTemplateArgs(gstreamerRawSource+" ! "+rest, "", ip, port, width, height, bitRate, gop, fps), nil
+}
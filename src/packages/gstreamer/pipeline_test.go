@@ -0,0 +1,127 @@
+package gstreamer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	t.Run("should have valid builtin profiles", func(t *testing.T) {
+		for name := range gstreamerProfiles {
+			_, err := UseProfile(name, nil)
+			if err != nil {
+				t.Errorf("profile %s error %v", name, err)
+			}
+		}
+	})
+
+	t.Run("should use custom profile first", func(t *testing.T) {
+		custom := map[string]GstreamerProfile{
+			GstreamerProfileX264: {"h264": "videotestsrc ! x264enc ! rtph264pay ! udpsink host={host} port={port}"},
+		}
+
+		p, err := UseProfile(GstreamerProfileX264, custom)
+		if err != nil {
+			t.Fatalf("use profile error %v", err)
+		}
+		if !strings.HasPrefix(p["h264"], "videotestsrc") {
+			t.Errorf("profile not custom %v", p)
+		}
+	})
+
+	t.Run("should be error, because profile not found", func(t *testing.T) {
+		_, err := UseProfile("unknown", nil)
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+
+	t.Run("should be error, because template invalid", func(t *testing.T) {
+		profiles := []GstreamerProfile{
+			{},
+			{"h263": "videotestsrc ! udpsink port={port}"},
+			{"h264": " "},
+			{"h264": "videotestsrc ! udpsink port={prot}"},
+			{"h264": "videotestsrc ! udpsink port=5004"},
+		}
+
+		for i, p := range profiles {
+			_, err := UseProfile("custom", map[string]GstreamerProfile{"custom": p})
+			if err == nil {
+				t.Errorf("profile %d should be error", i)
+			}
+		}
+	})
+
+	t.Run("should replace placeholders", func(t *testing.T) {
+		p := GstreamerProfile{
+			"h264": "v4l2src device={device} ! video/x-raw,width={width},height={height} ! videorate ! video/x-raw,framerate={fps}/1 ! enc bitrate={bitrate} bps={bitrate_bps} gop={gop} ! udpsink host={host} port={port}",
+		}
+
+		args, err := p.useArgs("h264", "/dev/video1", "127.0.0.1", 5004, 1280, 720, 2000, 30, 15)
+		if err != nil {
+			t.Fatalf("use args error %v", err)
+		}
+
+		expected := "-q v4l2src device=/dev/video1 ! video/x-raw,width=1280,height=720 ! videorate ! video/x-raw,framerate=15/1 ! enc bitrate=2000 bps=2000000 gop=30 ! udpsink host=127.0.0.1 port=5004"
+		if strings.Join(args, " ") != expected {
+			t.Errorf("args not match %v", args)
+		}
+
+		_, err = p.useArgs("vp8", "/dev/video1", "127.0.0.1", 5004, 1280, 720, 2000, 30, 15)
+		if err == nil {
+			t.Errorf("should be error, because codec unsupported")
+		}
+
+		if !p.SupportsFps() {
+			t.Errorf("profile should support fps")
+		}
+		if gstreamerProfiles[GstreamerProfileX264].SupportsFps() {
+			t.Errorf("builtin profile should not support fps")
+		}
+	})
+
+	t.Run("should fallback to builtin opus pipeline", func(t *testing.T) {
+		p := GstreamerProfile{
+			"h264": "videotestsrc ! x264enc ! rtph264pay ! udpsink host={host} port={port}",
+		}
+
+		args, err := p.useArgs("opus", "hw:0,0", "127.0.0.1", 10002, 0, 0, 64, 0, 0)
+		if err != nil {
+			t.Fatalf("use args error %v", err)
+		}
+
+		a := strings.Join(args, " ")
+		if !strings.Contains(a, "alsasrc device=hw:0,0") || !strings.Contains(a, "opusenc bitrate=64000") || !strings.Contains(a, "port=10002") {
+			t.Errorf("args not match %v", args)
+		}
+
+		_, err = UseProfile("custom", map[string]GstreamerProfile{"custom": {"opus": "audiotestsrc ! opusenc ! rtpopuspay ! udpsink port={port}"}})
+		if err != nil {
+			t.Errorf("opus template should be valid %v", err)
+		}
+	})
+
+	t.Run("should replace capture with raw source", func(t *testing.T) {
+		p := GstreamerProfile{
+			"h264": "v4l2src device={device} io-mode=mmap ! video/x-raw,format=NV12,width={width},height={height} ! enc ! udpsink host={host} port={port}",
+			"vp8":  "v4l2src device={device}",
+		}
+
+		args, err := p.useRawArgs("h264", "127.0.0.1", 5004, 1280, 720, 2000, 30, 15)
+		if err != nil {
+			t.Fatalf("use raw args error %v", err)
+		}
+
+		expected := "-q fdsrc fd=0 do-timestamp=true ! rawvideoparse format=nv12 width=1280 height=720 framerate=15/1 ! " +
+			"video/x-raw,format=NV12,width=1280,height=720 ! enc ! udpsink host=127.0.0.1 port=5004"
+		if strings.Join(args, " ") != expected {
+			t.Errorf("args not match %v", args)
+		}
+
+		_, err = p.useRawArgs("vp8", "127.0.0.1", 5004, 1280, 720, 2000, 30, 30)
+		if err == nil {
+			t.Errorf("should be error, because template has no capture element")
+		}
+	})
+}
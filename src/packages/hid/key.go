@@ -67,6 +67,7 @@ var keyboardUsageTable = map[string]byte{
 	",": 0x36, "<": 0x36,
 	".": 0x37, ">": 0x37,
 	"/": 0x38, "?": 0x38,
+	"`": 0x35, "~": 0x35,
 
 	// CapsLock
 	"CapsLock": 0x39,
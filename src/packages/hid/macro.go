@@ -0,0 +1,81 @@
+package hid
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// limits of a macro
+const (
+	HidMacroMaxSteps    = 1000
+	HidMacroMaxDuration = time.Minute
+)
+
+// step of a macro, a keyboard or mouse report, or text to type, then it waits delay in milliseconds,
+// typing and delays count toward the max duration
+//
+// keyboard reports are raw, a key is pressed until a report without it
+type HidMacroStep struct {
+	Keyboard *HidKeyboardData `json:"keyboard,omitempty"`
+	Mouse    *HidMouseData    `json:"mouse,omitempty"`
+	Text     string           `json:"text,omitempty"`
+	Delay    uint             `json:"delay,omitempty"`
+}
+
+func validMacro(steps []HidMacroStep) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("hid macro empty")
+	} else if len(steps) > HidMacroMaxSteps {
+		return fmt.Errorf("hid macro steps %d over %d", len(steps), HidMacroMaxSteps)
+	}
+
+	var d time.Duration
+	for i, s := range steps {
+		d += time.Duration(s.Delay)*time.Millisecond + typeDuration(s.Text)
+
+		if s.Mouse != nil && (s.Mouse.X < HidMousePositionMin || s.Mouse.X >= HidMousePositionMax || s.Mouse.Y < HidMousePositionMin || s.Mouse.Y >= HidMousePositionMax) {
+			return fmt.Errorf("hid macro step %d mouse position out of range", i)
+		}
+	}
+	if d > HidMacroMaxDuration {
+		return fmt.Errorf("hid macro duration %v over %v", d, HidMacroMaxDuration)
+	}
+
+	return nil
+}
+
+// run steps in order, keys are released at end, or when it is cancelled
+func (h *HidController) RunMacro(ctx context.Context, steps []HidMacroStep) error {
+	err := validMacro(steps)
+	if err != nil {
+		return err
+	}
+
+	defer h.writeKeyboard(false, false, false, "", "", "", "", "", "")
+
+	for _, s := range steps {
+		if k := s.Keyboard; k != nil {
+			err = h.writeKeyboard(k.Ctrl, k.Shift, k.Alt, k.Key1, k.Key2, k.Key3, k.Key4, k.Key5, k.Key6)
+		} else if m := s.Mouse; m != nil {
+			err = h.writeMouse(m.Button1, m.Button2, m.Button3, uint16(m.X), uint16(m.Y))
+		} else if s.Text != "" {
+			_, err = h.typeText(ctx, s.Text)
+		}
+		if err != nil {
+			return err
+		}
+
+		if s.Delay == 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(s.Delay) * time.Millisecond):
+		}
+	}
+
+	return nil
+}
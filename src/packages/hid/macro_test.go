@@ -0,0 +1,70 @@
+package hid
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMacro(t *testing.T) {
+	t.Run("should be valid", func(t *testing.T) {
+		err := validMacro([]HidMacroStep{
+			{Keyboard: &HidKeyboardData{Ctrl: true, Key1: "c"}, Delay: 50},
+			{Keyboard: &HidKeyboardData{}},
+			{Mouse: &HidMouseData{X: 100, Y: 100, Button1: true}},
+			{Text: "hello\n"},
+		})
+		if err != nil {
+			t.Errorf("valid error %v", err)
+		}
+	})
+
+	t.Run("should be invalid, because delay is too long", func(t *testing.T) {
+		err := validMacro([]HidMacroStep{
+			{Text: "a", Delay: uint(HidMacroMaxDuration / time.Millisecond)},
+			{Text: "b", Delay: 1},
+		})
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+
+	t.Run("should be invalid, because typing is too long", func(t *testing.T) {
+		n := int(HidMacroMaxDuration/(2*hidTypeInterval)) + 1
+		err := validMacro([]HidMacroStep{
+			{Text: strings.Repeat("a", n)},
+		})
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+
+	t.Run("should stop typing, because it is cancelled", func(t *testing.T) {
+		h, path := useTestHid(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := h.RunMacro(ctx, []HidMacroStep{{Text: "hello"}})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("error not match %v", err)
+		}
+
+		// only the release at end
+		b, _ := os.ReadFile(path)
+		if len(b) != 8 {
+			t.Errorf("reports not match %v", b)
+		}
+	})
+
+	t.Run("should be invalid, because mouse is out of range", func(t *testing.T) {
+		err := validMacro([]HidMacroStep{
+			{Mouse: &HidMouseData{X: HidMousePositionMax}},
+		})
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package hid
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// interval between reports of typing, targets drop keys of faster reports
+const hidTypeInterval = 8 * time.Millisecond
+
+// characters with shift on us layout
+const typeShifted = "ABCDEFGHIJKLMNOPQRSTUVWXYZ~!@#$%^&*()_+{}|:\"<>?"
+
+// key of a character on us layout, newline is enter
+func findTypeKey(r rune) (byte, bool, bool) {
+	switch r {
+	case '\n':
+		return keyboardUsageTable["Enter"], false, true
+	case '\t':
+		return keyboardUsageTable["Tab"], false, true
+	}
+
+	if r > 0x7F {
+		return 0, false, false
+	}
+
+	code, ok := keyboardUsageTable[string(r)]
+	if !ok {
+		return 0, false, false
+	}
+
+	return code, strings.ContainsRune(typeShifted, r), true
+}
+
+// longest duration of typing text, a character is a press and a release
+func typeDuration(text string) time.Duration {
+	return time.Duration(utf8.RuneCountInString(strings.ReplaceAll(text, "\r", ""))) * 2 * hidTypeInterval
+}
+
+// type text by key presses on us layout, characters out of the layout are skipped,
+// carriage returns are dropped, count of typed characters is returned
+func (h *HidController) Type(text string) (int, error) {
+	return h.typeText(context.Background(), text)
+}
+
+// type text until it is cancelled, a cancelled character is not pressed
+func (h *HidController) typeText(ctx context.Context, text string) (int, error) {
+	typed := 0
+
+	for _, r := range strings.ReplaceAll(text, "\r", "") {
+		code, shift, ok := findTypeKey(r)
+		if !ok {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return typed, err
+		}
+
+		data := make([]byte, 7)
+		if shift {
+			data[0] = 1 << 1
+		}
+		data[1] = code
+
+		err := h.write(HidKeyboardReportId, data)
+		if err != nil {
+			return typed, err
+		}
+		time.Sleep(hidTypeInterval)
+
+		// release, a repeated character is pressed again
+		err = h.write(HidKeyboardReportId, make([]byte, 7))
+		if err != nil {
+			return typed, err
+		}
+		time.Sleep(hidTypeInterval)
+
+		typed++
+	}
+
+	return typed, nil
+}
@@ -0,0 +1,67 @@
+package hid
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// controller of a regular file, reports are appended to it
+func useTestHid(t *testing.T) (*HidController, string) {
+	path := filepath.Join(t.TempDir(), "hidg0")
+	err := os.WriteFile(path, nil, 0644)
+	if err != nil {
+		t.Fatalf("write error %v", err)
+	}
+
+	h := NewHidController(path, "")
+	err = h.Open()
+	if err != nil {
+		t.Fatalf("open error %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+
+	return &h, path
+}
+
+func TestType(t *testing.T) {
+	t.Run("should find keys of us layout", func(t *testing.T) {
+		cases := []struct {
+			r     rune
+			code  byte
+			shift bool
+		}{
+			{'a', 0x04, false},
+			{'A', 0x04, true},
+			{'1', 0x1E, false},
+			{'!', 0x1E, true},
+			{'~', 0x35, true},
+			{'\n', 0x28, false},
+		}
+
+		for _, c := range cases {
+			code, shift, ok := findTypeKey(c.r)
+			if !ok || code != c.code || shift != c.shift {
+				t.Errorf("key of %q not match %x %v %v", c.r, code, shift, ok)
+			}
+		}
+	})
+
+	t.Run("should skip characters out of layout", func(t *testing.T) {
+		h, path := useTestHid(t)
+
+		typed, err := h.Type("Hé\r\n")
+		if err != nil {
+			t.Fatalf("type error %v", err)
+		}
+		if typed != 2 {
+			t.Errorf("typed not match %d 2", typed)
+		}
+
+		// press and release reports of H and enter
+		b, _ := os.ReadFile(path)
+		if len(b) != 4*8 || b[0] != HidKeyboardReportId || b[1] != 1<<1 || b[2] != 0x0B || b[2*8+2] != 0x28 {
+			t.Errorf("reports not match %v", b)
+		}
+	})
+}
@@ -170,6 +170,11 @@ func (c *Mqtt) Send(data any) error {
 	return c.publishResponse(data)
 }
 
+// publish event, eg. screen change
+func (c *Mqtt) SendEvent(data any) error {
+	return c.publish("event", data)
+}
+
 func (c *Mqtt) IsConnected() bool {
 	return c.client.IsConnected()
 }
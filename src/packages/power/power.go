@@ -0,0 +1,58 @@
+package power
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// actions of the target power
+const (
+	PowerActionOn    = "on"
+	PowerActionOff   = "off"
+	PowerActionReset = "reset"
+	PowerActionCycle = "cycle"
+)
+
+var powerActions = []string{PowerActionOn, PowerActionOff, PowerActionReset, PowerActionCycle}
+
+// a cycle holds the button for seconds
+const powerTimeout = 30 * time.Second
+
+// power control of the target by a helper, eg. atx buttons by gpio or a smart plug,
+// it runs `<bin> <action>` and exit code 0 is success
+type Power struct {
+	binPath string
+}
+
+func NewPower(binPath string) Power {
+	return Power{binPath: binPath}
+}
+
+func ValidAction(action string) bool {
+	return slices.Contains(powerActions, action)
+}
+
+func (p *Power) Action(ctx context.Context, action string) error {
+	if !ValidAction(action) {
+		return fmt.Errorf("power unknown action %s", action)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, powerTimeout)
+	defer cancel()
+
+	stderr := bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, p.binPath, action)
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("power action %s error %v %s", action, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
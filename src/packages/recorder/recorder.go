@@ -0,0 +1,432 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"device-go/src/libs/h264"
+	"device-go/src/libs/mp4"
+)
+
+const recorderFilePrefix = "record-"
+const recorderFileSuffix = ".mp4"
+
+// files of the same second, suffixes are single digits to keep the order
+const recorderMaxCollisions = 10
+
+// access unit queue size, about 2 seconds of 60 fps
+const recorderQueueSize = 120
+
+// used when duration can not be computed, 30 fps
+const recorderDefaultDuration = mp4.Timescale / 30
+
+// fragments are cut at key frames, or at this duration
+const recorderMaxFragmentDuration = 2 * mp4.Timescale
+
+type recorderAccessUnit struct {
+	// presentation timestamp in mp4 timescale
+	pts  uint64
+	data []byte
+}
+
+type recorderSample struct {
+	pts    uint64
+	sample mp4.Sample
+}
+
+// record h264 stream to fragmented mp4 files, without re-encoding
+type Recorder struct {
+	dir             string
+	width           uint
+	height          uint
+	maxFileSize     int64
+	maxFileDuration time.Duration
+	retention       time.Duration
+	maxTotalSize    int64
+
+	wg sync.WaitGroup
+
+	// producer side, open and close, see `WriteAccessUnit`
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	queue   chan recorderAccessUnit
+	waitKey bool
+
+	// worker side
+	file     *os.File
+	writer   mp4.Writer
+	fileTime time.Time
+	fileSize int64
+	// decode time of the next fragment, sum of sample durations, timestamps may go backwards
+	fileDts  uint64
+	sps      []byte
+	pps      []byte
+	pending  *recorderSample
+	fragment []recorderSample
+}
+
+func NewRecorder(
+	dir string,
+	width uint,
+	height uint,
+	maxFileSize int64,
+	maxFileDuration time.Duration,
+	retention time.Duration,
+	maxTotalSize int64,
+) Recorder {
+	return Recorder{
+		dir:             dir,
+		width:           width,
+		height:          height,
+		maxFileSize:     maxFileSize,
+		maxFileDuration: maxFileDuration,
+		retention:       retention,
+		maxTotalSize:    maxTotalSize,
+	}
+}
+
+// create a new file named by time, a file of the same second is kept, the name has a suffix then,
+// `_` sorts after `.`, so names are still in time order
+func createFile(dir string, t time.Time) (*os.File, string, error) {
+	name := recorderFilePrefix + t.Format("20060102-150405")
+
+	for i := 0; i < recorderMaxCollisions; i++ {
+		p := filepath.Join(dir, name+recorderFileSuffix)
+		if i > 0 {
+			p = filepath.Join(dir, fmt.Sprintf("%s_%d%s", name, i, recorderFileSuffix))
+		}
+
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+		if err == nil {
+			return f, p, nil
+		} else if !os.IsExist(err) {
+			return nil, "", err
+		}
+	}
+
+	return nil, "", fmt.Errorf("recorder file exists %s", name)
+}
+
+func (r *Recorder) openFile() error {
+	err := os.MkdirAll(r.dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	n := time.Now()
+	f, p, err := createFile(r.dir, n)
+	if err != nil {
+		return err
+	}
+
+	// use size in sps, fallback to configured
+	width := r.width
+	height := r.height
+	sps, err := h264.ParseSPS(r.sps)
+	if err == nil {
+		width = sps.Width
+		height = sps.Height
+	}
+
+	w := mp4.NewWriter(f)
+	err = w.WriteInit(mp4.Track{
+		Width:  width,
+		Height: height,
+		SPS:    r.sps,
+		PPS:    r.pps,
+	})
+	if err != nil {
+		f.Close()
+		os.Remove(p)
+		return err
+	}
+
+	log.Println("recorder open file", p)
+
+	r.file = f
+	r.writer = w
+	r.fileTime = n
+	r.fileSize = 0
+	r.fileDts = 0
+
+	return nil
+}
+
+func (r *Recorder) closeFile() {
+	if r.file == nil {
+		return
+	}
+
+	err := r.file.Close()
+	if err != nil {
+		log.Println("recorder close file error", err)
+	}
+	r.file = nil
+
+	r.clean()
+}
+
+// remove files by retention and max total size
+func (r *Recorder) clean() {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		log.Println("recorder read dir error", err)
+		return
+	}
+
+	type recordFile struct {
+		path string
+		size int64
+		time time.Time
+	}
+
+	files := []recordFile{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, recorderFilePrefix) || !strings.HasSuffix(name, recorderFileSuffix) {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		files = append(files, recordFile{
+			path: filepath.Join(r.dir, name),
+			size: info.Size(),
+			time: info.ModTime(),
+		})
+	}
+
+	// name has time, so oldest first
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].path < files[j].path
+	})
+
+	total := int64(0)
+	for _, f := range files {
+		total += f.size
+	}
+
+	for _, f := range files {
+		expired := r.retention > 0 && time.Since(f.time) > r.retention
+		oversize := r.maxTotalSize > 0 && total > r.maxTotalSize
+		if !expired && !oversize {
+			continue
+		}
+
+		err := os.Remove(f.path)
+		if err != nil {
+			log.Println("recorder remove file error", f.path, err)
+			continue
+		}
+
+		log.Println("recorder remove file", f.path)
+		total -= f.size
+	}
+}
+
+func (r *Recorder) shouldRotate() bool {
+	if r.maxFileSize > 0 && r.fileSize >= r.maxFileSize {
+		return true
+	} else if r.maxFileDuration > 0 && time.Since(r.fileTime) >= r.maxFileDuration {
+		return true
+	}
+
+	return false
+}
+
+func (r *Recorder) flushFragment() {
+	if len(r.fragment) == 0 {
+		return
+	}
+
+	fragment := r.fragment
+	r.fragment = nil
+
+	if r.file == nil {
+		return
+	}
+
+	samples := make([]mp4.Sample, len(fragment))
+	duration := uint64(0)
+	for i, s := range fragment {
+		samples[i] = s.sample
+		duration += uint64(s.sample.Duration)
+	}
+
+	n, err := r.writer.WriteFragment(r.fileDts, samples)
+	r.fileSize += int64(n)
+	r.fileDts += duration
+	if err != nil {
+		log.Println("recorder write fragment error", err)
+		r.closeFile()
+	}
+}
+
+func (r *Recorder) fragmentDuration() uint64 {
+	d := uint64(0)
+	for _, s := range r.fragment {
+		d += uint64(s.sample.Duration)
+	}
+
+	return d
+}
+
+func (r *Recorder) write(au recorderAccessUnit) {
+	nalus := h264.Split(au.data)
+
+	key := false
+	for _, nalu := range nalus {
+		switch h264.NALUnitType(nalu) {
+		case h264.NALUnitTypeSPS:
+			r.sps = nalu
+		case h264.NALUnitTypePPS:
+			r.pps = nalu
+		case h264.NALUnitTypeIDR:
+			key = true
+		}
+	}
+
+	// pending sample ends at this access unit
+	if r.pending != nil {
+		d := recorderDefaultDuration
+		if au.pts > r.pending.pts && au.pts-r.pending.pts < mp4.Timescale {
+			d = int(au.pts - r.pending.pts)
+		}
+		r.pending.sample.Duration = uint32(d)
+		r.fragment = append(r.fragment, *r.pending)
+		r.pending = nil
+	}
+
+	// cut fragment
+	if len(r.fragment) > 0 && (key || r.fragmentDuration() >= recorderMaxFragmentDuration) {
+		r.flushFragment()
+	}
+
+	// rotate at key frame
+	if key && r.file != nil && r.shouldRotate() {
+		r.closeFile()
+	}
+
+	// file starts with key frame
+	if r.file == nil {
+		if !key || r.sps == nil || r.pps == nil {
+			return
+		}
+
+		err := r.openFile()
+		if err != nil {
+			log.Println("recorder open file error", err)
+			return
+		}
+	}
+
+	r.pending = &recorderSample{
+		pts: au.pts,
+		sample: mp4.Sample{
+			Data: mp4.AVCC(au.data),
+			Key:  key,
+		},
+	}
+}
+
+// flush all, and close the file
+func (r *Recorder) flush() {
+	if r.pending != nil {
+		r.pending.sample.Duration = recorderDefaultDuration
+		r.fragment = append(r.fragment, *r.pending)
+		r.pending = nil
+	}
+	r.flushFragment()
+	r.closeFile()
+}
+
+func (r *Recorder) handle(ctx context.Context) {
+	defer func() {
+		r.flush()
+		r.wg.Done()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case au := <-r.queue:
+			r.write(au)
+		}
+	}
+}
+
+func (r *Recorder) push(au recorderAccessUnit) {
+	// after drop, wait next key frame
+	if r.waitKey {
+		if !h264.IsKeyFrame(au.data) {
+			return
+		}
+		r.waitKey = false
+	}
+
+	select {
+	case r.queue <- au:
+	default:
+		log.Println("recorder queue full, drop access unit")
+		r.waitKey = true
+	}
+}
+
+func (r *Recorder) Open() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		return fmt.Errorf("recorder exists")
+	}
+
+	r.queue = make(chan recorderAccessUnit, recorderQueueSize)
+	r.waitKey = false
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	r.wg.Add(1)
+	go r.handle(ctx)
+
+	return nil
+}
+
+// the worker is drained under the lock, so open waits for it
+func (r *Recorder) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+
+	r.wg.Wait()
+}
+
+// write annex b access unit, timestamp is in microseconds
+func (r *Recorder) WriteAccessUnit(timestamp uint64, au []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel == nil {
+		return
+	}
+
+	r.push(recorderAccessUnit{
+		pts:  timestamp * 9 / 100,
+		data: au,
+	})
+}
@@ -0,0 +1,303 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCreateFile(t *testing.T) {
+	t.Run("should keep file of the same second, because the name has a suffix", func(t *testing.T) {
+		dir := t.TempDir()
+		n := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		f, first, err := createFile(dir, n)
+		if err != nil {
+			t.Fatalf("create error %v", err)
+		}
+		f.WriteString("first")
+		f.Close()
+
+		f, second, err := createFile(dir, n)
+		if err != nil {
+			t.Fatalf("create error %v", err)
+		}
+		f.Close()
+
+		if first == second {
+			t.Fatalf("paths should differ %s", first)
+		}
+		if b, _ := os.ReadFile(first); string(b) != "first" {
+			t.Errorf("first file truncated %q", b)
+		}
+
+		// names are in time order
+		names := []string{filepath.Base(second), filepath.Base(first)}
+		sort.Strings(names)
+		if names[0] != filepath.Base(first) {
+			t.Errorf("order not match %v", names)
+		}
+	})
+
+	t.Run("should fail, because all suffixes exist", func(t *testing.T) {
+		dir := t.TempDir()
+		n := time.Now()
+
+		for i := 0; i < recorderMaxCollisions; i++ {
+			f, _, err := createFile(dir, n)
+			if err != nil {
+				t.Fatalf("create error %v", err)
+			}
+			f.Close()
+		}
+
+		_, _, err := createFile(dir, n)
+		if err == nil {
+			t.Errorf("should be error")
+		}
+	})
+}
+
+// annex b access unit, key frame has sps and pps
+func useTestAccessUnit(key bool) []byte {
+	start := []byte{0, 0, 0, 1}
+	if !key {
+		return append(append([]byte{}, start...), 0x41, 0x9a, 0x01)
+	}
+
+	b := []byte{}
+	b = append(append(b, start...), 0x67, 0x64, 0x00, 0x28, 0xac)
+	b = append(append(b, start...), 0x68, 0xee, 0x3c, 0x80)
+	b = append(append(b, start...), 0x65, 0x88, 0x84)
+	return b
+}
+
+type testFragment struct {
+	decodeTime uint64
+	samples    int
+	duration   uint64
+}
+
+// read fragments of a record file, decode time of tfdt and sample durations of trun
+func useTestFragments(t *testing.T, path string) []testFragment {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read error %v", err)
+	}
+
+	fragments := []testFragment{}
+	for offset := 0; offset+8 <= len(b); {
+		size := int(binary.BigEndian.Uint32(b[offset : offset+4]))
+		if size < 8 || offset+size > len(b) {
+			t.Fatalf("box size invalid %d at %d", size, offset)
+		}
+
+		if string(b[offset+4:offset+8]) == "moof" {
+			moof := b[offset : offset+size]
+			tfdt := bytes.Index(moof, []byte("tfdt"))
+			trun := bytes.Index(moof, []byte("trun"))
+			if tfdt < 0 || trun < 0 {
+				t.Fatalf("moof without tfdt or trun")
+			}
+
+			f := testFragment{decodeTime: binary.BigEndian.Uint64(moof[tfdt+8 : tfdt+16])}
+			f.samples = int(binary.BigEndian.Uint32(moof[trun+8 : trun+12]))
+			for i := 0; i < f.samples; i++ {
+				entry := trun + 16 + i*12
+				f.duration += uint64(binary.BigEndian.Uint32(moof[entry : entry+4]))
+			}
+			fragments = append(fragments, f)
+		}
+
+		offset += size
+	}
+
+	return fragments
+}
+
+func useTestFiles(t *testing.T, dir string) []string {
+	paths, err := filepath.Glob(filepath.Join(dir, recorderFilePrefix+"*"+recorderFileSuffix))
+	if err != nil {
+		t.Fatalf("glob error %v", err)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// decode times are continuous, each fragment starts at the end of the previous
+func testContinuous(t *testing.T, fragments []testFragment) {
+	dts := uint64(0)
+	for i, f := range fragments {
+		if f.decodeTime != dts {
+			t.Errorf("fragment %d decode time %d, expected %d", i, f.decodeTime, dts)
+		}
+		dts += f.duration
+	}
+}
+
+func TestWriteAccessUnit(t *testing.T) {
+	// 30 fps in mp4 timescale
+	const frame = 3000
+
+	t.Run("should cut fragments at key frames and at max duration", func(t *testing.T) {
+		dir := t.TempDir()
+		r := NewRecorder(dir, 1920, 1080, 0, 0, 0, 0)
+
+		pts := uint64(0)
+		// 3s without key frame, then a key frame
+		for i := 0; i < 90; i++ {
+			r.write(recorderAccessUnit{pts: pts, data: useTestAccessUnit(i == 0)})
+			pts += frame
+		}
+		r.write(recorderAccessUnit{pts: pts, data: useTestAccessUnit(true)})
+		r.flush()
+
+		paths := useTestFiles(t, dir)
+		if len(paths) != 1 {
+			t.Fatalf("files not match %v", paths)
+		}
+
+		fragments := useTestFragments(t, paths[0])
+		if len(fragments) != 3 {
+			t.Fatalf("fragments not match %+v", fragments)
+		}
+		if fragments[0].duration != recorderMaxFragmentDuration {
+			t.Errorf("first fragment duration %d", fragments[0].duration)
+		}
+		if fragments[1].samples != 90-fragments[0].samples || fragments[2].samples != 1 {
+			t.Errorf("samples not match %+v", fragments)
+		}
+		testContinuous(t, fragments)
+	})
+
+	t.Run("should keep decode time continuous, because timestamps go backwards", func(t *testing.T) {
+		dir := t.TempDir()
+		r := NewRecorder(dir, 1920, 1080, 0, 0, 0, 0)
+
+		// restart of the source, a new rtp base
+		for _, base := range []uint64{1_000_000_000, 100} {
+			for i := 0; i < 10; i++ {
+				r.write(recorderAccessUnit{pts: base + uint64(i)*frame, data: useTestAccessUnit(i == 0)})
+			}
+		}
+		r.flush()
+
+		paths := useTestFiles(t, dir)
+		if len(paths) != 1 {
+			t.Fatalf("files not match %v", paths)
+		}
+
+		fragments := useTestFragments(t, paths[0])
+		if len(fragments) != 2 {
+			t.Fatalf("fragments not match %+v", fragments)
+		}
+		// last sample before the restart has default duration
+		if fragments[0].duration != 10*frame {
+			t.Errorf("first fragment duration %d", fragments[0].duration)
+		}
+		testContinuous(t, fragments)
+	})
+
+	t.Run("should rotate file at key frame, because the file is full", func(t *testing.T) {
+		dir := t.TempDir()
+		r := NewRecorder(dir, 1920, 1080, 1, 0, 0, 0)
+
+		for i := 0; i < 30; i++ {
+			r.write(recorderAccessUnit{pts: uint64(i) * frame, data: useTestAccessUnit(i%10 == 0)})
+		}
+		r.flush()
+
+		paths := useTestFiles(t, dir)
+		if len(paths) != 3 {
+			t.Fatalf("files not match %v", paths)
+		}
+		for _, p := range paths {
+			fragments := useTestFragments(t, p)
+			if len(fragments) != 1 || fragments[0].decodeTime != 0 || fragments[0].samples != 10 {
+				t.Errorf("fragments of %s not match %+v", p, fragments)
+			}
+		}
+	})
+
+	t.Run("should drop access units, because the recorder is closed", func(t *testing.T) {
+		dir := t.TempDir()
+		r := NewRecorder(dir, 1920, 1080, 0, 0, 0, 0)
+
+		r.WriteAccessUnit(0, useTestAccessUnit(true))
+
+		err := r.Open()
+		if err != nil {
+			t.Fatalf("open error %v", err)
+		}
+		r.Close()
+		r.WriteAccessUnit(0, useTestAccessUnit(true))
+
+		if paths := useTestFiles(t, dir); len(paths) > 1 {
+			t.Errorf("files not match %v", paths)
+		}
+	})
+}
+
+func TestClean(t *testing.T) {
+	useTestFile := func(t *testing.T, dir string, name string, size int, age time.Duration) string {
+		p := filepath.Join(dir, name)
+		err := os.WriteFile(p, make([]byte, size), 0644)
+		if err != nil {
+			t.Fatalf("write error %v", err)
+		}
+
+		mt := time.Now().Add(-age)
+		err = os.Chtimes(p, mt, mt)
+		if err != nil {
+			t.Fatalf("chtimes error %v", err)
+		}
+
+		return p
+	}
+
+	exists := func(p string) bool {
+		_, err := os.Stat(p)
+		return err == nil
+	}
+
+	t.Run("should remove expired files, other files are kept", func(t *testing.T) {
+		dir := t.TempDir()
+		r := NewRecorder(dir, 1920, 1080, 0, 0, time.Hour, 0)
+
+		old := useTestFile(t, dir, "record-20260101-000000.mp4", 10, 2*time.Hour)
+		recent := useTestFile(t, dir, "record-20260101-010000.mp4", 10, time.Minute)
+		other := useTestFile(t, dir, "other.mp4", 10, 2*time.Hour)
+
+		r.clean()
+
+		if exists(old) {
+			t.Errorf("expired file should be removed")
+		}
+		if !exists(recent) || !exists(other) {
+			t.Errorf("files should be kept")
+		}
+	})
+
+	t.Run("should remove oldest files, because total size exceeds max", func(t *testing.T) {
+		dir := t.TempDir()
+		r := NewRecorder(dir, 1920, 1080, 0, 0, 0, 25)
+
+		first := useTestFile(t, dir, "record-20260101-000000.mp4", 10, 0)
+		second := useTestFile(t, dir, "record-20260101-000000_1.mp4", 10, 0)
+		third := useTestFile(t, dir, "record-20260101-000001.mp4", 10, 0)
+
+		r.clean()
+
+		if exists(first) {
+			t.Errorf("oldest file should be removed")
+		}
+		if !exists(second) || !exists(third) {
+			t.Errorf("newer files should be kept")
+		}
+	})
+}
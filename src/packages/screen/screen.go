@@ -0,0 +1,215 @@
+package screen
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"device-go/src/libs/frame"
+)
+
+const (
+	ScreenEventChange = "change"
+	ScreenEventIdle   = "idle"
+)
+
+// hash distance of a material change, 0 to 64
+const screenDefaultThreshold = 10
+
+// luma difference of a change, difference hash ignores brightness, eg. black to blue screen
+const screenLumaThreshold = 32
+
+const screenDefaultIdle = 30 * time.Second
+const screenDefaultInterval = time.Second
+
+// events kept for polling
+const screenMaxEvents = 100
+
+// region of interest, in pixels of frame
+type ScreenRegion struct {
+	Name   string `json:"name"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// overrides threshold of config
+	Threshold int `json:"threshold,omitempty"`
+}
+
+// detection config, empty regions mean the whole frame
+type ScreenConfig struct {
+	// hash distance of a change, 0 to 64
+	Threshold int `json:"threshold,omitempty"`
+	// static duration of idle event in seconds
+	IdleSeconds uint `json:"idleSeconds,omitempty"`
+	// frame interval in milliseconds
+	IntervalMs uint `json:"intervalMs,omitempty"`
+
+	Regions []ScreenRegion `json:"regions,omitempty"`
+}
+
+// interval of frames to detect
+func (c ScreenConfig) Interval() time.Duration {
+	if c.IntervalMs == 0 {
+		return screenDefaultInterval
+	}
+
+	return time.Duration(c.IntervalMs) * time.Millisecond
+}
+
+type ScreenEvent struct {
+	Seq    uint64 `json:"seq"`
+	Time   int64  `json:"time"`
+	Type   string `json:"type"`
+	Region string `json:"region"`
+	// hash distance to the last change, 0 if only luma changes
+	Distance int `json:"distance,omitempty"`
+	// static duration in seconds, of idle event
+	IdleSeconds uint `json:"idleSeconds,omitempty"`
+}
+
+type screenState struct {
+	hash uint64
+	luma int
+	// frame timestamp in microseconds of the last change
+	changed uint64
+	idle    bool
+	started bool
+}
+
+type ScreenOnEvent func(e ScreenEvent)
+
+// screen change and idle detection with difference hash of regions
+//
+// a region changes when its hash or luma is far from the ones of the last change,
+// it is idle once when there is no change in idle duration
+type Screen struct {
+	regions    []ScreenRegion
+	thresholds []int
+	idle       time.Duration
+
+	states []screenState
+	seq    uint64
+	events []ScreenEvent
+	notify chan struct{}
+	mu     sync.Mutex
+
+	OnEvent ScreenOnEvent
+}
+
+func NewScreen(config ScreenConfig, width uint, height uint) Screen {
+	regions := config.Regions
+	if len(regions) == 0 {
+		regions = []ScreenRegion{{Name: "screen", Width: int(width), Height: int(height)}}
+	}
+
+	thresholds := make([]int, len(regions))
+	for i, r := range regions {
+		thresholds[i] = r.Threshold
+		if thresholds[i] <= 0 {
+			thresholds[i] = config.Threshold
+		}
+		if thresholds[i] <= 0 {
+			thresholds[i] = screenDefaultThreshold
+		}
+	}
+
+	idle := time.Duration(config.IdleSeconds) * time.Second
+	if idle == 0 {
+		idle = screenDefaultIdle
+	}
+
+	return Screen{
+		regions:    regions,
+		thresholds: thresholds,
+		idle:       idle,
+		states:     make([]screenState, len(regions)),
+		notify:     make(chan struct{}),
+	}
+}
+
+func (s *Screen) pushEvent(e ScreenEvent) ScreenEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	e.Seq = s.seq
+	e.Time = time.Now().Unix()
+
+	s.events = append(s.events, e)
+	if len(s.events) > screenMaxEvents {
+		s.events = s.events[len(s.events)-screenMaxEvents:]
+	}
+
+	close(s.notify)
+	s.notify = make(chan struct{})
+
+	return e
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// detect frame, frames are written in one goroutine
+func (s *Screen) Write(f frame.Frame) {
+	for i, r := range s.regions {
+		st := &s.states[i]
+		h := f.DHash(r.X, r.Y, r.Width, r.Height)
+		l := f.Luma(r.X, r.Y, r.Width, r.Height)
+
+		var e *ScreenEvent
+		if !st.started {
+			st.started = true
+			st.hash = h
+			st.luma = l
+			st.changed = f.Timestamp
+		} else if d := frame.HashDistance(st.hash, h); d >= s.thresholds[i] || abs(l-st.luma) >= screenLumaThreshold {
+			st.hash = h
+			st.luma = l
+			st.changed = f.Timestamp
+			st.idle = false
+			e = &ScreenEvent{Type: ScreenEventChange, Region: r.Name, Distance: d}
+		} else if d := time.Duration(f.Timestamp-st.changed) * time.Microsecond; !st.idle && f.Timestamp > st.changed && d >= s.idle {
+			st.idle = true
+			e = &ScreenEvent{Type: ScreenEventIdle, Region: r.Name, IdleSeconds: uint(d / time.Second)}
+		}
+
+		if e == nil {
+			continue
+		}
+
+		ee := s.pushEvent(*e)
+		if s.OnEvent != nil {
+			s.OnEvent(ee)
+		}
+	}
+}
+
+// events after seq, it blocks until there is a new event or context is done
+func (s *Screen) Events(ctx context.Context, after uint64) []ScreenEvent {
+	for {
+		s.mu.Lock()
+		events := []ScreenEvent{}
+		for _, e := range s.events {
+			if e.Seq > after {
+				events = append(events, e)
+			}
+		}
+		notify := s.notify
+		s.mu.Unlock()
+
+		if len(events) > 0 {
+			return events
+		}
+
+		select {
+		case <-ctx.Done():
+			return events
+		case <-notify:
+		}
+	}
+}
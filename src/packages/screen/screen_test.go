@@ -0,0 +1,113 @@
+package screen
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"device-go/src/libs/frame"
+)
+
+// frame of seconds, left half is white if bright
+func useTestFrame(second uint64, bright bool) frame.Frame {
+	f := frame.NewFrame(64, 32)
+	f.Timestamp = second * 1000000
+	if bright {
+		f.FillRect(0, 0, 32, 32, frame.ColorWhite)
+	}
+
+	return f
+}
+
+func TestScreen(t *testing.T) {
+	t.Run("should emit change and idle once", func(t *testing.T) {
+		s := NewScreen(ScreenConfig{IdleSeconds: 5}, 64, 32)
+
+		events := []ScreenEvent{}
+		s.OnEvent = func(e ScreenEvent) {
+			events = append(events, e)
+		}
+
+		for i := range uint64(20) {
+			s.Write(useTestFrame(i, i >= 2))
+		}
+
+		if len(events) != 2 {
+			t.Fatalf("events not match %v", events)
+		}
+		if events[0].Type != ScreenEventChange || events[0].Region != "screen" || events[0].Distance < 10 {
+			t.Errorf("change not match %v", events[0])
+		}
+		if events[1].Type != ScreenEventIdle || events[1].IdleSeconds != 5 || events[1].Seq != 2 {
+			t.Errorf("idle not match %v", events[1])
+		}
+	})
+
+	t.Run("should detect regions with thresholds", func(t *testing.T) {
+		s := NewScreen(ScreenConfig{
+			Threshold: 64,
+			Regions: []ScreenRegion{
+				{Name: "left", X: 0, Y: 0, Width: 32, Height: 32, Threshold: 1},
+				{Name: "right", X: 32, Y: 0, Width: 32, Height: 32, Threshold: 1},
+				{Name: "all", X: 0, Y: 0, Width: 64, Height: 32},
+			},
+		}, 64, 32)
+
+		s.Write(useTestFrame(0, false))
+		f := useTestFrame(1, false)
+		f.FillRect(0, 0, 8, 32, frame.ColorWhite)
+		s.Write(f)
+
+		events := s.Events(context.Background(), 0)
+		if len(events) != 1 || events[0].Region != "left" {
+			t.Errorf("events not match %v", events)
+		}
+	})
+
+	t.Run("should block events until new one", func(t *testing.T) {
+		s := NewScreen(ScreenConfig{}, 64, 32)
+		s.Write(useTestFrame(0, false))
+
+		done := make(chan []ScreenEvent)
+		go func() {
+			done <- s.Events(context.Background(), 0)
+		}()
+
+		select {
+		case <-done:
+			t.Fatalf("events should block")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		s.Write(useTestFrame(1, true))
+
+		select {
+		case events := <-done:
+			if len(events) != 1 {
+				t.Errorf("events not match %v", events)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("events should be done")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if events := s.Events(ctx, 1); len(events) != 0 {
+			t.Errorf("events should be empty %v", events)
+		}
+	})
+
+	t.Run("should detect uniform screen change with luma", func(t *testing.T) {
+		s := NewScreen(ScreenConfig{}, 64, 32)
+
+		s.Write(useTestFrame(0, false))
+		f := useTestFrame(1, false)
+		f.FillRect(0, 0, 64, 32, frame.NewColor(0, 120, 215))
+		s.Write(f)
+
+		events := s.Events(context.Background(), 0)
+		if len(events) != 1 || events[0].Type != ScreenEventChange || events[0].Distance != 0 {
+			t.Errorf("events not match %v", events)
+		}
+	})
+}
@@ -0,0 +1,371 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"sync"
+	"time"
+
+	"device-go/src/libs/frame"
+)
+
+const (
+	SnapshotFormatJpeg string = "jpeg"
+	SnapshotFormatPng  string = "png"
+)
+
+// wait the next frame, a key frame of encoded media may be a gop away
+const snapshotFrameTimeout = 8 * time.Second
+
+// frames are closed after this idle duration
+const snapshotIdleTimeout = 10 * time.Second
+
+const snapshotJpegQuality = 85
+
+type snapshotKey struct {
+	width  uint
+	height uint
+	format string
+}
+
+type snapshotCache struct {
+	data []byte
+	time time.Time
+}
+
+// encoded image of a frame, shared by streams
+type snapshotStreamCache struct {
+	data      []byte
+	timestamp uint64
+}
+
+// frames are wanted, they are written by `WriteFrame` until close
+type SnapshotOnOpen func() error
+
+type Snapshot struct {
+	opened    bool
+	openTimer *time.Timer
+	openMu    sync.Mutex
+
+	// cache time to live, captures in this duration share the same image
+	ttl time.Duration
+
+	waiters     []chan frame.Frame
+	cache       map[snapshotKey]snapshotCache
+	streamCache map[snapshotKey]snapshotStreamCache
+	mu          sync.Mutex
+
+	// masks and overlays, images never contain the raw frame
+	Processor frame.Processor
+
+	// source of frames, eg. the raw capture, it is shared with media
+	OnOpen  SnapshotOnOpen
+	OnClose func()
+}
+
+func NewSnapshot(ttl time.Duration) Snapshot {
+	return Snapshot{
+		ttl:         ttl,
+		cache:       map[snapshotKey]snapshotCache{},
+		streamCache: map[snapshotKey]snapshotStreamCache{},
+	}
+}
+
+// write nv12 frame of the source, it is copied only if it is waited, the source may reuse it
+func (s *Snapshot) WriteFrame(f frame.Frame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.waiters) == 0 {
+		return
+	}
+
+	cf := f
+	cf.Data = make([]byte, len(f.Data))
+	copy(cf.Data, f.Data)
+
+	for _, w := range s.waiters {
+		w <- cf
+	}
+	s.waiters = nil
+}
+
+// a frame is waited, eg. a source decodes a frame only then
+func (s *Snapshot) Waiting() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.waiters) > 0
+}
+
+// open the source if it is closed
+func (s *Snapshot) open() error {
+	s.openMu.Lock()
+	defer s.openMu.Unlock()
+
+	// delay close
+	if s.openTimer != nil {
+		s.openTimer.Stop()
+	}
+	s.openTimer = time.AfterFunc(snapshotIdleTimeout, s.close)
+
+	if s.opened {
+		return nil
+	}
+
+	if s.OnOpen != nil {
+		err := s.OnOpen()
+		if err != nil {
+			return err
+		}
+	}
+	s.opened = true
+
+	return nil
+}
+
+func (s *Snapshot) close() {
+	s.openMu.Lock()
+	defer s.openMu.Unlock()
+
+	if s.openTimer != nil {
+		s.openTimer.Stop()
+		s.openTimer = nil
+	}
+
+	if !s.opened {
+		return
+	}
+
+	if s.OnClose != nil {
+		s.OnClose()
+	}
+	s.opened = false
+}
+
+// wait next frame, it is shared by waiters
+func (s *Snapshot) next() (frame.Frame, error) {
+	w := make(chan frame.Frame, 1)
+
+	err := s.open()
+	if err != nil {
+		return frame.Frame{}, err
+	}
+
+	s.mu.Lock()
+	s.waiters = append(s.waiters, w)
+	s.mu.Unlock()
+
+	select {
+	case f := <-w:
+		return f, nil
+	case <-time.After(snapshotFrameTimeout):
+		{
+			s.mu.Lock()
+			for i, v := range s.waiters {
+				if v == w {
+					s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+					break
+				}
+			}
+			s.mu.Unlock()
+
+			return frame.Frame{}, fmt.Errorf("snapshot wait frame timeout")
+		}
+	}
+}
+
+// wait next frame without processors, eg. for detection, it must not leave the device
+func (s *Snapshot) Next() (frame.Frame, error) {
+	return s.next()
+}
+
+// wait next frame with processors, eg. for text recognition, the result leaves the device
+func (s *Snapshot) NextProcessed() (frame.Frame, error) {
+	f, err := s.next()
+	if err != nil {
+		return frame.Frame{}, err
+	}
+
+	return s.process(f), nil
+}
+
+// processed copy of frame
+func (s *Snapshot) process(f frame.Frame) frame.Frame {
+	if s.Processor == nil {
+		return f
+	}
+
+	pf := f
+	pf.Data = make([]byte, len(f.Data))
+	copy(pf.Data, f.Data)
+	s.Processor.Process(&pf)
+
+	return pf
+}
+
+func (s *Snapshot) useCache(key snapshotKey) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.cache[key]
+	if !ok || time.Since(c.time) > s.ttl {
+		return nil
+	}
+
+	return c.data
+}
+
+func (s *Snapshot) setCache(key snapshotKey, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := time.Now()
+
+	// drop expired
+	for k, v := range s.cache {
+		if n.Sub(v.time) > s.ttl {
+			delete(s.cache, k)
+		}
+	}
+
+	s.cache[key] = snapshotCache{data: data, time: n}
+}
+
+// encode frame to image, see `Capture` for width and height
+func Encode(f frame.Frame, width uint, height uint, format string) ([]byte, error) {
+	// keep aspect ratio if only one side is set
+	if width == 0 && height == 0 {
+		width = f.Width
+		height = f.Height
+	} else if height == 0 && f.Width != 0 {
+		height = width * f.Height / f.Width
+	} else if width == 0 && f.Height != 0 {
+		width = height * f.Width / f.Height
+	}
+
+	sf, err := f.Scale(width, height)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := sf.ToImage()
+	if err != nil {
+		return nil, err
+	}
+
+	b := bytes.Buffer{}
+	switch format {
+	case SnapshotFormatJpeg, "":
+		err = jpeg.Encode(&b, img, &jpeg.Options{Quality: snapshotJpegQuality})
+	case SnapshotFormatPng:
+		err = png.Encode(&b, img)
+	default:
+		err = fmt.Errorf("snapshot unknown format %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// capture an image, width and height 0 means the capture size
+//
+// if only one side is set, the other side keeps the aspect ratio
+func (s *Snapshot) Capture(width uint, height uint, format string) ([]byte, error) {
+	if format == "" {
+		format = SnapshotFormatJpeg
+	}
+
+	key := snapshotKey{width: width, height: height, format: format}
+
+	data := s.useCache(key)
+	if data != nil {
+		return data, nil
+	}
+
+	f, err := s.next()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = Encode(s.process(f), width, height, format)
+	if err != nil {
+		log.Println("snapshot encode error", err)
+		return nil, err
+	}
+
+	s.setCache(key, data)
+
+	return data, nil
+}
+
+// encode frame for stream, the image is shared if the frame is encoded by another stream
+func (s *Snapshot) encodeStream(key snapshotKey, f frame.Frame) ([]byte, error) {
+	s.mu.Lock()
+	c, ok := s.streamCache[key]
+	s.mu.Unlock()
+	if ok && c.timestamp == f.Timestamp {
+		return c.data, nil
+	}
+
+	data, err := Encode(s.process(f), key.width, key.height, key.format)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// drop images of old frames
+	for k, v := range s.streamCache {
+		if v.timestamp != f.Timestamp {
+			delete(s.streamCache, k)
+		}
+	}
+	s.streamCache[key] = snapshotStreamCache{data: data, timestamp: f.Timestamp}
+
+	return data, nil
+}
+
+// stream jpeg images at most fps, until context is done or write returns error
+//
+// see `Capture` for width and height
+func (s *Snapshot) Stream(ctx context.Context, width uint, height uint, fps uint, write func(data []byte) error) error {
+	interval := time.Second / time.Duration(max(fps, 1))
+	key := snapshotKey{width: width, height: height, format: SnapshotFormatJpeg}
+
+	for {
+		start := time.Now()
+
+		f, err := s.next()
+		if err != nil {
+			return err
+		}
+
+		data, err := s.encodeStream(key, f)
+		if err != nil {
+			return err
+		}
+
+		err = write(data)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval - time.Since(start)):
+		}
+	}
+}
+
+func (s *Snapshot) Close() {
+	s.close()
+}
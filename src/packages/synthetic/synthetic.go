@@ -0,0 +1,206 @@
+package synthetic
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"device-go/src/libs/frame"
+	"device-go/src/libs/h264"
+)
+
+type SyntheticOnData func(id uint32, timestamp uint64, frame []byte)
+
+// synthetic h264 video source, for development without capture hardware
+//
+// it encodes a test pattern in process, or loops an annex b file
+type Synthetic struct {
+	path   string
+	width  uint
+	height uint
+	fps    uint
+	gop    uint
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// masks and overlays of test pattern, before encoding
+	Processor frame.Processor
+
+	OnData SyntheticOnData
+}
+
+// create synthetic source, empty path means test pattern
+func NewSynthetic(path string, width uint, height uint, fps uint, gop uint) Synthetic {
+	return Synthetic{
+		path:   path,
+		width:  width,
+		height: height,
+		fps:    fps,
+		gop:    gop,
+	}
+}
+
+// 75% color bars
+var syntheticBars = []frame.Color{
+	frame.NewColor(191, 191, 191),
+	frame.NewColor(191, 191, 0),
+	frame.NewColor(0, 191, 191),
+	frame.NewColor(0, 191, 0),
+	frame.NewColor(191, 0, 191),
+	frame.NewColor(191, 0, 0),
+	frame.NewColor(0, 0, 191),
+}
+
+// test pattern without moving parts
+func (s *Synthetic) useBackground() frame.Frame {
+	f := frame.NewFrame(s.width, s.height)
+
+	w := int(s.width)
+	h := int(s.height)
+
+	// bars at top 2/3
+	for i, c := range syntheticBars {
+		x0 := w * i / len(syntheticBars)
+		x1 := w * (i + 1) / len(syntheticBars)
+		f.FillRect(x0, 0, x1-x0, h*2/3, c)
+	}
+
+	scale := max(h/180, 1)
+	label := fmt.Sprintf("KVVM TEST %dx%d", s.width, s.height)
+	f.DrawText(scale*4, h*2/3+scale*4, scale, label, frame.ColorWhite)
+
+	return f
+}
+
+// draw moving parts
+func (s *Synthetic) draw(f *frame.Frame, bg *frame.Frame, n uint, t time.Time) {
+	copy(f.Data, bg.Data)
+
+	w := int(s.width)
+	h := int(s.height)
+	scale := max(h/180, 1)
+	_, th := frame.TextSize("0", scale)
+
+	// timestamp and frame number
+	text := fmt.Sprintf("%s %06d", t.Format("2006-01-02 15:04:05.000"), n)
+	f.DrawText(scale*4, h*2/3+scale*8+th, scale, text, frame.ColorWhite)
+
+	// square moves from left to right in 4 seconds
+	size := th
+	period := s.fps * 4
+	x := (w - size) * int(n%period) / int(period)
+	f.FillRect(x, h-size-scale*4, size, size, frame.ColorWhite)
+}
+
+func (s *Synthetic) handlePattern(ctx context.Context) {
+	defer s.wg.Done()
+
+	e, err := h264.NewEncoder(s.width, s.height, s.gop)
+	if err != nil {
+		log.Println("synthetic new encoder error", err)
+		return
+	}
+
+	bg := s.useBackground()
+	f := frame.NewFrame(s.width, s.height)
+
+	ticker := time.NewTicker(time.Second / time.Duration(s.fps))
+	defer ticker.Stop()
+
+	n := uint(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			s.draw(&f, &bg, n, t)
+			if s.Processor != nil {
+				s.Processor.Process(&f)
+			}
+
+			au, err := e.Encode(f)
+			if err != nil {
+				log.Println("synthetic encode error", err)
+				return
+			}
+
+			if s.OnData != nil {
+				s.OnData(uint32(n), uint64(t.UnixMicro()), au)
+			}
+			n++
+		}
+	}
+}
+
+func (s *Synthetic) handleFile(ctx context.Context, aus [][]byte) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(time.Second / time.Duration(s.fps))
+	defer ticker.Stop()
+
+	n := uint(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			// loop
+			au := aus[n%uint(len(aus))]
+
+			if s.OnData != nil {
+				s.OnData(uint32(n), uint64(t.UnixMicro()), au)
+			}
+			n++
+		}
+	}
+}
+
+func (s *Synthetic) Open() error {
+	if s.cancel != nil {
+		return fmt.Errorf("synthetic exists")
+	} else if s.fps == 0 {
+		return fmt.Errorf("synthetic invalid fps %d", s.fps)
+	}
+
+	var aus [][]byte
+	if s.path != "" {
+		b, err := os.ReadFile(s.path)
+		if err != nil {
+			return err
+		}
+
+		aus = h264.SplitAccessUnits(b)
+		if len(aus) == 0 {
+			return fmt.Errorf("synthetic no access unit in %s", s.path)
+		} else if !h264.IsKeyFrame(aus[0]) {
+			return fmt.Errorf("synthetic file not start with key frame %s", s.path)
+		}
+	} else if _, err := h264.NewEncoder(s.width, s.height, s.gop); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	s.wg.Add(1)
+	if aus != nil {
+		go s.handleFile(ctx, aus)
+	} else {
+		go s.handlePattern(ctx)
+	}
+
+	return nil
+}
+
+func (s *Synthetic) Close() {
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+
+	s.wg.Wait()
+}
@@ -0,0 +1,144 @@
+package uac
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pion/rtp"
+
+	"device-go/src/libs/exec"
+	"device-go/src/libs/socket"
+)
+
+// usb audio class 2 gadget is a microphone of the target, its playback is sent to the target
+//
+// browser microphone opus is decoded by the helper or gstreamer, then played to the gadget
+
+// the gadget is mono 48kHz, see `scripts/setup_usb.sh`
+const uacSampleRate uint = 48000
+const uacChannel uint = 1
+
+// jitter buffer of gstreamer in milliseconds
+const uacGstLatency = 60
+
+type Uac struct {
+	ex exec.Exec
+
+	// helper, opus packets with socket header
+	socket *socket.Socket
+
+	// gstreamer, rtp to udp
+	port   int
+	conn   *net.UDPConn
+	connMu sync.RWMutex
+}
+
+// the helper decodes opus packets of socket, same framing as speech record
+func NewUac(hardware string, binPath string, socketPath string) Uac {
+	s := socket.NewSocket(socketPath)
+
+	return Uac{
+		ex: exec.NewExec(
+			binPath,
+			"-d", hardware,
+			"-s", socketPath,
+			// opus
+			"-e", "opus",
+			"-r", strconv.FormatUint(uint64(uacSampleRate), 10),
+			"-c", strconv.FormatUint(uint64(uacChannel), 10),
+		),
+		socket: &s,
+	}
+}
+
+// gstreamer receives rtp on localhost port
+func NewUacGstreamer(hardware string, port int) Uac {
+	pipeline := "udpsrc address=127.0.0.1 port=" + strconv.Itoa(port) + " " +
+		"caps=application/x-rtp,media=audio,encoding-name=OPUS,clock-rate=48000 ! " +
+		"rtpjitterbuffer latency=" + strconv.Itoa(uacGstLatency) + " ! rtpopusdepay ! opusdec plc=true ! " +
+		"audioconvert ! audioresample ! " +
+		"audio/x-raw,format=S16LE,rate=" + strconv.FormatUint(uint64(uacSampleRate), 10) + ",channels=" + strconv.FormatUint(uint64(uacChannel), 10) + " ! " +
+		"alsasink device=" + hardware + " sync=false"
+
+	args := append([]string{"-q"}, strings.Fields(pipeline)...)
+
+	return Uac{
+		ex:   exec.NewExec("gst-launch-1.0", args...),
+		port: port,
+	}
+}
+
+func (u *Uac) Open() error {
+	if u.socket != nil {
+		err := u.socket.Open()
+		if err != nil {
+			return err
+		}
+	} else {
+		u.connMu.Lock()
+		conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: u.port})
+		u.conn = conn
+		u.connMu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := u.ex.Start()
+	if err != nil {
+		u.Close()
+		return err
+	}
+
+	return nil
+}
+
+func (u *Uac) Close() {
+	u.ex.Stop()
+
+	if u.socket != nil {
+		u.socket.Close()
+	}
+
+	u.connMu.Lock()
+	defer u.connMu.Unlock()
+
+	if u.conn != nil {
+		u.conn.Close()
+		u.conn = nil
+	}
+}
+
+// write rtp packet of browser microphone
+func (u *Uac) WriteRtp(b []byte) error {
+	if u.socket == nil {
+		u.connMu.RLock()
+		defer u.connMu.RUnlock()
+
+		if u.conn == nil {
+			return fmt.Errorf("uac null connection")
+		}
+
+		_, err := u.conn.Write(b)
+		return err
+	}
+
+	p := rtp.Packet{}
+	err := p.Unmarshal(b)
+	if err != nil {
+		return err
+	} else if len(p.Payload) == 0 {
+		return nil
+	}
+
+	// reserved 0 is rtp sequence, the helper conceals lost packets
+	return u.socket.Send([8]uint32{uint32(p.SequenceNumber)}, p.Payload)
+}
+
+// last lines of helper or gstreamer stderr, for diagnostics
+func (u *Uac) Stderr() []string {
+	return u.ex.Stderr()
+}
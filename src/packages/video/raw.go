@@ -0,0 +1,117 @@
+package video
+
+import (
+	"log"
+	"strconv"
+
+	"device-go/src/libs/exec"
+	"device-go/src/libs/frame"
+	"device-go/src/libs/socket"
+	"device-go/src/libs/watchdog"
+)
+
+type VideoRawOnFrame func(f frame.Frame)
+
+// raw video, the helper sends nv12 frames without encoding
+//
+// header reserved 0 is width, reserved 1 is height
+type VideoRaw struct {
+	ex       exec.Exec
+	socket   socket.Socket
+	watchdog watchdog.Watchdog
+
+	OnFrame   VideoRawOnFrame
+	OnRestart VideoOnRestart
+}
+
+func NewVideoRaw(
+	path string,
+	binPath string,
+	socketPath string,
+	width uint,
+	height uint,
+) VideoRaw {
+	return VideoRaw{
+		ex: exec.NewExec(
+			binPath,
+			"-w", strconv.FormatUint(uint64(width), 10),
+			"-h", strconv.FormatUint(uint64(height), 10),
+			"-i", path,
+			"-o", socketPath,
+		),
+		socket: socket.NewSocket(socketPath),
+	}
+}
+
+func (v *VideoRaw) start() error {
+	err := v.socket.Open()
+	if err != nil {
+		return err
+	}
+
+	err = v.ex.Start()
+	if err != nil {
+		v.socket.Close()
+		return err
+	}
+
+	return nil
+}
+
+func (v *VideoRaw) stop() {
+	v.ex.Stop()
+	v.socket.Close()
+}
+
+func (v *VideoRaw) restart(reason string, count uint) {
+	stderr := v.ex.Stderr()
+	log.Println("video raw restart", reason, count)
+
+	v.stop()
+	err := v.start()
+	if err != nil {
+		log.Println("video raw restart error", err)
+	}
+
+	if v.OnRestart != nil {
+		v.OnRestart(reason, count, stderr, err)
+	}
+}
+
+func (v *VideoRaw) Open() error {
+	v.socket.OnData = func(header socket.SocketHeader, body []byte) {
+		v.watchdog.Feed()
+
+		if v.OnFrame == nil {
+			return
+		}
+		v.OnFrame(frame.Frame{
+			Width:     uint(header.Reserved[0]),
+			Height:    uint(header.Reserved[1]),
+			Timestamp: header.Timestamp,
+			Data:      body,
+		})
+	}
+	// helper exits or crashes
+	v.socket.OnClose = func(err error) {
+		log.Println("video raw socket closed", err)
+		v.watchdog.Trigger(watchdog.WatchdogReasonEOF)
+	}
+
+	// before start, the socket feeds it
+	v.watchdog = watchdog.NewWatchdog(videoStallTimeout, videoMinBackoff, videoMaxBackoff, v.restart)
+
+	err := v.start()
+	if err != nil {
+		return err
+	}
+
+	v.watchdog.Open()
+
+	return nil
+}
+
+func (v *VideoRaw) Close() {
+	v.watchdog.Close()
+	v.stop()
+}
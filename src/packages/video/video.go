@@ -1,19 +1,34 @@
 package video
 
 import (
+	"log"
 	"strconv"
+	"time"
 
 	"device-go/src/libs/exec"
 	"device-go/src/libs/socket"
+	"device-go/src/libs/watchdog"
+	"device-go/src/libs/webrtc"
 )
 
+// no frame in this duration is a stall, it includes the helper start
+const videoStallTimeout = 5 * time.Second
+
+const videoMinBackoff = time.Second
+const videoMaxBackoff = 30 * time.Second
+
 type VideoOnData func(id uint32, timestamp uint64, frame []byte)
 
+// helper and socket are restarted, stderr is of the stopped helper
+type VideoOnRestart func(reason string, count uint, stderr []string, err error)
+
 type Video struct {
-	ex     exec.Exec
-	socket socket.Socket
+	ex       exec.Exec
+	socket   socket.Socket
+	watchdog watchdog.Watchdog
 
-	OnData VideoOnData
+	OnData    VideoOnData
+	OnRestart VideoOnRestart
 }
 
 func NewVideo(
@@ -24,44 +39,91 @@ func NewVideo(
 	height uint,
 	bitRate uint,
 	gop uint,
+	codec string,
 ) Video {
+	args := []string{
+		"-w", strconv.FormatUint(uint64(width), 10),
+		"-h", strconv.FormatUint(uint64(height), 10),
+		"-i", path,
+		"-o", socketPath,
+		"-b", strconv.FormatUint(uint64(bitRate), 10),
+		"-g", strconv.FormatUint(uint64(gop), 10),
+	}
+	// helpers without codec support encode h264 only
+	if codec != webrtc.VideoCodecH264 {
+		args = append(args, "-c", codec)
+	}
+
 	return Video{
-		ex: exec.NewExec(
-			binPath,
-			"-w", strconv.FormatUint(uint64(width), 10),
-			"-h", strconv.FormatUint(uint64(height), 10),
-			"-i", path,
-			"-o", socketPath,
-			"-b", strconv.FormatUint(uint64(bitRate), 10),
-			"-g", strconv.FormatUint(uint64(gop), 10),
-		),
+		ex:     exec.NewExec(binPath, args...),
 		socket: socket.NewSocket(socketPath),
 	}
 }
 
+func (v *Video) start() error {
+	err := v.socket.Open()
+	if err != nil {
+		return err
+	}
+
+	err = v.ex.Start()
+	if err != nil {
+		v.socket.Close()
+		return err
+	}
+
+	return nil
+}
+
+func (v *Video) stop() {
+	v.ex.Stop()
+	v.socket.Close()
+}
+
+func (v *Video) restart(reason string, count uint) {
+	stderr := v.ex.Stderr()
+	log.Println("video restart", reason, count)
+
+	v.stop()
+	err := v.start()
+	if err != nil {
+		log.Println("video restart error", err)
+	}
+
+	if v.OnRestart != nil {
+		v.OnRestart(reason, count, stderr, err)
+	}
+}
+
 func (v *Video) Open() error {
 	v.socket.OnData = func(header socket.SocketHeader, body []byte) {
+		v.watchdog.Feed()
+
 		if v.OnData == nil {
 			return
 		}
 		v.OnData(header.ID, header.Timestamp, body)
 	}
-
-	err := v.socket.Open()
-	if err != nil {
-		return err
+	// helper exits or crashes
+	v.socket.OnClose = func(err error) {
+		log.Println("video socket closed", err)
+		v.watchdog.Trigger(watchdog.WatchdogReasonEOF)
 	}
 
-	err = v.ex.Start()
+	// before start, the socket feeds it
+	v.watchdog = watchdog.NewWatchdog(videoStallTimeout, videoMinBackoff, videoMaxBackoff, v.restart)
+
+	err := v.start()
 	if err != nil {
-		v.socket.Close()
 		return err
 	}
 
+	v.watchdog.Open()
+
 	return nil
 }
 
 func (v *Video) Close() {
-	v.ex.Stop()
-	v.socket.Close()
+	v.watchdog.Close()
+	v.stop()
 }
@@ -0,0 +1,194 @@
+package src
+
+import (
+	"fmt"
+	"log"
+)
+
+// video quality presets, viewers choose one at webrtc start or in the session
+const (
+	QualityPresetHigh   = "high"
+	QualityPresetMedium = "medium"
+	QualityPresetLow    = "low"
+)
+
+var qualityPresets = map[string]DeviceMessageQuality{
+	QualityPresetHigh:   {Width: 1920, Height: 1080, BitRate: 10 * 1024, Fps: videoFps, Gop: 60},
+	QualityPresetMedium: {Width: 1280, Height: 720, BitRate: 4 * 1024, Fps: videoFps, Gop: 60},
+	QualityPresetLow:    {Width: 960, Height: 540, BitRate: 1536, Fps: videoFps, Gop: 60},
+}
+
+// bit rate range in kbit/s
+const qualityMinBitRate uint = 256
+const qualityMaxBitRate uint = 20 * 1024
+
+const qualityMinWidth uint = 320
+const qualityMinHeight uint = 180
+const qualityMaxGop uint = 600
+
+func defaultQuality() DeviceMessageQuality {
+	q := qualityPresets[QualityPresetHigh]
+	q.Preset = QualityPresetHigh
+	return q
+}
+
+// frame rate could be changed only when the encoder drops frames itself
+func (d *Device) supportsFps() bool {
+	switch d.mediaSource {
+	case DeviceMediaSourceSynthetic:
+		return d.syntheticPath == ""
+	case DeviceMediaSourceGst:
+		return d.gstProfile.SupportsFps()
+	default:
+		return false
+	}
+}
+
+// quality of request, preset first, then explicit values override it, nil is the default
+//
+// it is validated against the capture size and the media source
+func (d *Device) useQuality(req *DeviceMessageQuality) (DeviceMessageQuality, error) {
+	q := defaultQuality()
+	if req == nil {
+		return q, nil
+	}
+
+	if req.Preset != "" {
+		p, ok := qualityPresets[req.Preset]
+		if !ok {
+			return q, fmt.Errorf("quality preset %s not found", req.Preset)
+		}
+		q = p
+		q.Preset = req.Preset
+	}
+
+	// explicit values are custom quality
+	custom := false
+	for _, v := range []struct {
+		value uint
+		field *uint
+	}{
+		{req.Width, &q.Width},
+		{req.Height, &q.Height},
+		{req.BitRate, &q.BitRate},
+		{req.Fps, &q.Fps},
+		{req.Gop, &q.Gop},
+	} {
+		if v.value != 0 && v.value != *v.field {
+			*v.field = v.value
+			custom = true
+		}
+	}
+	if custom {
+		q.Preset = ""
+	}
+
+	if q.Width < qualityMinWidth || q.Width > videoWidth || q.Height < qualityMinHeight || q.Height > videoHeight {
+		return q, fmt.Errorf("quality size %dx%d out of %dx%d to %dx%d", q.Width, q.Height, qualityMinWidth, qualityMinHeight, videoWidth, videoHeight)
+	} else if q.Width%2 != 0 || q.Height%2 != 0 {
+		return q, fmt.Errorf("quality size %dx%d not even", q.Width, q.Height)
+	} else if q.BitRate < qualityMinBitRate || q.BitRate > qualityMaxBitRate {
+		return q, fmt.Errorf("quality bit rate %d out of %d to %d", q.BitRate, qualityMinBitRate, qualityMaxBitRate)
+	} else if q.Fps > videoFps {
+		return q, fmt.Errorf("quality fps %d over capture fps %d", q.Fps, videoFps)
+	} else if q.Fps != videoFps && !d.supportsFps() {
+		return q, fmt.Errorf("quality fps %d unsupported by media source %d", q.Fps, d.mediaSource)
+	} else if q.Gop > qualityMaxGop {
+		return q, fmt.Errorf("quality gop %d over %d", q.Gop, qualityMaxGop)
+	}
+
+	return q, nil
+}
+
+// change quality in the session, the encoder restarts with the same codec, so tracks are kept,
+// and no renegotiation is needed
+//
+// media shared by rtsp, hls or whep keeps its quality, their clients do not expect a new size
+func (d *Device) wrtcSetQuality(req *DeviceMessageQuality) (*DeviceMessageQuality, error) {
+	d.recordMu.Lock()
+	defer d.recordMu.Unlock()
+
+	if d.useWrtc() == nil {
+		return nil, fmt.Errorf("device null webrtc")
+	}
+
+	q, err := d.useQuality(req)
+	if err != nil {
+		return nil, err
+	}
+	d.wrtcQuality = q
+
+	// media starts at the offer with the quality
+	if !d.hasMediaSink(mediaSinkWebRTC) {
+		return &q, nil
+	}
+
+	if d.mediaShared() {
+		return nil, fmt.Errorf("device media is shared by rtsp, hls or whep")
+	}
+
+	// a file must not change its size
+	recording := d.recording
+	d.recordStop()
+
+	err = d.mediaRestart(q)
+
+	if recording {
+		d.recordStart()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &q, nil
+}
+
+// media has sinks other than the session and its record
+func (d *Device) mediaShared() bool {
+	d.mediaSinksMu.RLock()
+	defer d.mediaSinksMu.RUnlock()
+
+	for name := range d.mediaSinks {
+		if name != mediaSinkWebRTC && name != mediaSinkRecord {
+			return true
+		}
+	}
+
+	return false
+}
+
+// restart running media with quality, sinks are kept
+func (d *Device) mediaRestart(q DeviceMessageQuality) error {
+	d.mediaMu.Lock()
+	defer d.mediaMu.Unlock()
+
+	if !d.mediaRunning() {
+		return fmt.Errorf("device media not running")
+	} else if q == d.mediaQuality {
+		return nil
+	}
+
+	codec := d.mediaCodec
+	last := d.mediaQuality
+	d.mediaStop()
+
+	d.mediaQuality = q
+	err := d.mediaStart(codec)
+	if err != nil {
+		log.Println("device media restart error, fallback to last quality", err)
+		d.mediaStop()
+
+		// sinks still wait for media
+		d.mediaQuality = last
+		rerr := d.mediaStart(codec)
+		if rerr != nil {
+			log.Println("device media restart fallback error", rerr)
+			d.mediaStop()
+		}
+		return err
+	}
+
+	log.Println("device media restart", codec, q.Width, q.Height, q.BitRate, q.Fps, q.Gop)
+
+	return nil
+}
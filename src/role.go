@@ -0,0 +1,155 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	WEBRTC "github.com/pion/webrtc/v4"
+
+	"device-go/src/libs/grant"
+	"device-go/src/libs/rpc"
+)
+
+// codes of typed errors, codes of grant errors are passed through
+const (
+	DeviceErrorGrantRequired    = "grant-required"
+	DeviceErrorPermissionDenied = "permission-denied"
+	DeviceErrorCodecUnsupported = "codec-unsupported"
+)
+
+// json rpc code of permission denied
+const controlErrorCodePermissionDenied = -32001
+
+// typed error, it is surfaced to the client as the error of an error message
+type DeviceError struct {
+	Code    string
+	Message string
+}
+
+func newDeviceError(code string, format string, a ...any) *DeviceError {
+	return &DeviceError{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+func (e *DeviceError) Error() string {
+	return fmt.Sprintf("device %s %s", e.Code, e.Message)
+}
+
+// error message, with code and message of a typed error, other errors are not surfaced
+func NewDeviceErrorMessage(err error) DeviceMessage {
+	m := NewDeviceMessage(Error)
+
+	var de *DeviceError
+	var ge *grant.GrantError
+	if errors.As(err, &de) {
+		m.Error = &DeviceMessageError{Code: de.Code, Message: de.Message}
+	} else if errors.As(err, &ge) {
+		m.Error = &DeviceMessageError{Code: ge.Code, Message: ge.Message}
+	}
+
+	return m
+}
+
+// required role of data channels, control checks its methods
+var dataChannelRoles = map[string]string{
+	"hid":       grant.RoleControl,
+	"clipboard": grant.RoleControl,
+	"control":   grant.RoleView,
+	"events":    grant.RoleView,
+	"snapshot":  grant.RoleView,
+}
+
+// required role of control methods, every control method is listed
+var controlMethodRoles = map[string]string{
+	"status.get":        grant.RoleView,
+	"session.keepalive": grant.RoleView,
+	"quality.set":       grant.RoleView,
+	"macro.run":         grant.RoleControl,
+	"wol.send":          grant.RoleAdmin,
+	"power.action":      grant.RoleAdmin,
+}
+
+// min length of the grant key, hmac sha256 key of 32 bytes
+const grantKeyMinLength = 32
+
+// role of the session by the grant of webrtc start
+//
+// local signaling is checked as remote, the local api token is not a grant,
+// without grant key in config the session is view only
+func (d *Device) useRole(msg DeviceMessage) (string, error) {
+	key := d.useGrantKey()
+	if len(key) == 0 {
+		log.Println("device session without grant key, view only")
+		return grant.RoleView, nil
+	} else if msg.Grant == "" {
+		return "", newDeviceError(DeviceErrorGrantRequired, "grant required")
+	}
+
+	g, err := grant.Verify(msg.Grant, key, d.cf.Config.ID, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	log.Println("device session grant", g.Role, g.Subject)
+
+	return g.Role, nil
+}
+
+func (d *Device) useGrantKey() []byte {
+	d.grantMu.Lock()
+	defer d.grantMu.Unlock()
+
+	return d.cf.Config.GrantKey
+}
+
+// grant key of the server, it is saved to config, a running session keeps its role
+func (d *Device) setGrantKey(key []byte) error {
+	if len(key) < grantKeyMinLength {
+		return fmt.Errorf("device grant key length %d, min %d", len(key), grantKeyMinLength)
+	}
+
+	d.grantMu.Lock()
+	defer d.grantMu.Unlock()
+
+	d.cf.Config.GrantKey = key
+	return d.cf.Save()
+}
+
+func (d *Device) wrtcAllows(required string) error {
+	if !grant.RoleAllows(d.wrtcRole, required) {
+		return newDeviceError(DeviceErrorPermissionDenied, "role %s requires %s", d.wrtcRole, required)
+	}
+
+	return nil
+}
+
+// data channel of the role, a rejection is sent by signaling, the channel is closed then
+func (d *Device) allowDataChannel(dc *WEBRTC.DataChannel) bool {
+	required, ok := dataChannelRoles[dc.Label()]
+	if !ok {
+		return true
+	}
+
+	if !grant.RoleAllows(d.wrtcRole, required) {
+		err := newDeviceError(DeviceErrorPermissionDenied, "role %s requires %s for data channel %s", d.wrtcRole, required, dc.Label())
+		log.Println("device data channel rejected", err)
+		d.wsSend(NewDeviceErrorMessage(err))
+		return false
+	}
+
+	return true
+}
+
+// control handler of the required role
+func (d *Device) withControlRole(required string, handler rpc.Handler) rpc.Handler {
+	return func(params json.RawMessage) (any, error) {
+		err := d.wrtcAllows(required)
+		if err != nil {
+			return nil, rpc.NewError(controlErrorCodePermissionDenied, "%v", err)
+		}
+
+		return handler(params)
+	}
+}
@@ -0,0 +1,73 @@
+package src
+
+import (
+	"fmt"
+	"log"
+
+	"device-go/src/libs/rtsp"
+	"device-go/src/libs/webrtc"
+)
+
+// rtsp digest auth realm and default username
+const rtspRealm = "kvvm"
+const rtspUsername = "kvvm"
+
+// open rtsp server, it serves the h264 stream of media source
+func (d *Device) openRtsp() error {
+	if d.rtspAddr == "" {
+		return nil
+	}
+
+	// create credentials at first open
+	if d.cf.Config.RtspPassword == "" {
+		password, err := newLocalApiToken()
+		if err != nil {
+			return err
+		}
+
+		if d.cf.Config.RtspUsername == "" {
+			d.cf.Config.RtspUsername = rtspUsername
+		}
+		d.cf.Config.RtspPassword = password
+		err = d.cf.Save()
+		if err != nil {
+			log.Println("device config save error", err)
+		}
+		log.Println("device rtsp credentials created", d.cf.Config.RtspUsername, "saved to", d.cf.path)
+	}
+
+	s := rtsp.NewServer(
+		d.rtspAddr,
+		rtspRealm,
+		d.cf.Config.RtspUsername,
+		d.cf.Config.RtspPassword,
+		d.rtspMaxClients,
+	)
+	s.OnStart = func() error {
+		return d.mediaAcquire(mediaSinkRtsp, webrtc.VideoCodecH264, func(codec string) (mediaSink, error) {
+			if codec != webrtc.VideoCodecH264 {
+				return mediaSink{}, fmt.Errorf("unsupported codec %s", codec)
+			}
+
+			return mediaSink{OnAccessUnit: s.WriteAccessUnit}, nil
+		})
+	}
+	s.OnStop = func() {
+		d.mediaRelease(mediaSinkRtsp)
+	}
+
+	err := s.Open()
+	if err != nil {
+		return err
+	}
+	d.rtsp = &s
+
+	return nil
+}
+
+func (d *Device) closeRtsp() {
+	if d.rtsp != nil {
+		d.rtsp.Close()
+		d.rtsp = nil
+	}
+}
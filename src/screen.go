@@ -0,0 +1,141 @@
+package src
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"device-go/src/libs/server"
+	"device-go/src/libs/webrtc"
+	"device-go/src/packages/screen"
+)
+
+// long polling of screen events
+const screenEventsDefaultTimeout = 30 * time.Second
+const screenEventsMaxTimeout = 60 * time.Second
+
+// frames are decoded key frames of media when it captures the device, each one spawns a decoder
+const screenDecodeInterval = 10 * time.Second
+
+// start screen detection of config, frames are captured by snapshot
+func (d *Device) screenStart() {
+	if d.cf.Config.Screen == nil {
+		return
+	}
+
+	config := *d.cf.Config.Screen
+	s := screen.NewScreen(config, videoWidth, videoHeight)
+	s.OnEvent = d.sendScreenEvent
+	d.screen = &s
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.screenCancel = cancel
+
+	d.wg.Add(1)
+	go d.handleScreen(ctx, config.Interval())
+}
+
+func (d *Device) screenStop() {
+	if d.screenCancel != nil {
+		d.screenCancel()
+		d.screenCancel = nil
+	}
+}
+
+// media captures the device, and its key frames could be decoded, only h264 is
+func (d *Device) screenSource() (bool, bool) {
+	d.mediaMu.Lock()
+	defer d.mediaMu.Unlock()
+
+	busy := d.rawBusy()
+	return busy, !busy || d.mediaCodec == webrtc.VideoCodecH264
+}
+
+// frames of raw capture every interval, while media captures the device
+// its key frames are decoded every decode interval, detection pauses with another codec
+func (d *Device) handleScreen(ctx context.Context, interval time.Duration) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failed := false
+	paused := false
+	last := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			busy, supported := d.screenSource()
+			if !supported {
+				if !paused {
+					log.Println("device screen paused, media codec is not h264")
+				}
+				paused = true
+				continue
+			}
+			paused = false
+
+			if busy && time.Since(last) < max(interval, screenDecodeInterval) {
+				continue
+			}
+			last = time.Now()
+
+			f, err := d.snapshot.Next()
+			if err != nil {
+				// log once until the next frame
+				if !failed {
+					log.Println("device screen frame error", err)
+				}
+				failed = true
+				continue
+			}
+			failed = false
+
+			d.screen.Write(f)
+		}
+	}
+}
+
+// send screen event to mqtt and the session, local api polls events
+func (d *Device) sendScreenEvent(e screen.ScreenEvent) {
+	log.Println("device screen event", e.Type, e.Region, e.Distance, e.IdleSeconds)
+
+	m := NewDeviceMessage(ScreenEvent)
+	m.ScreenEvent = &e
+
+	d.sendEvent(m)
+}
+
+// GET /api/screen/events?after=&timeout=, events after seq, it blocks until a new event or timeout in seconds
+func (d *Device) handleLocalScreenEvents(w http.ResponseWriter, req *http.Request) {
+	if d.screen == nil {
+		server.WriteError(w, http.StatusNotFound, "screen detection disabled")
+		return
+	}
+
+	after, err := useQueryUint(req, "after")
+	if err != nil {
+		server.WriteError(w, http.StatusBadRequest, "invalid after")
+		return
+	}
+	timeout, err := useQueryUint(req, "timeout")
+	if err != nil {
+		server.WriteError(w, http.StatusBadRequest, "invalid timeout")
+		return
+	}
+
+	t := min(time.Duration(timeout)*time.Second, screenEventsMaxTimeout)
+	if t == 0 {
+		t = screenEventsDefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t)
+	defer cancel()
+
+	events := d.screen.Events(ctx, uint64(after))
+
+	server.WriteJSON(w, http.StatusOK, map[string]any{"events": events})
+}
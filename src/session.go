@@ -0,0 +1,137 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// warning is sent before the session ends by a limit
+const sessionWarning = time.Minute
+
+const sessionCheckInterval = time.Second
+
+// reasons of session warning and end
+const (
+	SessionReasonIdle        = "idle"
+	SessionReasonMaxDuration = "max-duration"
+	SessionReasonKick        = "kick"
+)
+
+// limits of the running session, checked until it closes
+func (d *Device) sessionStart() {
+	d.sessionStarted = time.Now()
+	d.sessionActive()
+
+	if d.sessionIdleTimeout == 0 && d.sessionMaxDuration == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.sessionCancel = cancel
+
+	d.wg.Add(1)
+	go d.handleSession(ctx)
+}
+
+func (d *Device) sessionStop() {
+	if d.sessionCancel != nil {
+		d.sessionCancel()
+		d.sessionCancel = nil
+	}
+}
+
+// activity of the viewer, eg. hid input, data channel requests or keepalive
+func (d *Device) sessionActive() {
+	d.sessionActivity.Store(time.Now().UnixNano())
+}
+
+// remaining time before limits, zero of a disabled limit
+func (d *Device) sessionRemaining() (time.Duration, time.Duration) {
+	var idle, duration time.Duration
+
+	if d.sessionIdleTimeout > 0 {
+		idle = max(d.sessionIdleTimeout-time.Since(time.Unix(0, d.sessionActivity.Load())), 0)
+	}
+	if d.sessionMaxDuration > 0 {
+		duration = max(d.sessionMaxDuration-time.Since(d.sessionStarted), 0)
+	}
+
+	return idle, duration
+}
+
+func (d *Device) handleSession(ctx context.Context) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(sessionCheckInterval)
+	defer ticker.Stop()
+
+	// warned once, idle is warned again after new activity
+	idleWarned := false
+	durationWarned := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			idle, duration := d.sessionRemaining()
+
+			if d.sessionIdleTimeout > 0 {
+				if idle == 0 {
+					d.sessionEnd(SessionReasonIdle)
+					return
+				} else if idle <= sessionWarning && !idleWarned {
+					d.sendSessionWarning(SessionReasonIdle, idle)
+				}
+				idleWarned = idle <= sessionWarning
+			}
+
+			if d.sessionMaxDuration > 0 {
+				if duration == 0 {
+					d.sessionEnd(SessionReasonMaxDuration)
+					return
+				} else if duration <= sessionWarning && !durationWarned {
+					d.sendSessionWarning(SessionReasonMaxDuration, duration)
+					durationWarned = true
+				}
+			}
+		}
+	}
+}
+
+func newSessionMessage(t string, reason string, remaining time.Duration) DeviceMessage {
+	m := NewDeviceMessage(t)
+	m.Session = &DeviceMessageSession{
+		Reason:    reason,
+		Remaining: uint(remaining.Round(time.Second) / time.Second),
+	}
+
+	return m
+}
+
+// warning to the client, by signaling and the session
+func (d *Device) sendSessionWarning(reason string, remaining time.Duration) {
+	log.Println("device session warning", reason, remaining)
+
+	m := newSessionMessage(SessionWarning, reason, remaining)
+	d.wsSend(m)
+	d.sendSessionEvent(m)
+}
+
+// end the session by a limit or kick of admin, the client is told the reason before close
+func (d *Device) sessionEnd(reason string) error {
+	wrtc := d.useWrtc()
+	if wrtc == nil {
+		return fmt.Errorf("device null webrtc")
+	}
+
+	log.Println("device session end", reason)
+
+	m := newSessionMessage(SessionEnd, reason, 0)
+	d.wsSend(m)
+	d.sendSessionEvent(m)
+
+	return wrtc.Close()
+}
@@ -0,0 +1,161 @@
+package src
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"device-go/src/libs/server"
+	"device-go/src/libs/websocket"
+	"device-go/src/packages/mqtt"
+)
+
+// local signaling, when the cloud is unreachable the lan client signals through the local api
+const (
+	// only when mqtt is not connected
+	LocalSignalAuto   = "auto"
+	LocalSignalAlways = "always"
+	LocalSignalOff    = "off"
+)
+
+// mqtt is opened again after this, if it fails at start
+const mqttRetryInterval = 30 * time.Second
+
+// cloud signaling is reachable, mqtt requests start the cloud websocket
+func (d *Device) cloudReachable() bool {
+	m := d.useMqtt()
+	return m != nil && m.IsConnected()
+}
+
+// local signaling is accepted now
+func (d *Device) localSignalAllowed() bool {
+	switch d.localSignal {
+	case LocalSignalAlways:
+		return true
+	case LocalSignalAuto:
+		return !d.cloudReachable()
+	default:
+		return false
+	}
+}
+
+// open mqtt, it retries in background if the broker is unreachable, the device is usable on lan meanwhile
+func (d *Device) mqttStart() {
+	if d.cf.Config.ID == "" {
+		return
+	}
+
+	if d.mqttOpen() {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.mqttCancel = cancel
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(mqttRetryInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if d.mqttOpen() {
+					return
+				}
+			}
+		}
+	}()
+}
+
+func (d *Device) mqttStop() {
+	if d.mqttCancel != nil {
+		d.mqttCancel()
+		d.mqttCancel = nil
+	}
+}
+
+func (d *Device) mqttOpen() bool {
+	m := mqtt.NewMqtt(d.cf.Config.ID, d.mqttUrl)
+	m.OnRequest = func(msg []byte) {
+		res := d.handleMqttMessage(msg)
+		m.Send(res)
+	}
+
+	err := m.Open()
+	if err != nil {
+		log.Println("device mqtt open error", err)
+		return false
+	}
+
+	d.signalMu.Lock()
+	d.mqtt = &m
+	d.signalMu.Unlock()
+
+	return true
+}
+
+// GET /api/signal, local signaling websocket, messages are the same as the cloud websocket
+//
+// sessions of local signaling use host candidates only, there are no ice servers
+func (d *Device) handleLocalSignal(w http.ResponseWriter, req *http.Request) {
+	if !d.localSignalAllowed() {
+		server.WriteError(w, http.StatusConflict, "cloud is reachable, use cloud signaling")
+		return
+	} else if ws, _ := d.useResponseWs(); ws != nil {
+		server.WriteError(w, http.StatusConflict, "signaling is in use")
+		return
+	}
+
+	ws, err := websocket.Accept(w, req)
+	if err != nil {
+		log.Println("device local signal accept error", err)
+		return
+	}
+
+	ws.OnMessage = func(messageType int, message []byte) {
+		m := d.handleWsMessage(message)
+		ws.Send(m)
+	}
+	// the session is kept, it closes after the disconnect timeout
+	ws.OnDisconnect = func(err error) {
+		log.Println("device local signal disconnect", err)
+		go func() {
+			if current, _ := d.useResponseWs(); current == ws {
+				d.wsStop()
+			}
+		}()
+	}
+
+	// before open, messages use it, another request could be accepted meanwhile
+	d.signalMu.Lock()
+	if d.responseWs != nil {
+		d.signalMu.Unlock()
+		ws.Close()
+		return
+	}
+	d.responseWs = ws
+	d.responseWsLocal = true
+	d.signalMu.Unlock()
+
+	err = ws.Open()
+	if err != nil {
+		log.Println("device local signal open error", err)
+		d.signalMu.Lock()
+		if d.responseWs == ws {
+			d.responseWs = nil
+			d.responseWsLocal = false
+		}
+		d.signalMu.Unlock()
+		return
+	}
+	log.Println("device local signal open", req.RemoteAddr)
+
+	// send first message
+	ws.Send(NewDeviceMessage(""))
+}
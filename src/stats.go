@@ -0,0 +1,155 @@
+package src
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"device-go/src/libs/webrtc"
+)
+
+// reports of the session are sent to the events data channel at this interval
+const wrtcStatsInterval = 5 * time.Second
+
+// summary of the running session is published to mqtt at this interval, and at close
+const wrtcStatsPublishInterval = time.Minute
+
+// aggregate of session reports, totals are across sessions for metrics
+type wrtcStats struct {
+	start      time.Time
+	published  time.Time
+	last       webrtc.StatsReport
+	reports    uint64
+	rttSum     float64
+	rttMax     float64
+	lostMax    float64
+	bitRateSum float64
+
+	nacks       uint64
+	plis        uint64
+	packetsLost int64
+
+	mu sync.Mutex
+}
+
+func newWebRTCStatsMessage(r webrtc.StatsReport) *DeviceMessageWebRTCStats {
+	return &DeviceMessageWebRTCStats{
+		Rtt:                 r.Rtt,
+		Jitter:              r.Jitter,
+		FractionLost:        r.FractionLost,
+		PacketsLost:         r.PacketsLost,
+		Nacks:               r.Nacks,
+		Plis:                r.Plis,
+		Firs:                r.Firs,
+		BitRate:             r.Bitrate,
+		LocalCandidateType:  r.LocalCandidateType,
+		RemoteCandidateType: r.RemoteCandidateType,
+		Protocol:            r.Protocol,
+	}
+}
+
+// reset of a new session
+func (s *wrtcStats) open() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.start = time.Now()
+	s.published = s.start
+	s.last = webrtc.StatsReport{}
+	s.reports = 0
+	s.rttSum = 0
+	s.rttMax = 0
+	s.lostMax = 0
+	s.bitRateSum = 0
+}
+
+// add report of the session, summary is returned when it should be published
+func (s *wrtcStats) add(r webrtc.StatsReport) *DeviceMessageWebRTCStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// counters of the session only increase
+	if r.Nacks > s.last.Nacks {
+		s.nacks += uint64(r.Nacks - s.last.Nacks)
+	}
+	if r.Plis > s.last.Plis {
+		s.plis += uint64(r.Plis - s.last.Plis)
+	}
+	if r.PacketsLost > s.last.PacketsLost {
+		s.packetsLost += r.PacketsLost - s.last.PacketsLost
+	}
+
+	s.last = r
+	s.reports++
+	s.rttSum += r.Rtt
+	s.rttMax = max(s.rttMax, r.Rtt)
+	s.lostMax = max(s.lostMax, r.FractionLost)
+	s.bitRateSum += r.Bitrate
+
+	if time.Since(s.published) < wrtcStatsPublishInterval {
+		return nil
+	}
+	s.published = time.Now()
+
+	return s.summary()
+}
+
+// summary at close, nil without reports
+func (s *wrtcStats) close() *DeviceMessageWebRTCStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reports == 0 {
+		return nil
+	}
+
+	m := s.summary()
+	s.last = webrtc.StatsReport{}
+	s.reports = 0
+
+	return m
+}
+
+// summary under lock
+func (s *wrtcStats) summary() *DeviceMessageWebRTCStats {
+	m := newWebRTCStatsMessage(s.last)
+	m.Duration = time.Since(s.start).Seconds()
+	m.Reports = s.reports
+	m.Rtt = s.rttSum / float64(s.reports)
+	m.RttMax = s.rttMax
+	m.FractionLostMax = s.lostMax
+	m.BitRate = s.bitRateSum / float64(s.reports)
+
+	return m
+}
+
+// write metrics, gauges are of the running session
+func (s *wrtcStats) writeMetrics(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeMetric(w, "kvvm_webrtc_rtt_seconds", "gauge", "WebRTC round trip time", s.last.Rtt)
+	writeMetric(w, "kvvm_webrtc_jitter_seconds", "gauge", "WebRTC video jitter of the client", s.last.Jitter)
+	writeMetric(w, "kvvm_webrtc_fraction_lost", "gauge", "WebRTC video fraction lost of the client", s.last.FractionLost)
+	writeMetric(w, "kvvm_webrtc_bitrate_bps", "gauge", "WebRTC sent bitrate in bits per second", s.last.Bitrate)
+	writeMetric(w, "kvvm_webrtc_packets_lost_total", "counter", "WebRTC video packets lost", s.packetsLost)
+	writeMetric(w, "kvvm_webrtc_nacks_total", "counter", "WebRTC video nacks", s.nacks)
+	writeMetric(w, "kvvm_webrtc_plis_total", "counter", "WebRTC video picture loss indications", s.plis)
+}
+
+// report of the session to the events data channel, summary to mqtt
+func (d *Device) sendWebRTCStats(r webrtc.StatsReport) {
+	m := NewDeviceMessage(WebRTCStats)
+	m.WebRTCStats = newWebRTCStatsMessage(r)
+	d.sendSessionEvent(m)
+
+	if summary := d.wrtcStats.add(r); summary != nil {
+		d.sendWebRTCStatsSummary(summary)
+	}
+}
+
+func (d *Device) sendWebRTCStatsSummary(summary *DeviceMessageWebRTCStats) {
+	m := NewDeviceMessage(WebRTCStats)
+	m.WebRTCStats = summary
+	d.sendMqttEvent(m)
+}
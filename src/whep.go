@@ -0,0 +1,199 @@
+package src
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	WEBRTC "github.com/pion/webrtc/v4"
+
+	"device-go/src/libs/server"
+	"device-go/src/libs/webrtc"
+)
+
+// whep offer size limit
+const whepMaxOfferSize = 64 * 1024
+
+// answer has all local candidates, whep clients may not trickle
+const whepGatheringTimeout = 5 * time.Second
+
+const whepContentType = "application/sdp"
+
+// media sink name of a whep session
+func whepSinkName(id string) string {
+	return "whep-" + id
+}
+
+// reserve a slot of whep session, false if there are too many sessions
+func (d *Device) whepReserve() bool {
+	d.whepMu.Lock()
+	defer d.whepMu.Unlock()
+
+	if len(d.whepSessions)+d.whepReserved >= d.whepMaxSessions {
+		return false
+	}
+	d.whepReserved++
+
+	return true
+}
+
+// whep session, it pulls video only, there is no hid or data channel
+//
+// the session takes the slot of `whepReserve`, the slot is released if setup fails before
+func (d *Device) whepStart(offer *WEBRTC.SessionDescription) (string, *WEBRTC.SessionDescription, error) {
+	registered := false
+	defer func() {
+		if !registered {
+			d.whepMu.Lock()
+			d.whepReserved--
+			d.whepMu.Unlock()
+		}
+	}()
+
+	// media of other sinks keeps its codec, a viewer without it could not decode
+	codecs := d.videoCodecs
+	d.mediaMu.Lock()
+	running := d.mediaRunning()
+	if running {
+		codecs = []string{d.mediaCodec}
+	}
+	d.mediaMu.Unlock()
+
+	if running && !webrtc.OffersVideoCodec(offer, codecs[0]) {
+		return "", nil, newDeviceError(DeviceErrorCodecUnsupported, "offer has no %s of running media", codecs[0])
+	}
+	codec := webrtc.NegotiateVideoCodec(offer, codecs)
+
+	id, err := newLocalApiToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	wrtc := &webrtc.WebRTC{
+		DisconnectTimeout: d.wrtcDisconnectTimeout,
+	}
+	wrtc.OnClose = func() {
+		log.Println("device whep close", id)
+
+		d.whepMu.Lock()
+		delete(d.whepSessions, id)
+		d.whepMu.Unlock()
+
+		d.mediaRelease(whepSinkName(id))
+	}
+
+	// lan viewers, no ice servers
+	err = wrtc.Open(nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = d.mediaAcquire(whepSinkName(id), codec, func(codec string) (mediaSink, error) {
+		return d.useVideoTrackSink(wrtc, codec)
+	})
+	if err != nil {
+		wrtc.Close()
+		return "", nil, err
+	}
+
+	d.whepMu.Lock()
+	d.whepReserved--
+	d.whepSessions[id] = wrtc
+	d.whepMu.Unlock()
+	registered = true
+
+	answer, err := wrtc.UseOfferGathered(offer, whepGatheringTimeout)
+	if err != nil {
+		wrtc.Close()
+		return "", nil, err
+	}
+
+	log.Println("device whep start", id, codec)
+
+	return id, answer, nil
+}
+
+func (d *Device) whepStop(id string) bool {
+	d.whepMu.Lock()
+	wrtc, ok := d.whepSessions[id]
+	d.whepMu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	wrtc.Close()
+	return true
+}
+
+// close all whep sessions
+func (d *Device) whepClose() {
+	d.whepMu.Lock()
+	sessions := make([]*webrtc.WebRTC, 0, len(d.whepSessions))
+	for _, wrtc := range d.whepSessions {
+		sessions = append(sessions, wrtc)
+	}
+	d.whepMu.Unlock()
+
+	for _, wrtc := range sessions {
+		wrtc.Close()
+	}
+}
+
+// POST /api/whep, sdp offer in body, responds the answer, the session resource is in location
+func (d *Device) handleLocalWhep(w http.ResponseWriter, req *http.Request) {
+	mt, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || mt != whepContentType {
+		server.WriteError(w, http.StatusUnsupportedMediaType, "content type must be "+whepContentType)
+		return
+	}
+
+	b, err := io.ReadAll(io.LimitReader(req.Body, whepMaxOfferSize+1))
+	if err != nil {
+		server.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if len(b) > whepMaxOfferSize {
+		server.WriteError(w, http.StatusRequestEntityTooLarge, "offer too large")
+		return
+	}
+
+	if !d.whepReserve() {
+		server.WriteError(w, http.StatusServiceUnavailable, "too many whep sessions")
+		return
+	}
+
+	id, answer, err := d.whepStart(&WEBRTC.SessionDescription{Type: WEBRTC.SDPTypeOffer, SDP: string(b)})
+	if err != nil {
+		log.Println("device whep start error", err)
+
+		var de *DeviceError
+		if errors.As(err, &de) && de.Code == DeviceErrorCodecUnsupported {
+			server.WriteError(w, http.StatusNotAcceptable, de.Message)
+			return
+		}
+		server.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", whepContentType)
+	w.Header().Set("Location", "/api/whep/"+id)
+	w.WriteHeader(http.StatusCreated)
+
+	_, err = io.WriteString(w, answer.SDP)
+	if err != nil {
+		log.Println("device whep write answer error", err)
+	}
+}
+
+// DELETE /api/whep/{id}, stop the session
+func (d *Device) handleLocalWhepStop(w http.ResponseWriter, req *http.Request) {
+	if !d.whepStop(req.PathValue("id")) {
+		server.WriteError(w, http.StatusNotFound, "whep session not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}